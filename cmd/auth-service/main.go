@@ -4,9 +4,16 @@ import (
 	"log"
 	"os"
 
+	"github.com/Debt-Solvers/BE-auth-service/configs"
 	"github.com/Debt-Solvers/BE-auth-service/db"
+	"github.com/Debt-Solvers/BE-auth-service/internal/common"
+	"github.com/Debt-Solvers/BE-auth-service/internal/keystore"
+	"github.com/Debt-Solvers/BE-auth-service/internal/mailer"
 	"github.com/Debt-Solvers/BE-auth-service/internal/middleware"
+	"github.com/Debt-Solvers/BE-auth-service/internal/passwordpolicy"
+	"github.com/Debt-Solvers/BE-auth-service/internal/ratelimit"
 	"github.com/Debt-Solvers/BE-auth-service/internal/routes"
+	"github.com/Debt-Solvers/BE-auth-service/utils"
 
 	"github.com/gin-gonic/gin"
 )
@@ -23,8 +30,51 @@ func main() {
 		log.Fatalf("Error executing schema: %v", err)
 	}
 
+	// Give the configured admins their role
+	common.AssignConfiguredAdmins()
+
+	// Forget old failed logins
+	common.StartLoginThrottleCleanup()
+
+	// Load the password pepper keys
+	if err := utils.LoadPasswordPepper(); err != nil {
+		log.Fatalf("Password pepper error: %v", err)
+	}
+
+	// Check the key that encrypts secrets at rest
+	if err := utils.CheckEncryptionKey(); err != nil {
+		log.Fatalf("Encryption key error: %v", err)
+	}
+
+	// Load the token signing keys and keep them rotating
+	if err := keystore.Start(); err != nil {
+		log.Fatalf("Signing key error: %v", err)
+	}
+
+	// Set up email delivery
+	if _, err := mailer.Default(); err != nil {
+		log.Fatalf("Mailer configuration error: %v", err)
+	}
+	common.StartEmailOutboxWorker()
+
+	// Set up rate limiting
+	if _, err := ratelimit.Default(); err != nil {
+		log.Fatalf("Rate limit configuration error: %v", err)
+	}
+	ratelimit.StartPruning()
+
+	// Load the breached password dataset and screen passwords at login
+	if err := passwordpolicy.StartBreachDataset(); err != nil {
+		log.Fatalf("Breached password dataset error: %v", err)
+	}
+	common.StartBreachScreening()
+
 	// Initialize Gin engine
 	server := gin.Default()
+	// Client IPs key the rate limits, so only our own proxies may forward them
+	if err := server.SetTrustedProxies(configs.GetConfig().RateLimit.TrustedProxies); err != nil {
+		log.Fatalf("Trusted proxy configuration error: %v", err)
+	}
 	// Register the logging middleware
 	server.Use(middleware.Logger()) 
 
@@ -0,0 +1,88 @@
+// Command breach-filter builds a Bloom filter from a Have I Been Pwned style SHA-1 hash file, for
+// password_policy.breach_file when the full hash file is too large to ship with the service.
+//
+//	go run ./cmd/breach-filter -in pwned-passwords-sha1.txt -out breached.bloom -fp 0.001
+//
+// Write the filter next to the configured file and rename it over it, so a running service never
+// reloads a half-written filter.
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/Debt-Solvers/BE-auth-service/internal/passwordpolicy"
+)
+
+func main() {
+	in := flag.String("in", "", "SHA-1 hash file, one hash per line, optionally followed by :count")
+	out := flag.String("out", "", "Bloom filter file to write")
+	falsePositiveRate := flag.Float64("fp", 0.001, "Share of passwords that are not breached but reported as breached")
+	flag.Parse()
+
+	if *in == "" || *out == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// The filter is sized for the number of hashes, so the file is read twice
+	var count uint64
+	if err := eachHash(*in, func([sha1.Size]byte) { count++ }); err != nil {
+		log.Fatalf("Reading %s: %v", *in, err)
+	}
+
+	filter, err := passwordpolicy.NewBloomFilter(count, *falsePositiveRate)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := eachHash(*in, filter.Add); err != nil {
+		log.Fatalf("Reading %s: %v", *in, err)
+	}
+
+	file, err := os.Create(*out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	writer := bufio.NewWriter(file)
+	if _, err := filter.WriteTo(writer); err != nil {
+		log.Fatalf("Writing %s: %v", *out, err)
+	}
+	if err := writer.Flush(); err != nil {
+		log.Fatalf("Writing %s: %v", *out, err)
+	}
+	if err := file.Close(); err != nil {
+		log.Fatalf("Writing %s: %v", *out, err)
+	}
+	log.Printf("Wrote %d hashes to %s", count, *out)
+}
+
+// eachHash calls fn with every hash in the file
+func eachHash(path string, fn func([sha1.Size]byte)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		hexHash, _, _ := strings.Cut(text, ":")
+
+		var hash [sha1.Size]byte
+		if n, err := hex.Decode(hash[:], []byte(hexHash)); err != nil || n != sha1.Size || len(hexHash) != 2*sha1.Size {
+			return fmt.Errorf("line %d is not a SHA-1 hash", line)
+		}
+		fn(hash)
+	}
+	return scanner.Err()
+}
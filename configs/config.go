@@ -3,6 +3,7 @@ package configs
 import (
 	"log"
 	"strings"
+	"sync"
 
 	"github.com/spf13/viper"
 )
@@ -18,11 +19,157 @@ type Config struct {
 		SSLMode  string `mapstructure:"sslmode"`
 	} `mapstructure:"database"`
 	JWT struct {
-		Secret           string `mapstructure:"secret"`
-		ExpirationHours  int    `mapstructure:"expiration_hours"`
+		AccessTokenMinutes int    `mapstructure:"access_token_minutes"`
+		RefreshTokenDays   int    `mapstructure:"refresh_token_days"`
+		SigningAlgorithm   string `mapstructure:"signing_algorithm"`   // RS256, ES256 or EdDSA
+		KeyRotationDays    int    `mapstructure:"key_rotation_days"`   // How long a key signs before its successor takes over
+		KeyPublishHours    int    `mapstructure:"key_publish_hours"`   // How long a new key is published before it starts signing
+		KeyRefreshSeconds  int    `mapstructure:"key_refresh_seconds"` // How often each instance reloads the key store
 	} `mapstructure:"jwt"`
+	Security struct {
+		EncryptionKey string `mapstructure:"encryption_key"` // Base64 AES-256 key for secrets stored in the database
+	} `mapstructure:"security"`
+	MFA struct {
+		Issuer           string `mapstructure:"issuer"`
+		ChallengeMinutes int    `mapstructure:"challenge_minutes"`
+		MaxFailedCodes   int    `mapstructure:"max_failed_codes"`
+		LockoutMinutes   int    `mapstructure:"lockout_minutes"`
+	} `mapstructure:"mfa"`
+	WebAuthn struct {
+		RPID           string   `mapstructure:"rp_id"`           // Domain the passkeys are bound to
+		RPDisplayName  string   `mapstructure:"rp_display_name"` // Name shown by the authenticator
+		RPOrigins      []string `mapstructure:"rp_origins"`      // Origins (web or android:apk-key-hash) allowed to run ceremonies
+		TimeoutMinutes int      `mapstructure:"timeout_minutes"` // How long a begun ceremony can be finished
+	} `mapstructure:"webauthn"`
+	EmailVerification struct {
+		TokenHours      int    `mapstructure:"token_hours"`      // How long a verification link stays valid
+		LinkURL         string `mapstructure:"link_url"`         // URL the verification token is appended to
+		UnverifiedLogin string `mapstructure:"unverified_login"` // "block" or "restricted"
+	} `mapstructure:"email_verification"`
+	PasswordReset struct {
+		TokenMinutes int `mapstructure:"token_minutes"` // How long an emailed reset code stays valid
+		MaxAttempts  int `mapstructure:"max_attempts"`  // Wrong codes allowed before the code stops working
+	} `mapstructure:"password_reset"`
+	PasswordPolicy struct {
+		MinLength          int  `mapstructure:"min_length"`           // Shortest password, in characters
+		MaxLength          int  `mapstructure:"max_length"`           // Longest password, in characters
+		MinEntropyBits     int  `mapstructure:"min_entropy_bits"`     // Minimum estimated strength, 0 turns the check off
+		RejectPersonalInfo bool `mapstructure:"reject_personal_info"` // Reject passwords containing the user's email or name
+
+		BreachedPasswords   string `mapstructure:"breached_passwords"`    // "off", "warn" or "block" passwords found in BreachFile
+		BreachFile          string `mapstructure:"breach_file"`           // Sorted SHA-1 hash file or Bloom filter built by cmd/breach-filter
+		BreachReloadSeconds int    `mapstructure:"breach_reload_seconds"` // How often BreachFile is checked for a new version
+	} `mapstructure:"password_policy"`
+	PasswordHashing struct {
+		Algorithm string `mapstructure:"algorithm"` // "argon2id" or "bcrypt", for new hashes and hashes upgraded at login
+		Argon2id  struct {
+			MemoryKiB   int `mapstructure:"memory_kib"`  // Memory used per hash
+			Iterations  int `mapstructure:"iterations"`  // Passes over the memory
+			Parallelism int `mapstructure:"parallelism"` // Threads per hash
+			SaltBytes   int `mapstructure:"salt_bytes"`
+			KeyBytes    int `mapstructure:"key_bytes"` // Length of the derived hash
+
+			MaxConcurrent int `mapstructure:"max_concurrent"` // Hashes running at once, each holding MemoryKiB
+			QueueMillis   int `mapstructure:"queue_ms"`       // How long a hash waits for a free slot before the request is refused
+		} `mapstructure:"argon2id"`
+		BcryptCost int `mapstructure:"bcrypt_cost"` // Unpeppered passwords over 72 bytes cannot be hashed with bcrypt, so the policy then caps them
+
+		PepperVersion int    `mapstructure:"pepper_version"` // Pepper key version new hashes use, 0 for none
+		PepperKeys    string `mapstructure:"pepper_keys"`    // "<version>:<base64 key>" entries, comma separated; set through PASSWORD_PEPPER_KEYS
+		PepperFile    string `mapstructure:"pepper_file"`    // Secret file with one "<version>:<base64 key>" entry per line
+	} `mapstructure:"password_hashing"`
+	LoginThrottle struct {
+		FreeAttempts    int    `mapstructure:"free_attempts"`     // Failed logins allowed before delays start
+		DelaySeconds    int    `mapstructure:"delay_seconds"`     // Delay after the first delayed failure, doubled on each further one
+		MaxDelaySeconds int    `mapstructure:"max_delay_seconds"` // Upper bound for the delay
+		LockoutAttempts int    `mapstructure:"lockout_attempts"`  // Failed logins that lock the email address
+		LockoutMinutes  int    `mapstructure:"lockout_minutes"`   // How long a lock lasts unless the unlock link is used
+		WindowMinutes   int    `mapstructure:"window_minutes"`    // Failures are forgotten after this long without another
+		UnlockLinkURL   string `mapstructure:"unlock_link_url"`   // URL the unlock token is appended to
+	} `mapstructure:"login_throttle"`
+	RateLimit struct {
+		Store          string                   `mapstructure:"store"`           // "memory" or "postgres"
+		Rules          map[string]RateLimitRule `mapstructure:"rules"`           // Keyed by the name passed to middleware.RateLimit
+		TrustedProxies []string                 `mapstructure:"trusted_proxies"` // Proxies whose X-Forwarded-For header gives the client IP
+	} `mapstructure:"rate_limit"`
+	OAuth struct {
+		CodeMinutes               int      `mapstructure:"code_minutes"`                // How long an authorization code can be exchanged
+		Issuer                    string   `mapstructure:"issuer"`                      // Public base URL, the iss claim of ID tokens
+		IDTokenMinutes            int      `mapstructure:"id_token_minutes"`            // How long an ID token stays valid
+		TrustedClients            []string `mapstructure:"trusted_clients"`             // OAuth client IDs of our own apps, which may introspect and revoke any token; service clients need no entry
+		IntrospectionCacheSeconds int      `mapstructure:"introspection_cache_seconds"` // How long callers may cache an introspection response
+		ServiceTokenMinutes       int      `mapstructure:"service_token_minutes"`       // How long a client credentials token stays valid
+	} `mapstructure:"oauth"`
+	Mail struct {
+		Driver   string `mapstructure:"driver"`    // "smtp", "log", "file" or "memory"
+		From     string `mapstructure:"from"`      // Sender address
+		FromName string `mapstructure:"from_name"` // Sender display name
+		FileDir  string `mapstructure:"file_dir"`  // Directory for the file driver
+		SMTP     struct {
+			Host     string `mapstructure:"host"`
+			Port     int    `mapstructure:"port"`
+			Username string `mapstructure:"username"`
+			Password string `mapstructure:"password"`
+		} `mapstructure:"smtp"`
+		Outbox struct {
+			PollSeconds       int `mapstructure:"poll_seconds"`        // How often the worker looks for due emails
+			BatchSize         int `mapstructure:"batch_size"`          // Emails claimed per poll
+			MaxAttempts       int `mapstructure:"max_attempts"`        // Attempts before an email is marked dead
+			BackoffSeconds    int `mapstructure:"backoff_seconds"`     // Delay after the first failure, doubled on each retry
+			MaxBackoffMinutes int `mapstructure:"max_backoff_minutes"` // Upper bound for the retry delay
+		} `mapstructure:"outbox"`
+	} `mapstructure:"mail"`
+	Admin struct {
+		Emails []string `mapstructure:"emails"` // Accounts given the admin role at startup
+	} `mapstructure:"admin"`
+	SocialLogin struct {
+		SessionMinutes int                            `mapstructure:"session_minutes"` // How long a begun social login can be finished
+		Providers      map[string]SocialLoginProvider `mapstructure:"providers"`       // Keyed by the name used in the URL
+	} `mapstructure:"social_login"`
+}
+
+// SocialLoginProvider configures an upstream OpenID Connect provider users can sign in with.
+// A provider without a client ID is disabled.
+type SocialLoginProvider struct {
+	DisplayName  string   `mapstructure:"display_name"`  // Name shown on the login button
+	Issuer       string   `mapstructure:"issuer"`        // Discovery is loaded from <issuer>/.well-known/openid-configuration
+	ClientID     string   `mapstructure:"client_id"`     // Client registered with the provider
+	ClientSecret string   `mapstructure:"client_secret"` // Sent in the token request body
+	RedirectURL  string   `mapstructure:"redirect_url"`  // Where the provider sends the user back; the app posts the code to /finish
+	Scopes       []string `mapstructure:"scopes"`        // Requested in addition to openid
+	ResponseMode string   `mapstructure:"response_mode"` // Optional, e.g. form_post for Apple
 }
 
+// RateLimitRule limits requests to one group of endpoints. A rule without requests is disabled.
+type RateLimitRule struct {
+	Requests      int      `mapstructure:"requests"`       // Requests allowed per period, all of which can be made at once
+	PeriodSeconds int      `mapstructure:"period_seconds"` // Time in which an exhausted limit refills
+	By            []string `mapstructure:"by"`             // "ip", "email" or both; each value gets its own limit
+}
+
+// Values for RateLimitRule.By
+const (
+	RateLimitByIP    = "ip"    // The client IP address
+	RateLimitByEmail = "email" // The email field of the JSON body
+)
+
+// Values for PasswordHashing.Algorithm
+const (
+	PasswordHashArgon2id = "argon2id"
+	PasswordHashBcrypt   = "bcrypt"
+)
+
+// Values for EmailVerification.UnverifiedLogin
+const (
+	UnverifiedLoginBlock      = "block"      // Unverified accounts cannot log in
+	UnverifiedLoginRestricted = "restricted" // Unverified accounts get a reduced-scope token
+)
+
+var (
+	appConfig  *Config
+	configOnce sync.Once
+)
+
 // LoadConfig reads configuration from file and environment variables
 func LoadConfig() *Config {
 	var config Config
@@ -36,6 +183,81 @@ func LoadConfig() *Config {
 	viper.AutomaticEnv()                  // automatically override config with env vars
 	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_")) // replace '.' with '_' in env vars
 
+	// Defaults for values that may be missing from both the file and the environment
+	viper.SetDefault("jwt.access_token_minutes", 15)
+	viper.SetDefault("jwt.refresh_token_days", 30)
+	viper.SetDefault("jwt.signing_algorithm", "RS256")
+	viper.SetDefault("jwt.key_rotation_days", 30)
+	viper.SetDefault("jwt.key_publish_hours", 24)
+	viper.SetDefault("jwt.key_refresh_seconds", 60)
+	viper.SetDefault("mfa.issuer", "Debt Solver")
+	viper.SetDefault("mfa.challenge_minutes", 5)
+	viper.SetDefault("mfa.max_failed_codes", 5)
+	viper.SetDefault("mfa.lockout_minutes", 15)
+	viper.SetDefault("webauthn.rp_display_name", "Debt Solver")
+	viper.SetDefault("webauthn.timeout_minutes", 5)
+	viper.SetDefault("email_verification.token_hours", 24)
+	viper.SetDefault("email_verification.unverified_login", UnverifiedLoginRestricted)
+	viper.SetDefault("password_reset.token_minutes", 60)
+	viper.SetDefault("password_reset.max_attempts", 5)
+	viper.SetDefault("password_policy.min_length", 8)
+	viper.SetDefault("password_policy.max_length", 128)
+	viper.SetDefault("password_policy.min_entropy_bits", 45)
+	viper.SetDefault("password_policy.reject_personal_info", true)
+	viper.SetDefault("password_policy.breached_passwords", "block")
+	viper.SetDefault("password_policy.breach_reload_seconds", 60)
+	viper.SetDefault("password_hashing.algorithm", PasswordHashArgon2id)
+	viper.SetDefault("password_hashing.argon2id.memory_kib", 64*1024)
+	viper.SetDefault("password_hashing.argon2id.iterations", 3)
+	viper.SetDefault("password_hashing.argon2id.parallelism", 2)
+	viper.SetDefault("password_hashing.argon2id.salt_bytes", 16)
+	viper.SetDefault("password_hashing.argon2id.key_bytes", 32)
+	viper.SetDefault("password_hashing.argon2id.max_concurrent", 8)
+	viper.SetDefault("password_hashing.argon2id.queue_ms", 1000)
+	viper.SetDefault("password_hashing.bcrypt_cost", 12)
+	viper.SetDefault("login_throttle.free_attempts", 3)
+	viper.SetDefault("login_throttle.delay_seconds", 1)
+	viper.SetDefault("login_throttle.max_delay_seconds", 60)
+	viper.SetDefault("login_throttle.lockout_attempts", 10)
+	viper.SetDefault("login_throttle.lockout_minutes", 30)
+	viper.SetDefault("login_throttle.window_minutes", 60)
+	viper.SetDefault("login_throttle.unlock_link_url", "http://localhost:8080/api/v1/login/unlock?token=")
+	viper.SetDefault("rate_limit.store", "memory")
+	viper.SetDefault("rate_limit.rules.signup.requests", 5)
+	viper.SetDefault("rate_limit.rules.signup.period_seconds", 3600)
+	viper.SetDefault("rate_limit.rules.signup.by", []string{RateLimitByIP})
+	viper.SetDefault("rate_limit.rules.login.requests", 20)
+	viper.SetDefault("rate_limit.rules.login.period_seconds", 300)
+	viper.SetDefault("rate_limit.rules.login.by", []string{RateLimitByIP, RateLimitByEmail})
+	viper.SetDefault("rate_limit.rules.mfa_login.requests", 10)
+	viper.SetDefault("rate_limit.rules.mfa_login.period_seconds", 300)
+	viper.SetDefault("rate_limit.rules.mfa_login.by", []string{RateLimitByIP})
+	viper.SetDefault("rate_limit.rules.webauthn_login.requests", 20)
+	viper.SetDefault("rate_limit.rules.webauthn_login.period_seconds", 300)
+	viper.SetDefault("rate_limit.rules.webauthn_login.by", []string{RateLimitByIP})
+	viper.SetDefault("rate_limit.rules.password_reset.requests", 5)
+	viper.SetDefault("rate_limit.rules.password_reset.period_seconds", 3600)
+	viper.SetDefault("rate_limit.rules.password_reset.by", []string{RateLimitByIP, RateLimitByEmail})
+	viper.SetDefault("rate_limit.rules.verification_resend.requests", 3)
+	viper.SetDefault("rate_limit.rules.verification_resend.period_seconds", 3600)
+	viper.SetDefault("rate_limit.rules.verification_resend.by", []string{RateLimitByIP, RateLimitByEmail})
+	viper.SetDefault("oauth.code_minutes", 5)
+	viper.SetDefault("oauth.issuer", "http://localhost:8080")
+	viper.SetDefault("oauth.id_token_minutes", 60)
+	viper.SetDefault("oauth.introspection_cache_seconds", 30)
+	viper.SetDefault("oauth.service_token_minutes", 15)
+	viper.SetDefault("social_login.session_minutes", 10)
+	viper.SetDefault("mail.driver", "log")
+	viper.SetDefault("mail.from", "no-reply@debtsolver.local")
+	viper.SetDefault("mail.from_name", "Debt Solver")
+	viper.SetDefault("mail.file_dir", "./mail")
+	viper.SetDefault("mail.smtp.port", 587)
+	viper.SetDefault("mail.outbox.poll_seconds", 5)
+	viper.SetDefault("mail.outbox.batch_size", 20)
+	viper.SetDefault("mail.outbox.max_attempts", 8)
+	viper.SetDefault("mail.outbox.backoff_seconds", 30)
+	viper.SetDefault("mail.outbox.max_backoff_minutes", 60)
+
 	// Read the configuration file
 	if err := viper.ReadInConfig(); err != nil {
 		log.Printf("Warning: Error reading config file: %s", err)
@@ -49,8 +271,34 @@ func LoadConfig() *Config {
 	viper.BindEnv("database.password", "DB_PASSWORD")
 	viper.BindEnv("database.name", "DB_NAME")
 	viper.BindEnv("database.sslmode", "DB_SSLMODE")
-	viper.BindEnv("jwt.secret", "JWT_SECRET")
-	viper.BindEnv("jwt.expiration_hours", "JWT_EXPIRATION_HOURS")
+	viper.BindEnv("jwt.signing_algorithm", "JWT_SIGNING_ALGORITHM")
+	viper.BindEnv("jwt.access_token_minutes", "JWT_ACCESS_TOKEN_MINUTES")
+	viper.BindEnv("jwt.refresh_token_days", "JWT_REFRESH_TOKEN_DAYS")
+	viper.BindEnv("security.encryption_key", "ENCRYPTION_KEY")
+	viper.BindEnv("mfa.issuer", "MFA_ISSUER")
+	viper.BindEnv("webauthn.rp_id", "WEBAUTHN_RP_ID")
+	viper.BindEnv("webauthn.rp_origins", "WEBAUTHN_RP_ORIGINS")
+	viper.BindEnv("email_verification.link_url", "EMAIL_VERIFICATION_LINK_URL")
+	viper.BindEnv("email_verification.unverified_login", "EMAIL_VERIFICATION_UNVERIFIED_LOGIN")
+	viper.BindEnv("password_policy.breached_passwords", "PASSWORD_POLICY_BREACHED_PASSWORDS")
+	viper.BindEnv("password_policy.breach_file", "PASSWORD_POLICY_BREACH_FILE")
+	viper.BindEnv("password_hashing.algorithm", "PASSWORD_HASHING_ALGORITHM")
+	viper.BindEnv("password_hashing.pepper_version", "PASSWORD_PEPPER_VERSION")
+	viper.BindEnv("password_hashing.pepper_keys", "PASSWORD_PEPPER_KEYS")
+	viper.BindEnv("password_hashing.pepper_file", "PASSWORD_PEPPER_FILE")
+	viper.BindEnv("login_throttle.unlock_link_url", "LOGIN_THROTTLE_UNLOCK_LINK_URL")
+	viper.BindEnv("rate_limit.store", "RATE_LIMIT_STORE")
+	viper.BindEnv("rate_limit.trusted_proxies", "RATE_LIMIT_TRUSTED_PROXIES")
+	viper.BindEnv("oauth.issuer", "OAUTH_ISSUER")
+	viper.BindEnv("oauth.trusted_clients", "OAUTH_TRUSTED_CLIENTS")
+	viper.BindEnv("mail.driver", "MAIL_DRIVER")
+	viper.BindEnv("mail.from", "MAIL_FROM")
+	viper.BindEnv("mail.file_dir", "MAIL_FILE_DIR")
+	viper.BindEnv("mail.smtp.host", "SMTP_HOST")
+	viper.BindEnv("mail.smtp.port", "SMTP_PORT")
+	viper.BindEnv("mail.smtp.username", "SMTP_USERNAME")
+	viper.BindEnv("mail.smtp.password", "SMTP_PASSWORD")
+	viper.BindEnv("admin.emails", "ADMIN_EMAILS")
 
 	// Unmarshal the configuration into struct
 	if err := viper.Unmarshal(&config); err != nil {
@@ -59,3 +307,11 @@ func LoadConfig() *Config {
 
 	return &config
 }
+
+// GetConfig returns the application configuration, loading it on first use
+func GetConfig() *Config {
+	configOnce.Do(func() {
+		appConfig = LoadConfig()
+	})
+	return appConfig
+}
@@ -18,7 +18,7 @@ var DB *gorm.DB
 
 // ConnectDatabase initializes a connection to the PostgreSQL database
 func ConnectDatabase() error {
-	config := configs.LoadConfig() // Load the configuration
+	config := configs.GetConfig() // Load the configuration
 
 	// Build the connection string
 	dbURI := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
@@ -11,11 +11,23 @@ CREATE TABLE IF NOT EXISTS "users" (
   salt VARCHAR(50) NOT NULL,
   is_email_verified BOOLEAN DEFAULT FALSE,
   created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-  reset_password_token VARCHAR(255),
-  reset_password_expires TIMESTAMP WITH TIME ZONE,
   currency CHAR(3) DEFAULT 'CAD' NOT NULL CHECK (currency IN ('CAD', 'USD'))
 );
 
+-- Password reset codes moved to password_reset_tokens
+ALTER TABLE "users" DROP COLUMN IF EXISTS reset_password_token;
+ALTER TABLE "users" DROP COLUMN IF EXISTS reset_password_expires;
+
+-- Bumped whenever the user's roles change, access tokens carry the version they were issued with
+ALTER TABLE "users" ADD COLUMN IF NOT EXISTS role_version INTEGER NOT NULL DEFAULT 0;
+
+-- Set by admins: disabled accounts cannot sign in, and a required reset blocks sign-in until the password is reset
+ALTER TABLE "users" ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE "users" ADD COLUMN IF NOT EXISTS password_reset_required BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Set when a login finds the password in the breach dataset, cleared when the password changes
+ALTER TABLE "users" ADD COLUMN IF NOT EXISTS password_breached_at TIMESTAMP WITH TIME ZONE;
+
 -- Create AUTH_TOKEN table
 CREATE TABLE IF NOT EXISTS auth_tokens (
   token_id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
@@ -25,6 +37,281 @@ CREATE TABLE IF NOT EXISTS auth_tokens (
   expires_at TIMESTAMP WITH TIME ZONE NOT NULL
 );
 
+-- Access tokens grow beyond 255 characters once they carry a jti, so widen the column
+ALTER TABLE auth_tokens ALTER COLUMN token TYPE TEXT;
+-- Link each access token to the refresh token family it was issued for
+ALTER TABLE auth_tokens ADD COLUMN IF NOT EXISTS family_id UUID;
+-- Session details shown to the user when listing active sessions
+ALTER TABLE auth_tokens ADD COLUMN IF NOT EXISTS device_name VARCHAR(100);
+ALTER TABLE auth_tokens ADD COLUMN IF NOT EXISTS user_agent VARCHAR(512);
+ALTER TABLE auth_tokens ADD COLUMN IF NOT EXISTS ip_address VARCHAR(45);
+ALTER TABLE auth_tokens ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMP WITH TIME ZONE;
+
+-- Create SIGNING_KEY table: JWT signing keys, published in JWKS until every token they signed has expired
+CREATE TABLE IF NOT EXISTS signing_keys (
+  kid VARCHAR(64) PRIMARY KEY,
+  algorithm VARCHAR(10) NOT NULL CHECK (algorithm IN ('RS256', 'ES256', 'EdDSA')),
+  private_key TEXT NOT NULL, -- Encrypted with the service encryption key
+  public_key TEXT NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  activates_at TIMESTAMP WITH TIME ZONE NOT NULL, -- Starts signing new tokens
+  retires_at TIMESTAMP WITH TIME ZONE NOT NULL, -- Stops signing when its successor activates
+  expires_at TIMESTAMP WITH TIME ZONE NOT NULL -- Removed from JWKS
+);
+
+-- Create REFRESH_TOKEN table: rotated tokens share a family_id with the login that created them
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+  token_id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  user_id UUID NOT NULL REFERENCES "users"(user_id) ON DELETE CASCADE,
+  family_id UUID NOT NULL,
+  token_hash VARCHAR(64) UNIQUE NOT NULL, -- SHA-256 of the opaque token
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  rotated_at TIMESTAMP WITH TIME ZONE, -- Set once exchanged for a successor
+  revoked_at TIMESTAMP WITH TIME ZONE -- Set when the family is revoked
+);
+
+-- Create PASSWORD_RESET_TOKEN table: only a hash of the emailed code is stored
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+  token_id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  user_id UUID NOT NULL REFERENCES "users"(user_id) ON DELETE CASCADE,
+  token_hash VARCHAR(64) NOT NULL, -- SHA-256 of the code
+  failed_attempts INTEGER NOT NULL DEFAULT 0,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  used_at TIMESTAMP WITH TIME ZONE -- Set once the code has reset the password or been replaced by a newer one
+);
+
+-- Create USER_IDENTITY table: accounts at external login providers linked to a user
+CREATE TABLE IF NOT EXISTS user_identities (
+  identity_id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  user_id UUID NOT NULL REFERENCES "users"(user_id) ON DELETE CASCADE,
+  provider VARCHAR(50) NOT NULL,
+  subject VARCHAR(255) NOT NULL, -- Stable user ID at the provider
+  email VARCHAR(255),
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  last_login_at TIMESTAMP WITH TIME ZONE,
+  UNIQUE (provider, subject)
+);
+
+-- Create SOCIAL_LOGIN_SESSION table: state of a social login between begin and finish
+CREATE TABLE IF NOT EXISTS social_login_sessions (
+  state_hash VARCHAR(64) PRIMARY KEY, -- SHA-256 of the state parameter
+  provider VARCHAR(50) NOT NULL,
+  nonce VARCHAR(64) NOT NULL,
+  code_verifier VARCHAR(128) NOT NULL,
+  expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- Create PERSONAL_ACCESS_TOKEN table: scoped tokens for scripts, only a hash of each token is stored
+CREATE TABLE IF NOT EXISTS personal_access_tokens (
+  token_id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  user_id UUID NOT NULL REFERENCES "users"(user_id) ON DELETE CASCADE,
+  name VARCHAR(100) NOT NULL,
+  token_hash VARCHAR(64) UNIQUE NOT NULL, -- SHA-256 of the token
+  token_hint VARCHAR(20) NOT NULL, -- Prefix and last characters shown in the token list
+  scope TEXT NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  expires_at TIMESTAMP WITH TIME ZONE, -- NULL for tokens that do not expire
+  last_used_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Create SERVICE_CLIENT table: our own services, which authenticate with the client credentials grant
+CREATE TABLE IF NOT EXISTS service_clients (
+  client_id VARCHAR(64) PRIMARY KEY,
+  client_secret_hash VARCHAR(64) NOT NULL, -- SHA-256 of the secret
+  name VARCHAR(100) NOT NULL,
+  scope TEXT NOT NULL, -- Space-separated scopes the client may request
+  audiences TEXT NOT NULL, -- Space-separated services the client may get tokens for
+  created_by UUID REFERENCES "users"(user_id) ON DELETE SET NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create ROLE table: every user holds the user role without an assignment
+CREATE TABLE IF NOT EXISTS roles (
+  name VARCHAR(50) PRIMARY KEY,
+  description TEXT NOT NULL
+);
+
+-- Create PERMISSION table
+CREATE TABLE IF NOT EXISTS permissions (
+  name VARCHAR(100) PRIMARY KEY,
+  description TEXT NOT NULL
+);
+
+-- Create ROLE_PERMISSION table
+CREATE TABLE IF NOT EXISTS role_permissions (
+  role VARCHAR(50) NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+  permission VARCHAR(100) NOT NULL REFERENCES permissions(name) ON DELETE CASCADE,
+  PRIMARY KEY (role, permission)
+);
+
+-- Create USER_ROLE table: roles assigned to users on top of the user role
+CREATE TABLE IF NOT EXISTS user_roles (
+  user_id UUID NOT NULL REFERENCES "users"(user_id) ON DELETE CASCADE,
+  role VARCHAR(50) NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+  assigned_by UUID REFERENCES "users"(user_id) ON DELETE SET NULL,
+  assigned_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (user_id, role)
+);
+
+-- Seed the built-in roles and permissions
+INSERT INTO roles (name, description) VALUES
+  ('user', 'Every account, manages its own data'),
+  ('support', 'Looks up accounts and email delivery to help users'),
+  ('admin', 'Full access to the admin endpoints')
+ON CONFLICT (name) DO UPDATE SET description = EXCLUDED.description;
+
+INSERT INTO permissions (name, description) VALUES
+  ('users:read', 'View user accounts and their roles'),
+  ('users:write', 'Change, disable and sign out user accounts'),
+  ('roles:assign', 'Assign and remove roles'),
+  ('audit_logs:read', 'View the audit log'),
+  ('email_outbox:manage', 'Inspect and retry outgoing emails'),
+  ('service_clients:manage', 'Register and delete service clients')
+ON CONFLICT (name) DO UPDATE SET description = EXCLUDED.description;
+
+INSERT INTO role_permissions (role, permission) VALUES
+  ('support', 'users:read'),
+  ('support', 'audit_logs:read'),
+  ('support', 'email_outbox:manage'),
+  ('admin', 'users:read'),
+  ('admin', 'users:write'),
+  ('admin', 'roles:assign'),
+  ('admin', 'audit_logs:read'),
+  ('admin', 'email_outbox:manage'),
+  ('admin', 'service_clients:manage')
+ON CONFLICT DO NOTHING;
+
+-- Create LOGIN_THROTTLE table: failed password logins per email address, kept for unknown addresses too
+-- so the delays do not reveal which accounts exist
+CREATE TABLE IF NOT EXISTS login_throttles (
+  email VARCHAR(255) PRIMARY KEY,
+  failed_attempts INTEGER NOT NULL DEFAULT 0,
+  last_failed_at TIMESTAMP WITH TIME ZONE,
+  next_attempt_at TIMESTAMP WITH TIME ZONE,
+  locked_until TIMESTAMP WITH TIME ZONE,
+  unlock_token_hash VARCHAR(64) UNIQUE
+);
+
+-- Create RATE_LIMIT_BUCKET table: token buckets of the postgres rate limit store
+CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+  key VARCHAR(255) PRIMARY KEY,
+  tokens DOUBLE PRECISION NOT NULL,
+  updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- Create OAUTH_CLIENT table: third-party applications allowed to request delegated access
+CREATE TABLE IF NOT EXISTS oauth_clients (
+  client_id VARCHAR(64) PRIMARY KEY,
+  client_secret_hash VARCHAR(64), -- SHA-256 of the secret, empty for public clients
+  client_type VARCHAR(20) NOT NULL CHECK (client_type IN ('confidential', 'public')),
+  name VARCHAR(100) NOT NULL,
+  redirect_uris TEXT NOT NULL, -- Space-separated, matched exactly
+  scope TEXT NOT NULL, -- Space-separated scopes the client may request
+  owner_id UUID NOT NULL REFERENCES "users"(user_id) ON DELETE CASCADE,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create OAUTH_AUTHORIZATION_CODE table: codes are single-use and bound to a PKCE challenge
+CREATE TABLE IF NOT EXISTS oauth_authorization_codes (
+  code_id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  code_hash VARCHAR(64) UNIQUE NOT NULL, -- SHA-256 of the code
+  client_id VARCHAR(64) NOT NULL REFERENCES oauth_clients(client_id) ON DELETE CASCADE,
+  user_id UUID NOT NULL REFERENCES "users"(user_id) ON DELETE CASCADE,
+  redirect_uri TEXT NOT NULL,
+  scope TEXT NOT NULL,
+  code_challenge VARCHAR(128) NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  used_at TIMESTAMP WITH TIME ZONE,
+  family_id UUID -- Token family issued for the code, revoked if the code is replayed
+);
+
+-- Create OAUTH_CONSENT table: scopes each user has granted to each client
+CREATE TABLE IF NOT EXISTS oauth_consents (
+  user_id UUID NOT NULL REFERENCES "users"(user_id) ON DELETE CASCADE,
+  client_id VARCHAR(64) NOT NULL REFERENCES oauth_clients(client_id) ON DELETE CASCADE,
+  scope TEXT NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (user_id, client_id)
+);
+
+-- Tokens issued to OAuth clients carry the client and the granted scopes
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS client_id VARCHAR(64) REFERENCES oauth_clients(client_id) ON DELETE CASCADE;
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS scope TEXT NOT NULL DEFAULT '';
+ALTER TABLE auth_tokens ADD COLUMN IF NOT EXISTS client_id VARCHAR(64) REFERENCES oauth_clients(client_id) ON DELETE CASCADE;
+-- OpenID Connect parameters carried from the authorization request to the ID token
+ALTER TABLE oauth_authorization_codes ADD COLUMN IF NOT EXISTS nonce VARCHAR(512) NOT NULL DEFAULT '';
+ALTER TABLE oauth_authorization_codes ADD COLUMN IF NOT EXISTS auth_time TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+-- Create USER_MFA table: the TOTP secret is encrypted with the service encryption key
+CREATE TABLE IF NOT EXISTS user_mfa (
+  user_id UUID PRIMARY KEY REFERENCES "users"(user_id) ON DELETE CASCADE,
+  totp_secret TEXT NOT NULL,
+  enabled BOOLEAN DEFAULT FALSE,
+  enabled_at TIMESTAMP WITH TIME ZONE,
+  last_used_step BIGINT DEFAULT 0, -- Last accepted TOTP time step, prevents code replay
+  failed_attempts INTEGER DEFAULT 0,
+  last_failed_at TIMESTAMP WITH TIME ZONE,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create MFA_RECOVERY_CODE table: codes are single-use and stored as SHA-256 hashes
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  user_id UUID NOT NULL REFERENCES "users"(user_id) ON DELETE CASCADE,
+  code_hash VARCHAR(255) NOT NULL,
+  used_at TIMESTAMP WITH TIME ZONE,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create WEBAUTHN_CREDENTIAL table for passkeys and security keys
+CREATE TABLE IF NOT EXISTS webauthn_credentials (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  user_id UUID NOT NULL REFERENCES "users"(user_id) ON DELETE CASCADE,
+  name VARCHAR(100),
+  credential_id BYTEA UNIQUE NOT NULL, -- Credential ID generated by the authenticator
+  public_key BYTEA NOT NULL, -- COSE-encoded public key
+  attestation_type VARCHAR(50),
+  transports VARCHAR(255),
+  aaguid BYTEA,
+  sign_count BIGINT DEFAULT 0,
+  clone_warning BOOLEAN DEFAULT FALSE,
+  user_verified BOOLEAN DEFAULT FALSE,
+  backup_eligible BOOLEAN DEFAULT FALSE,
+  backup_state BOOLEAN DEFAULT FALSE,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  last_used_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Create WEBAUTHN_SESSION table holding ceremony state between begin and finish
+CREATE TABLE IF NOT EXISTS webauthn_sessions (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  user_id UUID REFERENCES "users"(user_id) ON DELETE CASCADE,
+  ceremony VARCHAR(20) NOT NULL CHECK (ceremony IN ('registration', 'login')),
+  data JSONB NOT NULL,
+  expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- Create EMAIL_OUTBOX table: emails are written here in the same transaction as the change that triggers them
+CREATE TABLE IF NOT EXISTS email_outbox (
+  email_id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  template VARCHAR(50) NOT NULL,
+  sender VARCHAR(255) NOT NULL,
+  recipient VARCHAR(255) NOT NULL,
+  subject VARCHAR(255) NOT NULL,
+  text_body TEXT NOT NULL,
+  html_body TEXT NOT NULL,
+  status VARCHAR(10) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'dead')),
+  attempts INT NOT NULL DEFAULT 0,
+  last_error TEXT NOT NULL DEFAULT '',
+  next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP, -- Also pushed forward while a worker holds the email
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  sent_at TIMESTAMP WITH TIME ZONE
+);
+
 -- Modified schema: Keeping only `id` as the primary key
 CREATE TABLE IF NOT EXISTS categories (
   id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
@@ -123,6 +410,9 @@ CREATE TABLE IF NOT EXISTS audit_logs (
   FOREIGN KEY (user_id) REFERENCES "users"(user_id) ON DELETE SET NULL
 );
 
+-- Admin who performed the action, NULL for actions of the user themselves
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS actor_id UUID REFERENCES "users"(user_id) ON DELETE SET NULL;
+
 -- Create indexes for frequently queried fields if they don’t exist
 CREATE INDEX IF NOT EXISTS idx_expense_user_id ON expenses(user_id);
 CREATE INDEX IF NOT EXISTS idx_expense_date ON expenses(date);
@@ -131,4 +421,17 @@ CREATE INDEX IF NOT EXISTS idx_category_user_id ON categories(user_id);
 CREATE INDEX IF NOT EXISTS idx_notification_user_id ON notifications(user_id);
 CREATE INDEX IF NOT EXISTS idx_receipts_scanned_date ON receipts (scanned_date);
 CREATE INDEX IF NOT EXISTS idx_expenses_receipt_id ON expenses (receipt_id);
-
+CREATE INDEX IF NOT EXISTS idx_auth_tokens_family_id ON auth_tokens (family_id);
+CREATE INDEX IF NOT EXISTS idx_auth_tokens_user_id ON auth_tokens (user_id);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens (family_id);
+CREATE INDEX IF NOT EXISTS idx_webauthn_credentials_user_id ON webauthn_credentials (user_id);
+CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user_id ON mfa_recovery_codes (user_id);
+CREATE INDEX IF NOT EXISTS idx_email_outbox_status_next_attempt ON email_outbox (status, next_attempt_at);
+CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_user_id ON password_reset_tokens (user_id);
+CREATE INDEX IF NOT EXISTS idx_oauth_clients_owner_id ON oauth_clients (owner_id);
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities (user_id);
+CREATE INDEX IF NOT EXISTS idx_personal_access_tokens_user_id ON personal_access_tokens (user_id);
+CREATE INDEX IF NOT EXISTS idx_user_roles_role ON user_roles (role);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_actor_id ON audit_logs (actor_id);
+CREATE INDEX IF NOT EXISTS idx_login_throttles_last_failed_at ON login_throttles (last_failed_at);
+CREATE INDEX IF NOT EXISTS idx_rate_limit_buckets_updated_at ON rate_limit_buckets (updated_at);
@@ -0,0 +1,262 @@
+package common
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Debt-Solvers/BE-auth-service/db"
+	"github.com/Debt-Solvers/BE-auth-service/internal/mailer"
+	"github.com/Debt-Solvers/BE-auth-service/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Defaults of the admin user search
+const (
+	defaultUsersPerPage = 20
+	defaultUserSort     = "created_at"
+)
+
+var (
+	// ErrAccountDisabled is returned when signing in to an account an admin has disabled
+	ErrAccountDisabled = errors.New("this account has been disabled")
+	// ErrPasswordResetRequired is returned when signing in to an account whose password an admin has reset
+	ErrPasswordResetRequired = errors.New("a password reset is required, please check your email")
+	// ErrSelfAdminAction is returned when admins try to disable or delete their own account
+	ErrSelfAdminAction = errors.New("admins cannot disable or delete their own account")
+)
+
+// CheckAccountStatus returns an error if an admin has blocked sign-in to the account
+func CheckAccountStatus(user *models.User) error {
+	if user.DisabledAt != nil {
+		return ErrAccountDisabled
+	}
+	if user.PasswordResetRequired {
+		return ErrPasswordResetRequired
+	}
+	return nil
+}
+
+// checkAccountStatus loads the user and returns an error if an admin has blocked sign-in
+func checkAccountStatus(tx *gorm.DB, userID uuid.UUID) error {
+	var user models.User
+	if err := tx.Select("user_id", "disabled_at", "password_reset_required").Where("user_id = ?", userID).First(&user).Error; err != nil {
+		return err
+	}
+	return CheckAccountStatus(&user)
+}
+
+// SearchUsers returns a page of users whose email or name contains the query, along with the total
+// number of matches
+func SearchUsers(actorID uuid.UUID, search models.AdminUserSearch) ([]models.User, int64, error) {
+	if search.Page == 0 {
+		search.Page = 1
+	}
+	if search.PerPage == 0 {
+		search.PerPage = defaultUsersPerPage
+	}
+	if search.Sort == "" {
+		search.Sort = defaultUserSort
+	}
+	if search.Order == "" {
+		search.Order = "desc"
+	}
+
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	query := DB.Model(&models.User{})
+	if term := strings.TrimSpace(search.Query); term != "" {
+		// Match the term literally, not as a LIKE pattern
+		pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(strings.ToLower(term)) + "%"
+		query = query.Where("LOWER(email) LIKE ? OR LOWER(first_name || ' ' || last_name) LIKE ?", pattern, pattern)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	// Sort and Order are validated against fixed lists by the request binding; user_id keeps pages stable
+	var users []models.User
+	err := query.Order(search.Sort + " " + search.Order).Order("user_id").
+		Offset((search.Page - 1) * search.PerPage).Limit(search.PerPage).
+		Find(&users).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = RecordAdminAudit(DB, actorID, uuid.Nil, "users", "USERS_SEARCHED", nil, map[string]interface{}{
+		"query": search.Query,
+		"page":  search.Page,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+// GetUserForAdmin returns a user and records that an admin looked at the account
+func GetUserForAdmin(actorID, userID uuid.UUID) (*models.User, error) {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	var user models.User
+	if err := DB.Where("user_id = ?", userID).First(&user).Error; err != nil {
+		return nil, err
+	}
+	if err := RecordAdminAudit(DB, actorID, userID, "users", "USER_VIEWED", nil, nil); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// CountActiveSessions returns how many sessions the user has
+func CountActiveSessions(userID uuid.UUID) (int64, error) {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	var count int64
+	err := DB.Model(&models.AuthToken{}).Where("user_id = ? AND expires_at > ?", userID, time.Now()).Count(&count).Error
+	return count, err
+}
+
+// SetUserDisabled disables or enables an account. Disabling also ends all of the user's sessions.
+func SetUserDisabled(actorID, userID uuid.UUID, disabled bool) error {
+	if disabled && actorID == userID {
+		return ErrSelfAdminAction
+	}
+
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Where("user_id = ?", userID).First(&user).Error; err != nil {
+			return err
+		}
+		if (user.DisabledAt != nil) == disabled {
+			return nil // Nothing to change
+		}
+
+		if !disabled {
+			if err := tx.Model(&user).Update("disabled_at", nil).Error; err != nil {
+				return err
+			}
+			return RecordAdminAudit(tx, actorID, userID, "users", "USER_ENABLED", map[string]interface{}{"disabled_at": user.DisabledAt}, nil)
+		}
+
+		now := time.Now()
+		if err := tx.Model(&user).Update("disabled_at", now).Error; err != nil {
+			return err
+		}
+		if err := revokeUserSessions(tx, userID, uuid.Nil); err != nil {
+			return err
+		}
+		return RecordAdminAudit(tx, actorID, userID, "users", "USER_DISABLED", nil, map[string]interface{}{"disabled_at": now})
+	})
+}
+
+// ForcePasswordReset blocks sign-in until the user sets a new password, ends every session and
+// emails the user a reset code
+func ForcePasswordReset(actorID, userID uuid.UUID) error {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Where("user_id = ?", userID).First(&user).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&user).Update("password_reset_required", true).Error; err != nil {
+			return err
+		}
+		if err := revokeUserSessions(tx, userID, uuid.Nil); err != nil {
+			return err
+		}
+
+		code, err := CreatePasswordResetToken(tx, userID)
+		if err != nil {
+			return err
+		}
+		email, err := mailer.PasswordResetEmail(user.Email, code)
+		if err != nil {
+			return err
+		}
+		if err := EnqueueEmail(tx, email); err != nil {
+			return err
+		}
+		return RecordAdminAudit(tx, actorID, userID, "users", "PASSWORD_RESET_FORCED", nil, nil)
+	})
+}
+
+// MarkEmailVerified verifies the user's email address on their behalf
+func MarkEmailVerified(actorID, userID uuid.UUID) error {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Where("user_id = ?", userID).First(&user).Error; err != nil {
+			return err
+		}
+		if user.IsEmailVerified {
+			return nil
+		}
+
+		if err := tx.Model(&user).Update("is_email_verified", true).Error; err != nil {
+			return err
+		}
+		return RecordAdminAudit(tx, actorID, userID, "users", "EMAIL_VERIFIED", nil, map[string]interface{}{"email": user.Email})
+	})
+}
+
+// RevokeAllUserSessions signs the user out everywhere
+func RevokeAllUserSessions(actorID, userID uuid.UUID) error {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Select("user_id").Where("user_id = ?", userID).First(&user).Error; err != nil {
+			return err
+		}
+
+		if err := revokeUserSessions(tx, userID, uuid.Nil); err != nil {
+			return err
+		}
+		return RecordAdminAudit(tx, actorID, userID, "auth_tokens", "SESSIONS_REVOKED", nil, nil)
+	})
+}
+
+// DeleteUser removes an account and everything that cascades from it. The audit entry keeps the
+// user's ID and email, since audit_logs.user_id is cleared when the user row goes.
+func DeleteUser(actorID, userID uuid.UUID) error {
+	if actorID == userID {
+		return ErrSelfAdminAction
+	}
+
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Where("user_id = ?", userID).First(&user).Error; err != nil {
+			return err
+		}
+		if err := ensureNotLastAdmin(tx, userID); err != nil {
+			return err
+		}
+
+		if err := tx.Delete(&user).Error; err != nil {
+			return err
+		}
+		return RecordAdminAudit(tx, actorID, uuid.Nil, "users", "USER_DELETED", map[string]interface{}{
+			"user_id": user.UserID,
+			"email":   user.Email,
+		}, nil)
+	})
+}
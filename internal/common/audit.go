@@ -0,0 +1,54 @@
+package common
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Debt-Solvers/BE-auth-service/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RecordAudit writes an entry to audit_logs. oldData and newData are stored as JSON and may be nil.
+func RecordAudit(tx *gorm.DB, userID uuid.UUID, table, action string, oldData, newData interface{}) error {
+	return recordAudit(tx, nil, &userID, table, action, oldData, newData)
+}
+
+// RecordAdminAudit writes an entry for an action an admin performed on a user's data. userID may be
+// uuid.Nil for actions that touch no single user, such as a search.
+func RecordAdminAudit(tx *gorm.DB, actorID, userID uuid.UUID, table, action string, oldData, newData interface{}) error {
+	var subject *uuid.UUID
+	if userID != uuid.Nil {
+		subject = &userID
+	}
+	return recordAudit(tx, &actorID, subject, table, action, oldData, newData)
+}
+
+func recordAudit(tx *gorm.DB, actorID, userID *uuid.UUID, table, action string, oldData, newData interface{}) error {
+	entry := models.AuditLog{
+		LogID:      uuid.New(),
+		UserID:     userID,
+		ActorID:    actorID,
+		Table:      table,
+		Action:     action,
+		ChangeDate: time.Now(),
+	}
+
+	if oldData != nil {
+		encoded, err := json.Marshal(oldData)
+		if err != nil {
+			return err
+		}
+		entry.OldData = encoded
+	}
+	if newData != nil {
+		encoded, err := json.Marshal(newData)
+		if err != nil {
+			return err
+		}
+		entry.NewData = encoded
+	}
+
+	return tx.Create(&entry).Error
+}
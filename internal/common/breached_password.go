@@ -0,0 +1,91 @@
+package common
+
+import (
+	"crypto/sha1"
+	"log"
+	"time"
+
+	"github.com/Debt-Solvers/BE-auth-service/db"
+	"github.com/Debt-Solvers/BE-auth-service/internal/mailer"
+	"github.com/Debt-Solvers/BE-auth-service/internal/models"
+	"github.com/Debt-Solvers/BE-auth-service/internal/passwordpolicy"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// breachScreeningQueueSize bounds the logins waiting to be screened. Logins beyond it are not
+// screened rather than slowed down, and are screened at a later login.
+const breachScreeningQueueSize = 1024
+
+// breachScreening is a password waiting to be looked up. Only its SHA-1 is kept, and the stored
+// hash it belongs to, so a password changed in the meantime is not flagged.
+type breachScreening struct {
+	userID       uuid.UUID
+	passwordHash string
+	sha1         [sha1.Size]byte
+}
+
+var breachScreeningQueue = make(chan breachScreening, breachScreeningQueueSize)
+
+// ScreenPassword queues the password the user just signed in with to be looked up in the breach
+// dataset, flagging the account if it is found. It never blocks the login.
+func ScreenPassword(user models.User, password string) {
+	if user.PasswordBreachedAt != nil || !passwordpolicy.ScreeningEnabled() {
+		return
+	}
+
+	select {
+	case breachScreeningQueue <- breachScreening{userID: user.UserID, passwordHash: user.PasswordHash, sha1: sha1.Sum([]byte(password))}:
+	default:
+		log.Printf("Breached password screening queue is full, skipping user %s", user.UserID)
+	}
+}
+
+// StartBreachScreening looks up queued passwords in the background until the process exits
+func StartBreachScreening() {
+	go func() {
+		for screening := range breachScreeningQueue {
+			if err := screenPassword(screening); err != nil {
+				log.Printf("Failed to screen the password of user %s: %v", screening.userID, err)
+			}
+		}
+	}()
+}
+
+// screenPassword flags the account and tells the user if the password is breached
+func screenPassword(screening breachScreening) error {
+	breached, err := passwordpolicy.IsBreachedHash(screening.sha1)
+	if err != nil || !breached {
+		return err
+	}
+
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(&models.User{}).
+			Where("user_id = ? AND password_hash = ? AND password_breached_at IS NULL", screening.userID, screening.passwordHash).
+			Update("password_breached_at", now)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		var user models.User
+		if err := tx.Where("user_id = ?", screening.userID).First(&user).Error; err != nil {
+			return err
+		}
+		message := "The password you signed in with has appeared in a data breach, so others may be able to guess it. Change it as soon as you can."
+		email, err := mailer.SecurityAlertEmail(user.Email, "Your password has appeared in a data breach", message)
+		if err != nil {
+			return err
+		}
+		if err := EnqueueEmail(tx, email); err != nil {
+			return err
+		}
+		return RecordAudit(tx, user.UserID, "users", "PASSWORD_BREACH_DETECTED", nil, map[string]interface{}{
+			"password_breached_at": now,
+		})
+	})
+}
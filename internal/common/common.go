@@ -7,7 +7,6 @@ import (
 	"github.com/Debt-Solvers/BE-auth-service/internal/models"
 
 	"github.com/google/uuid"
-	"gorm.io/gorm"
 )
 
 // StoreToken stores the generated token in the database
@@ -31,55 +30,35 @@ func StoreToken(userID uuid.UUID, tokenString string, createdTime time.Time, exp
 	return nil // Return nil if the operation was successful
 }
 
-// StoreResetToken updates the user's reset token and its expiration time in the database
-func StoreResetToken(userID uuid.UUID, tokenString string, expirationTime time.Time) error {
-	// Get the DB instance
-	DB := db.GetDBInstance()
-
-	// Find the user by userID
-	var user models.User
-	if err := DB.First(&user, "user_id = ?", userID).Error; err != nil {
-		return err // Return the error if user is not found
-	}
-
-	// Update the user's reset password token and expiration time
-	user.ResetPasswordToken = tokenString
-	user.ResetPasswordExpires = expirationTime
-
-	// Save the updated user record
-	if err := DB.Save(&user).Error; err != nil {
-		return err // Return the error if there's an issue saving
-	}
-
-	return nil // Return nil if the operation was successful
-}
-
 // Checks if token is valid and in database
 func IsTokenActive(token string) bool {
-	// Get the DB instance
-	db := db.GetDBInstance()
-
-	err := db.Where("token = ?", token).First(&models.AuthToken{}).Error
+	_, err := GetActiveToken(token)
 	return err == nil
 }
 
+// GetActiveToken returns the stored row for an access token
+func GetActiveToken(tokenString string) (*models.AuthToken, error) {
+	// Get the DB instance
+	db := db.GetDBInstance()
 
+	var token models.AuthToken
+	if err := db.Where("token = ?", tokenString).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
 
-// DeleteToken removes the specified token from the database
+// DeleteToken removes the specified token from the database along with the refresh token family it belongs to
 func DeleteToken(tokenString string) error {
 	// Get the DB instance
 	db := db.GetDBInstance()
 
-	// Attempt to delete the token
-	result := db.Where("token = ?", tokenString).Delete(&models.AuthToken{})
-	if result.Error != nil {
-		return result.Error // Return the error if there's an issue
-	}
-	
-	if result.RowsAffected == 0 {
-		return gorm.ErrRecordNotFound // Return a not found error if no rows were affected
+	// Look up the token so its refresh token family can be revoked as well
+	var token models.AuthToken
+	if err := db.Where("token = ?", tokenString).First(&token).Error; err != nil {
+		return err // Returns gorm.ErrRecordNotFound if the token does not exist
 	}
 
-	return nil // Return nil if the operation was successful
+	return RevokeSession(&token)
 }
 
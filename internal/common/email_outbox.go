@@ -0,0 +1,209 @@
+package common
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/Debt-Solvers/BE-auth-service/configs"
+	"github.com/Debt-Solvers/BE-auth-service/db"
+	"github.com/Debt-Solvers/BE-auth-service/internal/mailer"
+	"github.com/Debt-Solvers/BE-auth-service/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// emailClaimLease is how long a claimed email stays invisible to other workers while it is being sent
+const emailClaimLease = 5 * time.Minute
+
+// ErrEmailNotRetryable is returned when retrying an email that is not dead
+var ErrEmailNotRetryable = errors.New("only dead emails can be retried")
+
+// EnqueueEmail writes a message to the outbox. Pass the transaction of the change that triggers the email
+// so the email is only sent if that change commits.
+func EnqueueEmail(tx *gorm.DB, msg mailer.Message) error {
+	now := time.Now()
+	email := models.EmailOutbox{
+		EmailID:       uuid.New(),
+		Template:      msg.Template,
+		Sender:        msg.From,
+		Recipient:     msg.To,
+		Subject:       msg.Subject,
+		TextBody:      msg.Text,
+		HTMLBody:      msg.HTML,
+		Status:        models.EmailStatusPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}
+	return tx.Create(&email).Error
+}
+
+// ListOutboxEmails returns the most recent outbox entries, optionally filtered by status
+func ListOutboxEmails(status string, limit int) ([]models.EmailOutbox, error) {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	query := DB.Order("created_at DESC").Limit(limit)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var emails []models.EmailOutbox
+	if err := query.Find(&emails).Error; err != nil {
+		return nil, err
+	}
+	return emails, nil
+}
+
+// RetryOutboxEmail puts a dead email back in the queue with a fresh set of attempts
+func RetryOutboxEmail(actorID, emailID uuid.UUID) error {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var email models.EmailOutbox
+		if err := tx.Where("email_id = ?", emailID).First(&email).Error; err != nil {
+			return err
+		}
+		if email.Status != models.EmailStatusDead {
+			return ErrEmailNotRetryable
+		}
+
+		if err := tx.Model(&email).Updates(map[string]interface{}{
+			"status":          models.EmailStatusPending,
+			"attempts":        0,
+			"next_attempt_at": time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+		return RecordAdminAudit(tx, actorID, uuid.Nil, "email_outbox", "EMAIL_RETRIED", nil, map[string]interface{}{"email_id": emailID})
+	})
+}
+
+// StartEmailOutboxWorker delivers queued emails in the background until the process exits
+func StartEmailOutboxWorker() {
+	interval := time.Duration(configs.GetConfig().Mail.Outbox.PollSeconds) * time.Second
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			// Keep going while full batches come back so a backlog drains quickly
+			for {
+				delivered, err := DeliverDueEmails()
+				if err != nil {
+					log.Printf("Email outbox: %v", err)
+					break
+				}
+				if delivered < configs.GetConfig().Mail.Outbox.BatchSize {
+					break
+				}
+			}
+		}
+	}()
+}
+
+// DeliverDueEmails claims a batch of due emails and attempts to send each of them.
+// It returns how many emails were claimed.
+func DeliverDueEmails() (int, error) {
+	emails, err := claimDueEmails(configs.GetConfig().Mail.Outbox.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range emails {
+		if err := deliverEmail(&emails[i]); err != nil {
+			log.Printf("Email outbox: could not record delivery of %s: %v", emails[i].EmailID, err)
+		}
+	}
+	return len(emails), nil
+}
+
+// claimDueEmails locks due emails and pushes their next attempt past the lease, so concurrent
+// workers skip them and a crashed worker's emails are picked up again later
+func claimDueEmails(limit int) ([]models.EmailOutbox, error) {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	var emails []models.EmailOutbox
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", models.EmailStatusPending, now).
+			Order("next_attempt_at").
+			Limit(limit).
+			Find(&emails).Error; err != nil {
+			return err
+		}
+		if len(emails) == 0 {
+			return nil
+		}
+
+		emailIDs := make([]uuid.UUID, 0, len(emails))
+		for _, email := range emails {
+			emailIDs = append(emailIDs, email.EmailID)
+		}
+		return tx.Model(&models.EmailOutbox{}).
+			Where("email_id IN ?", emailIDs).
+			Update("next_attempt_at", now.Add(emailClaimLease)).Error
+	})
+	return emails, err
+}
+
+// deliverEmail sends one claimed email and records the outcome
+func deliverEmail(email *models.EmailOutbox) error {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	sendErr := mailer.Send(mailer.Message{
+		Template: email.Template,
+		From:     email.Sender,
+		To:       email.Recipient,
+		Subject:  email.Subject,
+		Text:     email.TextBody,
+		HTML:     email.HTMLBody,
+	})
+
+	now := time.Now()
+	attempts := email.Attempts + 1
+	if sendErr == nil {
+		// The bodies carry verification links and reset codes, so they are not kept once delivered
+		return DB.Model(email).Updates(map[string]interface{}{
+			"status":     models.EmailStatusSent,
+			"attempts":   attempts,
+			"last_error": "",
+			"sent_at":    now,
+			"text_body":  "",
+			"html_body":  "",
+		}).Error
+	}
+
+	updates := map[string]interface{}{
+		"attempts":        attempts,
+		"last_error":      sendErr.Error(),
+		"next_attempt_at": now.Add(emailBackoff(attempts)),
+	}
+	if attempts >= configs.GetConfig().Mail.Outbox.MaxAttempts {
+		updates["status"] = models.EmailStatusDead
+		log.Printf("Email outbox: giving up on %s to %s after %d attempts: %v", email.EmailID, email.Recipient, attempts, sendErr)
+	}
+	return DB.Model(email).Updates(updates).Error
+}
+
+// emailBackoff returns the delay before the next attempt, doubling with every failure up to the configured maximum
+func emailBackoff(attempts int) time.Duration {
+	config := configs.GetConfig().Mail.Outbox
+
+	maxBackoff := time.Duration(config.MaxBackoffMinutes) * time.Minute
+	backoff := time.Duration(config.BackoffSeconds) * time.Second
+	for i := 1; i < attempts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return backoff
+}
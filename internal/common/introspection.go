@@ -0,0 +1,200 @@
+package common
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Debt-Solvers/BE-auth-service/configs"
+	"github.com/Debt-Solvers/BE-auth-service/db"
+	"github.com/Debt-Solvers/BE-auth-service/internal/models"
+	"github.com/Debt-Solvers/BE-auth-service/utils"
+
+	"gorm.io/gorm"
+)
+
+// Token type hints from RFC 7009 section 4.1.2, also used by introspection
+const (
+	TokenTypeHintAccessToken  = "access_token"
+	TokenTypeHintRefreshToken = "refresh_token"
+)
+
+// TokenIntrospection describes an active token (RFC 7662 section 2.2)
+type TokenIntrospection struct {
+	Subject   string // The user, or the client for service tokens
+	ClientID  string // Empty for tokens of the first-party apps
+	Scope     string // Empty for first-party tokens, which are not limited by scope unless EmailVerified is false
+	TokenType string // "Bearer" for access tokens, "refresh_token" for refresh tokens
+	IssuedAt  time.Time
+	ExpiresAt time.Time // Zero for personal access tokens that do not expire
+	Audience  []string  // Services a service token is for, empty for other tokens
+	// Whether the user's email address was verified, nil for service tokens. A token of an unverified
+	// account may only log out, read the profile and manage sessions, whatever its scope.
+	EmailVerified *bool
+}
+
+// IsTrustedOAuthClient reports whether the client is one of our own back-office services listed in the configuration
+func IsTrustedOAuthClient(clientID string) bool {
+	for _, trusted := range configs.GetConfig().OAuth.TrustedClients {
+		if strings.TrimSpace(trusted) == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+// IntrospectToken looks up an access or refresh token and returns nil if it is not active.
+// The hint only decides which kind of token is tried first.
+func IntrospectToken(token, tokenTypeHint string) (*TokenIntrospection, error) {
+	// Personal access tokens are recognised by their prefix and checksum, whatever the hint says
+	if utils.IsPersonalAccessToken(token) {
+		return introspectPersonalAccessToken(token)
+	}
+
+	lookups := []func(string) (*TokenIntrospection, error){introspectAccessToken, introspectRefreshToken, introspectServiceToken}
+	if tokenTypeHint == TokenTypeHintRefreshToken {
+		lookups[0], lookups[1] = lookups[1], lookups[0]
+	}
+
+	for _, lookup := range lookups {
+		introspection, err := lookup(token)
+		if err != nil || introspection != nil {
+			return introspection, err
+		}
+	}
+	return nil, nil
+}
+
+// introspectAccessToken checks the signature and expiry of an access token and that its session still exists
+func introspectAccessToken(token string) (*TokenIntrospection, error) {
+	userID, claims, err := utils.VerifyTokenClaims(token)
+	if err != nil {
+		return nil, nil
+	}
+
+	// A logged out or revoked session no longer has its row
+	session, err := GetActiveToken(token)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	introspection := &TokenIntrospection{
+		Subject:   userID.String(),
+		TokenType: "Bearer",
+		IssuedAt:  session.CreatedAt,
+		ExpiresAt: session.ExpiresAt,
+	}
+	if exp, ok := claims["exp"].(float64); ok {
+		introspection.ExpiresAt = time.Unix(int64(exp), 0)
+	}
+	if iat, ok := claims["iat"].(float64); ok {
+		introspection.IssuedAt = time.Unix(int64(iat), 0)
+	}
+	introspection.ClientID, _ = claims["client_id"].(string)
+	introspection.Scope, _ = claims["scope"].(string)
+	// Tokens issued before the email address was verified carry email_verified=false, as the auth middleware reads it
+	emailVerified, ok := claims["email_verified"].(bool)
+	introspection.EmailVerified = boolPointer(!ok || emailVerified)
+	return introspection, nil
+}
+
+// introspectServiceToken checks a client credentials token and that its client has not been deleted
+func introspectServiceToken(token string) (*TokenIntrospection, error) {
+	claims, err := utils.VerifyServiceToken(token)
+	if err != nil {
+		return nil, nil
+	}
+
+	clientID, _ := claims["client_id"].(string)
+	if _, err := GetServiceClient(clientID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	audience, err := claims.GetAudience()
+	if err != nil {
+		return nil, nil
+	}
+	introspection := &TokenIntrospection{
+		Subject:   clientID,
+		ClientID:  clientID,
+		TokenType: "Bearer",
+		Audience:  audience,
+	}
+	introspection.Scope, _ = claims["scope"].(string)
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		introspection.ExpiresAt = exp.Time
+	}
+	if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+		introspection.IssuedAt = iat.Time
+	}
+	return introspection, nil
+}
+
+// introspectRefreshToken finds a refresh token that has not been rotated, revoked or expired
+func introspectRefreshToken(token string) (*TokenIntrospection, error) {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	var refreshToken models.RefreshToken
+	err := DB.Where("token_hash = ? AND rotated_at IS NULL AND revoked_at IS NULL AND expires_at > ?", utils.HashToken(token), time.Now()).
+		First(&refreshToken).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	introspection := &TokenIntrospection{
+		Subject:   refreshToken.UserID.String(),
+		Scope:     refreshToken.Scope,
+		TokenType: TokenTypeHintRefreshToken,
+		IssuedAt:  refreshToken.CreatedAt,
+		ExpiresAt: refreshToken.ExpiresAt,
+	}
+	if refreshToken.ClientID != nil {
+		introspection.ClientID = *refreshToken.ClientID
+	}
+
+	// The next access token is issued with the account's current verification state
+	var owner models.User
+	if err := DB.Select("user_id", "is_email_verified").Where("user_id = ?", refreshToken.UserID).First(&owner).Error; err != nil {
+		return nil, err
+	}
+	introspection.EmailVerified = boolPointer(owner.IsEmailVerified)
+	return introspection, nil
+}
+
+// introspectPersonalAccessToken finds a personal access token that has not been deleted or expired
+func introspectPersonalAccessToken(token string) (*TokenIntrospection, error) {
+	pat, owner, err := findPersonalAccessToken(token)
+	if errors.Is(err, ErrInvalidPersonalAccessToken) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	introspection := &TokenIntrospection{
+		Subject:       pat.UserID.String(),
+		Scope:         pat.Scope,
+		TokenType:     "Bearer",
+		IssuedAt:      pat.CreatedAt,
+		EmailVerified: boolPointer(owner.IsEmailVerified),
+	}
+	if pat.ExpiresAt != nil {
+		introspection.ExpiresAt = *pat.ExpiresAt
+	}
+	return introspection, nil
+}
+
+// boolPointer returns a pointer to a copy of b
+func boolPointer(b bool) *bool {
+	return &b
+}
@@ -0,0 +1,273 @@
+package common
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Debt-Solvers/BE-auth-service/configs"
+	"github.com/Debt-Solvers/BE-auth-service/db"
+	"github.com/Debt-Solvers/BE-auth-service/internal/mailer"
+	"github.com/Debt-Solvers/BE-auth-service/internal/models"
+	"github.com/Debt-Solvers/BE-auth-service/utils"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// unlockTokenBytes is the entropy of the token in an unlock link
+const unlockTokenBytes = 32
+
+// loginThrottleCleanupInterval is how often forgotten failures are deleted
+const loginThrottleCleanupInterval = time.Hour
+
+// ErrInvalidUnlockToken is returned for an unlock link that is unknown or was already used
+var ErrInvalidUnlockToken = errors.New("invalid or expired unlock link")
+
+// loginThrottleKey normalizes an email address the way login_throttles stores it. Addresses no
+// account could have are cut to the column size rather than rejected, so they are throttled alike.
+func loginThrottleKey(email string) string {
+	key := []rune(strings.ToLower(strings.TrimSpace(email)))
+	if len(key) > 255 {
+		key = key[:255]
+	}
+	return string(key)
+}
+
+// loginDelay returns how long an address must wait after its nth consecutive failure
+func loginDelay(failures int) time.Duration {
+	config := configs.GetConfig().LoginThrottle
+	if failures <= config.FreeAttempts {
+		return 0
+	}
+
+	maxDelay := time.Duration(config.MaxDelaySeconds) * time.Second
+	delay := time.Duration(config.DelaySeconds) * time.Second
+	for n := failures - config.FreeAttempts; n > 1 && delay < maxDelay; n-- {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		return maxDelay
+	}
+	return delay
+}
+
+// ReserveLoginAttempt decides whether the email address may have a password checked now. It returns
+// how long the address has to wait, or zero once the attempt is reserved: the attempt is counted as a
+// failure before the password is checked, with the row locked, so a burst of parallel guesses is
+// throttled one after the other instead of all passing before any failure is written. Call
+// ClearLoginFailures when the password is right and ReleaseLoginAttempt when it was never checked.
+// Past login_throttle.free_attempts failures the address has to wait before its next attempt, and at
+// login_throttle.lockout_attempts it is locked; the owner of an account using the address is then
+// emailed an unlock link. Unknown addresses are throttled the same way as accounts.
+func ReserveLoginAttempt(email string) (time.Duration, error) {
+	config := configs.GetConfig().LoginThrottle
+	key := loginThrottleKey(email)
+
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	var retryAfter time.Duration
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		throttle, err := lockLoginThrottle(tx, key)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		window := time.Duration(config.WindowMinutes) * time.Minute
+		lockExpired := throttle.LockedUntil != nil && !throttle.LockedUntil.After(now)
+		if lockExpired || (throttle.LastFailedAt != nil && now.Sub(*throttle.LastFailedAt) > window) {
+			throttle = models.LoginThrottle{Email: key}
+		}
+
+		switch {
+		case throttle.LockedUntil != nil:
+			retryAfter = throttle.LockedUntil.Sub(now)
+			return nil
+		case throttle.NextAttemptAt != nil && throttle.NextAttemptAt.After(now):
+			retryAfter = throttle.NextAttemptAt.Sub(now)
+			return nil
+		case throttle.FailedAttempts >= config.LockoutAttempts:
+			if err := lockLogin(tx, &throttle, now); err != nil {
+				return err
+			}
+			retryAfter = throttle.LockedUntil.Sub(now)
+			return tx.Save(&throttle).Error
+		}
+
+		throttle.FailedAttempts++
+		throttle.LastFailedAt = &now
+		throttle.NextAttemptAt = nil
+		if delay := loginDelay(throttle.FailedAttempts); delay > 0 {
+			nextAttempt := now.Add(delay)
+			throttle.NextAttemptAt = &nextAttempt
+		}
+		return tx.Save(&throttle).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return retryAfter, nil
+}
+
+// ReleaseLoginAttempt takes back an attempt reserved by ReserveLoginAttempt whose password was never
+// checked, for example because every password hashing slot was busy
+func ReleaseLoginAttempt(email string) error {
+	key := loginThrottleKey(email)
+
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		throttle, err := lockLoginThrottle(tx, key)
+		if err != nil {
+			return err
+		}
+		if throttle.FailedAttempts == 0 || throttle.LockedUntil != nil {
+			return nil
+		}
+
+		throttle.FailedAttempts--
+		if loginDelay(throttle.FailedAttempts) == 0 {
+			throttle.NextAttemptAt = nil
+		}
+		return tx.Save(&throttle).Error
+	})
+}
+
+// lockLoginThrottle creates the address's row if needed and locks it, so attempts on every replica are
+// counted one after the other
+func lockLoginThrottle(tx *gorm.DB, key string) (models.LoginThrottle, error) {
+	var throttle models.LoginThrottle
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.LoginThrottle{Email: key}).Error; err != nil {
+		return throttle, err
+	}
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("email = ?", key).First(&throttle).Error
+	return throttle, err
+}
+
+// lockLogin locks the address and, if an account uses it, emails the owner an unlock link
+func lockLogin(tx *gorm.DB, throttle *models.LoginThrottle, now time.Time) error {
+	lockedUntil := now.Add(time.Duration(configs.GetConfig().LoginThrottle.LockoutMinutes) * time.Minute)
+	throttle.LockedUntil = &lockedUntil
+
+	var user models.User
+	err := tx.Where("email = ?", throttle.Email).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	unlockToken, err := utils.GenerateOpaqueToken(unlockTokenBytes)
+	if err != nil {
+		return err
+	}
+	tokenHash := utils.HashToken(unlockToken)
+	throttle.UnlockTokenHash = &tokenHash
+
+	email, err := mailer.LoginUnlockEmail(user.Email, unlockToken)
+	if err != nil {
+		return err
+	}
+	if err := EnqueueEmail(tx, email); err != nil {
+		return err
+	}
+	return RecordAudit(tx, user.UserID, "login_throttles", "LOGIN_LOCKED", nil, map[string]interface{}{
+		"failed_attempts": throttle.FailedAttempts,
+		"locked_until":    lockedUntil,
+	})
+}
+
+// ClearLoginFailures forgets the failures of an address after a successful login, including the
+// attempt reserved for it
+func ClearLoginFailures(email string) error {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	return DB.Where("email = ?", loginThrottleKey(email)).Delete(&models.LoginThrottle{}).Error
+}
+
+// UnlockLoginWithToken lifts the lock named by the link in the unlock email
+func UnlockLoginWithToken(unlockToken string) error {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var throttle models.LoginThrottle
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("unlock_token_hash = ?", utils.HashToken(unlockToken)).First(&throttle).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidUnlockToken
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Delete(&throttle).Error; err != nil {
+			return err
+		}
+
+		var user models.User
+		if err := tx.Select("user_id").Where("email = ?", throttle.Email).First(&user).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+		return RecordAudit(tx, user.UserID, "login_throttles", "LOGIN_UNLOCKED", nil, nil)
+	})
+}
+
+// UnlockLogin lets an admin lift the lock and forget the failed logins of a user's email address
+func UnlockLogin(actorID, userID uuid.UUID) error {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Select("user_id", "email").Where("user_id = ?", userID).First(&user).Error; err != nil {
+			return err
+		}
+
+		var throttle models.LoginThrottle
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("email = ?", loginThrottleKey(user.Email)).First(&throttle).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil // Nothing to unlock
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Delete(&throttle).Error; err != nil {
+			return err
+		}
+		return RecordAdminAudit(tx, actorID, userID, "login_throttles", "LOGIN_UNLOCKED", map[string]interface{}{
+			"failed_attempts": throttle.FailedAttempts,
+			"locked_until":    throttle.LockedUntil,
+		}, nil)
+	})
+}
+
+// StartLoginThrottleCleanup deletes forgotten failures in the background until the process exits.
+// Failures of unknown addresses are kept too, so without this the table would only grow.
+func StartLoginThrottleCleanup() {
+	go func() {
+		ticker := time.NewTicker(loginThrottleCleanupInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			now := time.Now()
+			window := time.Duration(configs.GetConfig().LoginThrottle.WindowMinutes) * time.Minute
+			err := db.GetDBInstance().
+				Where("last_failed_at < ? AND (locked_until IS NULL OR locked_until < ?)", now.Add(-window), now).
+				Delete(&models.LoginThrottle{}).Error
+			if err != nil {
+				log.Printf("Failed to clean up login throttles: %v", err)
+			}
+		}
+	}()
+}
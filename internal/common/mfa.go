@@ -0,0 +1,215 @@
+package common
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Debt-Solvers/BE-auth-service/configs"
+	"github.com/Debt-Solvers/BE-auth-service/db"
+	"github.com/Debt-Solvers/BE-auth-service/internal/models"
+	"github.com/Debt-Solvers/BE-auth-service/utils"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrMFANotEnabled is returned when a second factor is required but the user has none
+	ErrMFANotEnabled = errors.New("multi-factor authentication is not enabled")
+	// ErrMFAAlreadyEnabled is returned when enrolling a user who already has an active second factor
+	ErrMFAAlreadyEnabled = errors.New("multi-factor authentication is already enabled")
+	// ErrInvalidMFACode is returned for wrong, expired or replayed codes
+	ErrInvalidMFACode = errors.New("invalid verification code")
+	// ErrTooManyMFAAttempts is returned while second-factor verification is paused after repeated failures
+	ErrTooManyMFAAttempts = errors.New("too many failed verification codes, try again later")
+)
+
+// GetUserMFA returns the user's TOTP enrollment, active or pending
+func GetUserMFA(userID uuid.UUID) (*models.UserMFA, error) {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	var mfa models.UserMFA
+	if err := DB.Where("user_id = ?", userID).First(&mfa).Error; err != nil {
+		return nil, err
+	}
+	return &mfa, nil
+}
+
+// IsMFAEnabled reports whether the user must pass a second factor at login
+func IsMFAEnabled(userID uuid.UUID) (bool, error) {
+	mfa, err := GetUserMFA(userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return mfa.Enabled, nil
+}
+
+// StartTOTPEnrollment creates a new pending TOTP secret for the user and returns it.
+// Enrolling again before verification replaces the pending secret.
+func StartTOTPEnrollment(userID uuid.UUID) (string, error) {
+	existing, err := GetUserMFA(userID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", err
+	}
+	if existing != nil && existing.Enabled {
+		return "", ErrMFAAlreadyEnabled
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return "", err
+	}
+	encryptedSecret, err := utils.EncryptSecret([]byte(secret))
+	if err != nil {
+		return "", err
+	}
+
+	mfa := models.UserMFA{
+		UserID:     userID,
+		TOTPSecret: encryptedSecret,
+		Enabled:    false,
+		CreatedAt:  time.Now(),
+	}
+
+	// Get the DB instance
+	DB := db.GetDBInstance()
+	if err := DB.Save(&mfa).Error; err != nil {
+		return "", err
+	}
+
+	return secret, nil
+}
+
+// ActivateTOTP turns on a pending enrollment once the user proves their authenticator produces valid codes
+func ActivateTOTP(userID uuid.UUID, code string) error {
+	mfa, err := GetUserMFA(userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrMFANotEnabled
+	}
+	if err != nil {
+		return err
+	}
+	if mfa.Enabled {
+		return ErrMFAAlreadyEnabled
+	}
+
+	if err := VerifyTOTPCode(mfa, code); err != nil {
+		return err
+	}
+
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	now := time.Now()
+	return DB.Model(mfa).Updates(map[string]interface{}{"enabled": true, "enabled_at": now}).Error
+}
+
+// DisableTOTP removes the user's second factor together with its recovery codes
+func DisableTOTP(userID uuid.UUID) error {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.UserMFA{}).Error; err != nil {
+			return err
+		}
+		return RecordAudit(tx, userID, "user_mfa", "TOTP_DISABLED", nil, nil)
+	})
+}
+
+// VerifyTOTPCode checks a code against the user's secret. Each time step is accepted only once,
+// and verification pauses after too many consecutive failures.
+func VerifyTOTPCode(mfa *models.UserMFA, code string) error {
+	return verifySecondFactor(mfa, func(tx *gorm.DB, locked *models.UserMFA) (bool, error) {
+		secret, err := utils.DecryptSecret(locked.TOTPSecret)
+		if err != nil {
+			return false, err
+		}
+
+		step, ok := utils.ValidateTOTP(string(secret), code, time.Now())
+		if !ok || step <= locked.LastUsedStep {
+			return false, nil
+		}
+
+		locked.LastUsedStep = step
+		locked.FailedAttempts = 0
+		return true, tx.Model(locked).Updates(map[string]interface{}{"last_used_step": step, "failed_attempts": 0}).Error
+	})
+}
+
+// verifySecondFactor runs check with the user's MFA row locked, so concurrent attempts are counted one
+// after the other and cannot slip past the lockout together. check reports whether the code matched and
+// resets the failure count when it did. Wrong codes return ErrInvalidMFACode once the failure is committed.
+func verifySecondFactor(mfa *models.UserMFA, check func(tx *gorm.DB, locked *models.UserMFA) (bool, error)) error {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	var verifyErr error
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var locked models.UserMFA
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", mfa.UserID).First(&locked).Error; err != nil {
+			return err
+		}
+
+		if err := checkMFALockout(&locked); err != nil {
+			verifyErr = err
+			return nil
+		}
+
+		ok, err := check(tx, &locked)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			verifyErr = ErrInvalidMFACode
+			if err := recordMFAFailure(tx, &locked); err != nil {
+				return err
+			}
+		}
+
+		*mfa = locked
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return verifyErr
+}
+
+// checkMFALockout rejects second-factor attempts while verification is paused
+func checkMFALockout(mfa *models.UserMFA) error {
+	config := configs.GetConfig()
+
+	lockout := time.Duration(config.MFA.LockoutMinutes) * time.Minute
+	if mfa.FailedAttempts >= config.MFA.MaxFailedCodes && mfa.LastFailedAt != nil && time.Since(*mfa.LastFailedAt) < lockout {
+		return ErrTooManyMFAAttempts
+	}
+	return nil
+}
+
+// recordMFAFailure counts a failed second-factor attempt on the locked MFA row
+func recordMFAFailure(tx *gorm.DB, mfa *models.UserMFA) error {
+	lockout := time.Duration(configs.GetConfig().MFA.LockoutMinutes) * time.Minute
+
+	now := time.Now()
+	failedAttempts := mfa.FailedAttempts + 1
+	// Start counting again once an earlier pause has run out
+	if mfa.LastFailedAt != nil && time.Since(*mfa.LastFailedAt) >= lockout {
+		failedAttempts = 1
+	}
+	if err := tx.Model(mfa).Updates(map[string]interface{}{"failed_attempts": failedAttempts, "last_failed_at": now}).Error; err != nil {
+		return err
+	}
+
+	mfa.FailedAttempts = failedAttempts
+	mfa.LastFailedAt = &now
+	return nil
+}
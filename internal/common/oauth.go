@@ -0,0 +1,337 @@
+package common
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Debt-Solvers/BE-auth-service/configs"
+	"github.com/Debt-Solvers/BE-auth-service/db"
+	"github.com/Debt-Solvers/BE-auth-service/internal/models"
+	"github.com/Debt-Solvers/BE-auth-service/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// authorizationCodeBytes is the amount of entropy in an authorization code
+const authorizationCodeBytes = 32
+
+// ErrInvalidGrant is returned for authorization codes that are unknown, expired, already used,
+// issued to another client or redirect URI, or whose PKCE verifier does not match
+var ErrInvalidGrant = errors.New("invalid authorization grant")
+
+// pkcePattern matches PKCE verifiers and S256 challenges (RFC 7636 section 4.1)
+var pkcePattern = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+// ValidCodeChallenge reports whether a PKCE S256 challenge is well formed
+func ValidCodeChallenge(challenge string) bool {
+	return pkcePattern.MatchString(challenge)
+}
+
+// verifyCodeVerifier checks a PKCE verifier against the S256 challenge sent with the authorization request
+func verifyCodeVerifier(challenge, verifier string) bool {
+	if !pkcePattern.MatchString(verifier) {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// ResolveRedirectURI returns the redirect URI to use for the client. The requested URI must match a
+// registered one exactly; it may be omitted if the client has registered a single URI.
+func ResolveRedirectURI(client *models.OAuthClient, requested string) (string, bool) {
+	registered := client.RedirectURIList()
+	if requested == "" {
+		if len(registered) == 1 {
+			return registered[0], true
+		}
+		return "", false
+	}
+	for _, uri := range registered {
+		if uri == requested {
+			return uri, true
+		}
+	}
+	return "", false
+}
+
+// CreateAuthorizationCode issues a single-use code for the client and returns it
+func CreateAuthorizationCode(client *models.OAuthClient, userID uuid.UUID, redirectURI, scope, codeChallenge, nonce string) (string, error) {
+	code, err := utils.GenerateOpaqueToken(authorizationCodeBytes)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	authorizationCode := models.OAuthAuthorizationCode{
+		CodeID:        uuid.New(),
+		CodeHash:      utils.HashToken(code),
+		ClientID:      client.ClientID,
+		UserID:        userID,
+		RedirectURI:   redirectURI,
+		Scope:         scope,
+		CodeChallenge: codeChallenge,
+		Nonce:         nonce,
+		AuthTime:      now, // The consent form always asks for credentials
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(time.Duration(configs.GetConfig().OAuth.CodeMinutes) * time.Minute),
+	}
+
+	// Get the DB instance
+	DB := db.GetDBInstance()
+	if err := DB.Create(&authorizationCode).Error; err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// RedeemAuthorizationCode uses up an authorization code and returns it with the token family the
+// client's tokens must be issued in. A replayed code revokes the tokens issued the first time.
+func RedeemAuthorizationCode(client *models.OAuthClient, code, redirectURI, codeVerifier string) (*models.OAuthAuthorizationCode, error) {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	var authorizationCode models.OAuthAuthorizationCode
+	replayed := false
+
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("code_hash = ?", utils.HashToken(code)).
+			First(&authorizationCode).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidGrant
+			}
+			return err
+		}
+
+		if authorizationCode.ClientID != client.ClientID {
+			return ErrInvalidGrant
+		}
+
+		// RFC 6749 section 4.1.2: a code used twice revokes what it was exchanged for
+		if authorizationCode.UsedAt != nil {
+			replayed = true
+			if authorizationCode.FamilyID != nil {
+				return revokeTokenFamily(tx, *authorizationCode.FamilyID)
+			}
+			return nil
+		}
+
+		if authorizationCode.ExpiresAt.Before(time.Now()) ||
+			authorizationCode.RedirectURI != redirectURI ||
+			!verifyCodeVerifier(authorizationCode.CodeChallenge, codeVerifier) {
+			return ErrInvalidGrant
+		}
+
+		familyID := uuid.New()
+		now := time.Now()
+		authorizationCode.UsedAt = &now
+		authorizationCode.FamilyID = &familyID
+		return tx.Model(&authorizationCode).Updates(map[string]interface{}{"used_at": now, "family_id": familyID}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if replayed {
+		log.Printf("Authorization code replayed by client %s, revoked the tokens issued for it", client.ClientID)
+		return nil, ErrInvalidGrant
+	}
+	return &authorizationCode, nil
+}
+
+// OAuthTokens is the result of a successful token request
+type OAuthTokens struct {
+	AccessToken  string
+	RefreshToken string // Empty unless offline_access was granted
+	IDToken      string // Empty unless openid was granted
+	Scope        string
+	ExpiresIn    int
+}
+
+// IssueOAuthTokens starts a session for the client in the token family of a redeemed authorization code.
+// A refresh token is only issued when the grant includes offline_access, an ID token when it includes openid.
+func IssueOAuthTokens(client *models.OAuthClient, authorizationCode *models.OAuthAuthorizationCode, userAgent, ipAddress string) (*OAuthTokens, error) {
+	userID, familyID, scope := authorizationCode.UserID, *authorizationCode.FamilyID, authorizationCode.Scope
+
+	var idToken string
+	if ScopeIncludes(scope, []string{ScopeOpenID}) {
+		var err error
+		if idToken, err = issueIDToken(client, authorizationCode); err != nil {
+			return nil, err
+		}
+	}
+
+	var tokens *OAuthTokens
+
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		tokens, err = storeOAuthAccessToken(tx, userID, client, familyID, scope, userAgent, ipAddress)
+		if err != nil {
+			return err
+		}
+
+		if ScopeIncludes(scope, []string{ScopeOfflineAccess}) {
+			tokens.RefreshToken, err = CreateClientRefreshToken(tx, userID, familyID, &client.ClientID, scope)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tokens.IDToken = idToken
+	return tokens, nil
+}
+
+// RefreshOAuthTokens exchanges a client's refresh token for a new access token and refresh token.
+// The access token can be limited to a subset of the granted scopes. The access token is issued in the
+// rotation's transaction, so a request that fails leaves the presented refresh token usable.
+func RefreshOAuthTokens(client *models.OAuthClient, refreshTokenString, scope, userAgent, ipAddress string) (*OAuthTokens, error) {
+	var requested []string
+	if scope != "" {
+		var err error
+		if requested, err = ParseScope(scope); err != nil {
+			return nil, ErrInvalidScope
+		}
+	}
+
+	var tokens *OAuthTokens
+	_, newRefreshToken, err := RotateRefreshToken(refreshTokenString, client.ClientID, func(tx *gorm.DB, refreshToken *models.RefreshToken) error {
+		accessScope := refreshToken.Scope
+		if requested != nil {
+			if !ScopeIncludes(refreshToken.Scope, requested) {
+				return ErrInvalidScope
+			}
+			accessScope = strings.Join(requested, " ")
+		}
+
+		var err error
+		tokens, err = storeOAuthAccessToken(tx, refreshToken.UserID, client, refreshToken.FamilyID, accessScope, userAgent, ipAddress)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	tokens.RefreshToken = newRefreshToken
+	return tokens, nil
+}
+
+// storeOAuthAccessToken signs a scoped access token for the client and records it as the family's session
+func storeOAuthAccessToken(tx *gorm.DB, userID uuid.UUID, client *models.OAuthClient, familyID uuid.UUID, scope, userAgent, ipAddress string) (*OAuthTokens, error) {
+	if err := checkAccountStatus(tx, userID); err != nil {
+		return nil, err
+	}
+
+	accessToken, err := utils.GenerateTokenWithClaims(userID, jwt.MapClaims{
+		"scope":     scope,
+		"client_id": client.ClientID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := models.AuthToken{
+		TokenID:    uuid.New(),
+		UserID:     userID,
+		FamilyID:   &familyID,
+		Token:      accessToken,
+		DeviceName: client.Name,
+		UserAgent:  userAgent,
+		IPAddress:  ipAddress,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(utils.AccessTokenTTL()),
+		LastUsedAt: &now,
+		ClientID:   &client.ClientID,
+	}
+	if err := StoreFamilyToken(tx, &session); err != nil {
+		return nil, err
+	}
+
+	return &OAuthTokens{
+		AccessToken: accessToken,
+		Scope:       scope,
+		ExpiresIn:   int(utils.AccessTokenTTL().Seconds()),
+	}, nil
+}
+
+// GrantOAuthConsent adds scopes to what the user has granted the client
+func GrantOAuthConsent(userID uuid.UUID, clientID string, scopes []string) error {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var consent models.OAuthConsent
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND client_id = ?", userID, clientID).
+			First(&consent).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		granted := strings.Fields(consent.Scope)
+		for _, scope := range scopes {
+			if !ScopeIncludes(consent.Scope, []string{scope}) {
+				granted = append(granted, scope)
+			}
+		}
+
+		now := time.Now()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return tx.Create(&models.OAuthConsent{
+				UserID:    userID,
+				ClientID:  clientID,
+				Scope:     strings.Join(granted, " "),
+				CreatedAt: now,
+				UpdatedAt: now,
+			}).Error
+		}
+		return tx.Model(&consent).Updates(map[string]interface{}{"scope": strings.Join(granted, " "), "updated_at": now}).Error
+	})
+}
+
+// ListOAuthConsents returns the clients the user has granted access to
+func ListOAuthConsents(userID uuid.UUID) ([]models.OAuthConsent, error) {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	var consents []models.OAuthConsent
+	err := DB.Where("user_id = ?", userID).Order("updated_at DESC").Find(&consents).Error
+	return consents, err
+}
+
+// RevokeOAuthConsent withdraws the user's consent for a client and ends every session the client holds
+func RevokeOAuthConsent(userID uuid.UUID, clientID string) error {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("user_id = ? AND client_id = ?", userID, clientID).Delete(&models.OAuthConsent{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		if err := tx.Model(&models.RefreshToken{}).
+			Where("user_id = ? AND client_id = ? AND revoked_at IS NULL", userID, clientID).
+			Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ? AND client_id = ?", userID, clientID).Delete(&models.AuthToken{}).Error
+	})
+}
@@ -0,0 +1,222 @@
+package common
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Debt-Solvers/BE-auth-service/db"
+	"github.com/Debt-Solvers/BE-auth-service/internal/models"
+	"github.com/Debt-Solvers/BE-auth-service/utils"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// OAuth scopes that clients can request
+const (
+	ScopeOpenID        = "openid"         // Sign in with OpenID Connect and receive an ID token
+	ScopeProfile       = "profile"        // Read the user's name and email
+	ScopeEmail         = "email"          // Read the user's email address
+	ScopeExpensesRead  = "expenses:read"  // Read expenses
+	ScopeExpensesWrite = "expenses:write" // Create and change expenses
+	ScopeReceiptsRead  = "receipts:read"  // Read scanned receipts
+	ScopeReceiptsWrite = "receipts:write" // Upload and change receipts
+	ScopeBudgetsRead   = "budgets:read"   // Read budgets and categories
+	ScopeBudgetsWrite  = "budgets:write"  // Create and change budgets and categories
+	ScopeOfflineAccess = "offline_access" // Receive a refresh token
+)
+
+// ScopeDescriptions lists every supported scope with the text shown on the consent page
+var ScopeDescriptions = map[string]string{
+	ScopeOpenID:        "Sign you in with your Debt Solver account",
+	ScopeProfile:       "See your name and email address",
+	ScopeEmail:         "See your email address",
+	ScopeExpensesRead:  "See your expenses",
+	ScopeExpensesWrite: "Add and change your expenses",
+	ScopeReceiptsRead:  "See your scanned receipts",
+	ScopeReceiptsWrite: "Upload and change your receipts",
+	ScopeBudgetsRead:   "See your budgets and categories",
+	ScopeBudgetsWrite:  "Add and change your budgets and categories",
+	ScopeOfflineAccess: "Keep access while you are not using the app",
+}
+
+// clientIDBytes and clientSecretBytes size the generated client credentials
+const (
+	clientIDBytes     = 16
+	clientSecretBytes = 32
+)
+
+var (
+	// ErrInvalidScope is returned for unknown scopes or scopes the client may not request
+	ErrInvalidScope = errors.New("invalid scope")
+	// ErrInvalidClient is returned when client authentication fails
+	ErrInvalidClient = errors.New("invalid client")
+	// ErrInvalidRedirectURI is returned when registering a redirect URI that is not allowed
+	ErrInvalidRedirectURI = errors.New("redirect URIs must be absolute https URLs without a fragment; http is only allowed for localhost")
+)
+
+// ParseScope splits a space-separated scope string and rejects unknown or duplicate scopes
+func ParseScope(scope string) ([]string, error) {
+	scopes := strings.Fields(scope)
+	seen := make(map[string]bool, len(scopes))
+	for _, s := range scopes {
+		if _, ok := ScopeDescriptions[s]; !ok || seen[s] {
+			return nil, ErrInvalidScope
+		}
+		seen[s] = true
+	}
+	return scopes, nil
+}
+
+// ScopeIncludes reports whether every scope in requested is part of granted
+func ScopeIncludes(granted string, requested []string) bool {
+	grantedScopes := strings.Fields(granted)
+	for _, r := range requested {
+		found := false
+		for _, g := range grantedScopes {
+			if g == r {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// validateRedirectURI only accepts https URLs, http on the loopback interface for development, and
+// private-use schemes such as com.example.app:/callback for native public clients (RFC 8252)
+func validateRedirectURI(clientType, redirectURI string) error {
+	parsed, err := url.Parse(redirectURI)
+	if err != nil || !parsed.IsAbs() || parsed.Fragment != "" {
+		return ErrInvalidRedirectURI
+	}
+
+	switch parsed.Scheme {
+	case "https":
+		return nil
+	case "http":
+		if host := parsed.Hostname(); host == "localhost" || host == "127.0.0.1" || host == "::1" {
+			return nil
+		}
+		return ErrInvalidRedirectURI
+	default:
+		if clientType == models.OAuthClientPublic && strings.Contains(parsed.Scheme, ".") {
+			return nil
+		}
+		return ErrInvalidRedirectURI
+	}
+}
+
+// CreateOAuthClient registers a client owned by the user. For confidential clients the generated
+// secret is returned; it is only stored as a hash and cannot be shown again.
+func CreateOAuthClient(ownerID uuid.UUID, name, clientType string, redirectURIs []string, scope string) (*models.OAuthClient, string, error) {
+	scopes, err := ParseScope(scope)
+	if err != nil || len(scopes) == 0 {
+		return nil, "", ErrInvalidScope
+	}
+
+	for _, redirectURI := range redirectURIs {
+		if err := validateRedirectURI(clientType, redirectURI); err != nil {
+			return nil, "", err
+		}
+	}
+
+	clientID, err := utils.GenerateOpaqueToken(clientIDBytes)
+	if err != nil {
+		return nil, "", err
+	}
+
+	client := models.OAuthClient{
+		ClientID:     clientID,
+		ClientType:   clientType,
+		Name:         name,
+		RedirectURIs: strings.Join(redirectURIs, " "),
+		Scope:        strings.Join(scopes, " "),
+		OwnerID:      ownerID,
+		CreatedAt:    time.Now(),
+	}
+
+	var secret string
+	if clientType == models.OAuthClientConfidential {
+		secret, err = utils.GenerateOpaqueToken(clientSecretBytes)
+		if err != nil {
+			return nil, "", err
+		}
+		client.ClientSecretHash = utils.HashToken(secret)
+	}
+
+	// Get the DB instance
+	DB := db.GetDBInstance()
+	if err := DB.Create(&client).Error; err != nil {
+		return nil, "", err
+	}
+
+	return &client, secret, nil
+}
+
+// GetOAuthClient returns a registered client
+func GetOAuthClient(clientID string) (*models.OAuthClient, error) {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	var client models.OAuthClient
+	if err := DB.Where("client_id = ?", clientID).First(&client).Error; err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// AuthenticateOAuthClient checks client credentials presented at the token endpoint.
+// Confidential clients must present their secret; public clients must not have one.
+func AuthenticateOAuthClient(clientID, clientSecret string) (*models.OAuthClient, error) {
+	client, err := GetOAuthClient(clientID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidClient
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if client.ClientType == models.OAuthClientPublic {
+		if clientSecret != "" {
+			return nil, ErrInvalidClient
+		}
+		return client, nil
+	}
+
+	if clientSecret == "" || subtle.ConstantTimeCompare([]byte(client.ClientSecretHash), []byte(utils.HashToken(clientSecret))) != 1 {
+		return nil, ErrInvalidClient
+	}
+	return client, nil
+}
+
+// ListOAuthClients returns the clients registered by the user
+func ListOAuthClients(ownerID uuid.UUID) ([]models.OAuthClient, error) {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	var clients []models.OAuthClient
+	err := DB.Where("owner_id = ?", ownerID).Order("created_at DESC").Find(&clients).Error
+	return clients, err
+}
+
+// DeleteOAuthClient removes one of the user's clients. Its codes, consents and tokens go with it.
+func DeleteOAuthClient(ownerID uuid.UUID, clientID string) error {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	result := DB.Where("client_id = ? AND owner_id = ?", clientID, ownerID).Delete(&models.OAuthClient{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
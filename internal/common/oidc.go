@@ -0,0 +1,80 @@
+package common
+
+import (
+	"strings"
+
+	"github.com/Debt-Solvers/BE-auth-service/db"
+	"github.com/Debt-Solvers/BE-auth-service/internal/models"
+	"github.com/Debt-Solvers/BE-auth-service/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// OIDCClaimsSupported lists the claims the ID token and userinfo endpoint can return
+var OIDCClaimsSupported = []string{
+	"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce",
+	"email", "email_verified", "name", "given_name", "family_name",
+}
+
+// UserClaims maps the user to the standard OpenID Connect claims covered by the scopes.
+// A nil scope list returns every claim, as for first-party tokens.
+func UserClaims(user *models.User, scopes []string) map[string]interface{} {
+	claims := map[string]interface{}{"sub": user.UserID}
+
+	allowed := func(scope string) bool {
+		if scopes == nil {
+			return true
+		}
+		for _, s := range scopes {
+			if s == scope {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Our profile scope has always included the email address
+	if allowed(ScopeEmail) || allowed(ScopeProfile) {
+		claims["email"] = user.Email
+		claims["email_verified"] = user.IsEmailVerified
+	}
+	if allowed(ScopeProfile) {
+		claims["name"] = user.FirstName + " " + user.LastName
+		claims["given_name"] = user.FirstName
+		claims["family_name"] = user.LastName
+	}
+	return claims
+}
+
+// GetUserClaims loads the user and returns the claims covered by the scopes
+func GetUserClaims(userID uuid.UUID, scopes []string) (map[string]interface{}, error) {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	var user models.User
+	if err := DB.Where("user_id = ?", userID).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return UserClaims(&user, scopes), nil
+}
+
+// issueIDToken signs the ID token for a redeemed authorization code that was granted the openid scope
+func issueIDToken(client *models.OAuthClient, authorizationCode *models.OAuthAuthorizationCode) (string, error) {
+	claims, err := GetUserClaims(authorizationCode.UserID, strings.Fields(authorizationCode.Scope))
+	if err != nil {
+		return "", err
+	}
+
+	extra := jwt.MapClaims{"auth_time": authorizationCode.AuthTime.Unix()}
+	for name, value := range claims {
+		if name != "sub" {
+			extra[name] = value
+		}
+	}
+	if authorizationCode.Nonce != "" {
+		extra["nonce"] = authorizationCode.Nonce
+	}
+
+	return utils.GenerateIDToken(authorizationCode.UserID, client.ClientID, extra)
+}
@@ -0,0 +1,40 @@
+package common
+
+import (
+	"github.com/Debt-Solvers/BE-auth-service/db"
+	"github.com/Debt-Solvers/BE-auth-service/internal/models"
+	"github.com/Debt-Solvers/BE-auth-service/utils"
+)
+
+// UpgradePasswordHash rehashes the password the user just signed in with if the stored hash is a
+// legacy salted bcrypt hash or does not use the configured algorithm and parameters. The hash is
+// only replaced if the password was not changed in the meantime.
+func UpgradePasswordHash(user *models.User, password string) error {
+	if !utils.PasswordNeedsRehash(user.PasswordHash, user.Salt) {
+		return nil
+	}
+	// A password from before a switch to bcrypt can be too long for it; its hash stays as it is
+	if maxBytes := utils.MaxPasswordBytes(); maxBytes > 0 && len(password) > maxBytes {
+		return nil
+	}
+
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	result := DB.Model(&models.User{}).
+		Where("user_id = ? AND password_hash = ?", user.UserID, user.PasswordHash).
+		Updates(map[string]interface{}{"password_hash": hashedPassword, "salt": ""})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 1 {
+		user.PasswordHash = hashedPassword
+		user.Salt = ""
+	}
+	return nil
+}
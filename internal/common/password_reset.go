@@ -0,0 +1,123 @@
+package common
+
+import (
+	"crypto/subtle"
+	"errors"
+	"time"
+
+	"github.com/Debt-Solvers/BE-auth-service/configs"
+	"github.com/Debt-Solvers/BE-auth-service/db"
+	"github.com/Debt-Solvers/BE-auth-service/internal/models"
+	"github.com/Debt-Solvers/BE-auth-service/internal/passwordpolicy"
+	"github.com/Debt-Solvers/BE-auth-service/utils"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrInvalidResetToken is returned for wrong, expired or already used reset codes
+	ErrInvalidResetToken = errors.New("invalid or expired reset token")
+	// ErrTooManyResetAttempts is returned once a reset code has seen too many wrong guesses
+	ErrTooManyResetAttempts = errors.New("too many failed attempts, request a new reset code")
+)
+
+// CreatePasswordResetToken issues a new reset code for the user and returns it. Earlier codes stop working.
+func CreatePasswordResetToken(tx *gorm.DB, userID uuid.UUID) (string, error) {
+	code, err := utils.GenerateResetToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	if err := tx.Model(&models.PasswordResetToken{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", now).Error; err != nil {
+		return "", err
+	}
+
+	resetToken := models.PasswordResetToken{
+		TokenID:   uuid.New(),
+		UserID:    userID,
+		TokenHash: utils.HashToken(code),
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Duration(configs.GetConfig().PasswordReset.TokenMinutes) * time.Minute),
+	}
+	if err := tx.Create(&resetToken).Error; err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+// ResetPasswordWithToken checks the user's latest reset code and, if it matches, sets the new password,
+// uses up the code and ends every session of the user. Wrong codes count towards the attempt limit.
+func ResetPasswordWithToken(user *models.User, code, newPassword string) error {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	maxAttempts := configs.GetConfig().PasswordReset.MaxAttempts
+	var resetErr error
+
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the code so concurrent guesses are counted one after the other
+		var resetToken models.PasswordResetToken
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND used_at IS NULL AND expires_at > ?", user.UserID, time.Now()).
+			Order("created_at DESC").
+			First(&resetToken).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				resetErr = ErrInvalidResetToken
+				return nil
+			}
+			return err
+		}
+
+		if resetToken.FailedAttempts >= maxAttempts {
+			resetErr = ErrTooManyResetAttempts
+			return nil
+		}
+
+		// A failed attempt is committed, so the error is only returned after the transaction
+		if subtle.ConstantTimeCompare([]byte(resetToken.TokenHash), []byte(utils.HashToken(code))) != 1 {
+			resetErr = ErrInvalidResetToken
+			if resetToken.FailedAttempts+1 >= maxAttempts {
+				resetErr = ErrTooManyResetAttempts
+			}
+			return tx.Model(&resetToken).Update("failed_attempts", gorm.Expr("failed_attempts + 1")).Error
+		}
+
+		// Checked only once the code is right, so the response does not tell whether the account exists.
+		// The code stays usable for another try.
+		err := passwordpolicy.Validate(newPassword, passwordpolicy.PersonalInfo{Email: user.Email, FirstName: user.FirstName, LastName: user.LastName})
+		if err != nil {
+			return err
+		}
+
+		hashedPassword, err := utils.HashPassword(newPassword)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Model(&resetToken).Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+		// Setting a new password also satisfies a reset forced by an admin
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"password_hash":           hashedPassword,
+			"salt":                    "",
+			"password_reset_required": false,
+			"password_breached_at":    nil,
+		}).Error; err != nil {
+			return err
+		}
+
+		// Whoever knew the old password must not stay signed in
+		return revokeUserSessions(tx, user.UserID, uuid.Nil)
+	})
+	if err != nil {
+		return err
+	}
+	return resetErr
+}
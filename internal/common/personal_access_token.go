@@ -0,0 +1,163 @@
+package common
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Debt-Solvers/BE-auth-service/db"
+	"github.com/Debt-Solvers/BE-auth-service/internal/models"
+	"github.com/Debt-Solvers/BE-auth-service/utils"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// maxPersonalAccessTokens limits how many tokens a user can hold at once
+const maxPersonalAccessTokens = 50
+
+var (
+	// ErrInvalidPersonalAccessToken is returned for tokens that are malformed, unknown, deleted or expired
+	ErrInvalidPersonalAccessToken = errors.New("personal access token is invalid or expired")
+	// ErrTooManyPersonalAccessTokens is returned when a user already holds maxPersonalAccessTokens tokens
+	ErrTooManyPersonalAccessTokens = errors.New("too many personal access tokens, delete one first")
+)
+
+// CreatePersonalAccessToken issues a token limited to the given scopes and returns it with its record.
+// expiresInDays of 0 creates a token that does not expire.
+func CreatePersonalAccessToken(userID uuid.UUID, name, scope string, expiresInDays int) (*models.PersonalAccessToken, string, error) {
+	scopes, err := ParseScope(scope)
+	if err != nil || len(scopes) == 0 {
+		return nil, "", ErrInvalidScope
+	}
+	// Scopes that only make sense in an OAuth flow
+	for _, s := range scopes {
+		if s == ScopeOpenID || s == ScopeEmail || s == ScopeOfflineAccess {
+			return nil, "", ErrInvalidScope
+		}
+	}
+
+	token, err := utils.GeneratePersonalAccessToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	pat := models.PersonalAccessToken{
+		TokenID:   uuid.New(),
+		UserID:    userID,
+		Name:      name,
+		TokenHash: utils.HashToken(token),
+		TokenHint: utils.PersonalAccessTokenPrefix + "..." + token[len(token)-4:],
+		Scope:     strings.Join(scopes, " "),
+		CreatedAt: now,
+	}
+	if expiresInDays > 0 {
+		expiresAt := now.AddDate(0, 0, expiresInDays)
+		pat.ExpiresAt = &expiresAt
+	}
+
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.PersonalAccessToken{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count >= maxPersonalAccessTokens {
+			return ErrTooManyPersonalAccessTokens
+		}
+
+		if err := tx.Create(&pat).Error; err != nil {
+			return err
+		}
+		return RecordAudit(tx, userID, "personal_access_tokens", "TOKEN_CREATED", nil, map[string]interface{}{"name": name, "scope": pat.Scope})
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return &pat, token, nil
+}
+
+// AuthenticatePersonalAccessToken returns the record of a valid token along with the account state of
+// its owner, and records that it was used
+func AuthenticatePersonalAccessToken(token string) (*models.PersonalAccessToken, *models.User, error) {
+	pat, owner, err := findPersonalAccessToken(token)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Write the last-used time at most once per lastUsedResolution
+	if pat.LastUsedAt == nil || time.Since(*pat.LastUsedAt) >= lastUsedResolution {
+		now := time.Now()
+		if err := db.GetDBInstance().Model(pat).Update("last_used_at", now).Error; err != nil {
+			log.Printf("Failed to update personal access token last-used time: %v", err)
+		}
+		pat.LastUsedAt = &now
+	}
+	return pat, owner, nil
+}
+
+// findPersonalAccessToken returns the record of a token that exists and has not expired, and the
+// account state of its owner
+func findPersonalAccessToken(token string) (*models.PersonalAccessToken, *models.User, error) {
+	// The checksum rejects typos and random strings without a database lookup
+	if !utils.IsPersonalAccessToken(token) {
+		return nil, nil, ErrInvalidPersonalAccessToken
+	}
+
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	var pat models.PersonalAccessToken
+	err := DB.Where("token_hash = ?", utils.HashToken(token)).First(&pat).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, ErrInvalidPersonalAccessToken
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if pat.ExpiresAt != nil && pat.ExpiresAt.Before(time.Now()) {
+		return nil, nil, ErrInvalidPersonalAccessToken
+	}
+
+	var owner models.User
+	if err := DB.Select("user_id", "disabled_at", "password_reset_required", "is_email_verified").Where("user_id = ?", pat.UserID).First(&owner).Error; err != nil {
+		return nil, nil, err
+	}
+	// Tokens stop working while an admin blocks sign-in, until the account is enabled again or the
+	// password is reset
+	if CheckAccountStatus(&owner) != nil {
+		return nil, nil, ErrInvalidPersonalAccessToken
+	}
+	return &pat, &owner, nil
+}
+
+// ListPersonalAccessTokens returns the user's tokens, newest first
+func ListPersonalAccessTokens(userID uuid.UUID) ([]models.PersonalAccessToken, error) {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	var pats []models.PersonalAccessToken
+	err := DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&pats).Error
+	return pats, err
+}
+
+// DeletePersonalAccessToken revokes one of the user's tokens
+func DeletePersonalAccessToken(userID, tokenID uuid.UUID) error {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var pat models.PersonalAccessToken
+		if err := tx.Where("token_id = ? AND user_id = ?", tokenID, userID).First(&pat).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&pat).Error; err != nil {
+			return err
+		}
+		return RecordAudit(tx, userID, "personal_access_tokens", "TOKEN_DELETED", nil, map[string]interface{}{"name": pat.Name})
+	})
+}
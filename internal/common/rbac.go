@@ -0,0 +1,288 @@
+package common
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Debt-Solvers/BE-auth-service/configs"
+	"github.com/Debt-Solvers/BE-auth-service/db"
+	"github.com/Debt-Solvers/BE-auth-service/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Built-in roles, seeded by db/schema.sql
+const (
+	RoleUser    = "user"    // Held by every account without an assignment
+	RoleSupport = "support" // Looks up accounts and email delivery
+	RoleAdmin   = "admin"   // Full access to the admin endpoints
+)
+
+// Permissions checked by middleware.RequirePermission, seeded by db/schema.sql
+const (
+	PermissionUsersRead            = "users:read"
+	PermissionUsersWrite           = "users:write"
+	PermissionRolesAssign          = "roles:assign"
+	PermissionAuditLogsRead        = "audit_logs:read"
+	PermissionEmailOutboxManage    = "email_outbox:manage"
+	PermissionServiceClientsManage = "service_clients:manage"
+)
+
+// rolePermissionsTTL bounds how long the role definitions are cached. Role assignments are never
+// cached, see HasPermission.
+const rolePermissionsTTL = time.Minute
+
+var (
+	// ErrUnknownRole is returned when assigning a role that does not exist
+	ErrUnknownRole = errors.New("unknown role")
+	// ErrImplicitRole is returned when assigning or removing the user role, which every account holds
+	ErrImplicitRole = errors.New("every account holds the user role, it cannot be assigned or removed")
+	// ErrLastAdmin is returned when removing the admin role from the only admin
+	ErrLastAdmin = errors.New("the last admin cannot lose the admin role")
+)
+
+var (
+	rolePermissions         map[string][]string
+	rolePermissionsLoadedAt time.Time
+	rolePermissionsMu       sync.Mutex
+)
+
+// RolePermissions returns the permissions of every role, cached for rolePermissionsTTL
+func RolePermissions() (map[string][]string, error) {
+	rolePermissionsMu.Lock()
+	defer rolePermissionsMu.Unlock()
+
+	if rolePermissions != nil && time.Since(rolePermissionsLoadedAt) < rolePermissionsTTL {
+		return rolePermissions, nil
+	}
+
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	var roles []models.Role
+	if err := DB.Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	var grants []models.RolePermission
+	if err := DB.Order("permission").Find(&grants).Error; err != nil {
+		return nil, err
+	}
+
+	permissions := make(map[string][]string, len(roles))
+	for _, role := range roles {
+		permissions[role.Name] = []string{}
+	}
+	for _, grant := range grants {
+		permissions[grant.Role] = append(permissions[grant.Role], grant.Permission)
+	}
+
+	rolePermissions, rolePermissionsLoadedAt = permissions, time.Now()
+	return rolePermissions, nil
+}
+
+// ListRoles returns the roles with their descriptions
+func ListRoles() ([]models.Role, error) {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	var roles []models.Role
+	err := DB.Order("name").Find(&roles).Error
+	return roles, err
+}
+
+// GetUserRoles returns the user's roles, the user role first, and the version they are stamped with
+func GetUserRoles(userID uuid.UUID) ([]string, int, error) {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	var user models.User
+	if err := DB.Select("user_id", "role_version").Where("user_id = ?", userID).First(&user).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var assigned []string
+	if err := DB.Model(&models.UserRole{}).Where("user_id = ?", userID).Order("role").Pluck("role", &assigned).Error; err != nil {
+		return nil, 0, err
+	}
+	return append([]string{RoleUser}, assigned...), user.RoleVersion, nil
+}
+
+// HasPermission reports whether the user may perform the action. The roles in the access token are
+// used while the token's role version matches the user's; once the roles have changed they are read
+// from the database, so a removed role stops working before the token expires.
+func HasPermission(userID uuid.UUID, tokenRoles []string, tokenRoleVersion int, permission string) (bool, error) {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	var user models.User
+	if err := DB.Select("user_id", "role_version").Where("user_id = ?", userID).First(&user).Error; err != nil {
+		return false, err
+	}
+
+	roles := tokenRoles
+	if user.RoleVersion != tokenRoleVersion {
+		var err error
+		if roles, _, err = GetUserRoles(userID); err != nil {
+			return false, err
+		}
+	}
+
+	permissions, err := RolePermissions()
+	if err != nil {
+		return false, err
+	}
+	for _, role := range roles {
+		for _, granted := range permissions[role] {
+			if granted == permission {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// AssignRole gives the user a role. Assigning a role the user already holds changes nothing.
+func AssignRole(userID uuid.UUID, role string, assignedBy *uuid.UUID) error {
+	if role == RoleUser {
+		return ErrImplicitRole
+	}
+	permissions, err := RolePermissions()
+	if err != nil {
+		return err
+	}
+	if _, ok := permissions[role]; !ok {
+		return ErrUnknownRole
+	}
+
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Select("user_id").Where("user_id = ?", userID).First(&user).Error; err != nil {
+			return err
+		}
+
+		created := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.UserRole{
+			UserID:     userID,
+			Role:       role,
+			AssignedBy: assignedBy,
+			AssignedAt: time.Now(),
+		})
+		if created.Error != nil || created.RowsAffected == 0 {
+			return created.Error
+		}
+
+		if err := bumpRoleVersion(tx, userID); err != nil {
+			return err
+		}
+		if assignedBy == nil {
+			return RecordAudit(tx, userID, "user_roles", "ROLE_ASSIGNED", nil, map[string]interface{}{"role": role})
+		}
+		return RecordAdminAudit(tx, *assignedBy, userID, "user_roles", "ROLE_ASSIGNED", nil, map[string]interface{}{"role": role})
+	})
+}
+
+// RemoveRole takes a role away from the user
+func RemoveRole(userID uuid.UUID, role string, removedBy uuid.UUID) error {
+	if role == RoleUser {
+		return ErrImplicitRole
+	}
+
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if role == RoleAdmin {
+			if err := ensureNotLastAdmin(tx, userID); err != nil {
+				return err
+			}
+		}
+
+		deleted := tx.Where("user_id = ? AND role = ?", userID, role).Delete(&models.UserRole{})
+		if deleted.Error != nil {
+			return deleted.Error
+		}
+		if deleted.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		if err := bumpRoleVersion(tx, userID); err != nil {
+			return err
+		}
+		return RecordAdminAudit(tx, removedBy, userID, "user_roles", "ROLE_REMOVED", map[string]interface{}{"role": role}, nil)
+	})
+}
+
+// ensureNotLastAdmin returns ErrLastAdmin if the user is the only admin. It locks the admin
+// assignments so two admins cannot remove each other at the same time.
+func ensureNotLastAdmin(tx *gorm.DB, userID uuid.UUID) error {
+	var admins []models.UserRole
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("role = ?", RoleAdmin).Find(&admins).Error; err != nil {
+		return err
+	}
+	if len(admins) == 1 && admins[0].UserID == userID {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+// bumpRoleVersion marks the roles in the user's existing access tokens as outdated
+func bumpRoleVersion(tx *gorm.DB, userID uuid.UUID) error {
+	return tx.Model(&models.User{}).Where("user_id = ?", userID).
+		Update("role_version", gorm.Expr("role_version + 1")).Error
+}
+
+// AssignConfiguredAdmins gives the admin role to the existing accounts listed in admin.emails, so a
+// fresh installation has someone who can assign roles. Accounts must have verified their email
+// address, or whoever signed up with a listed address before its owner would become admin.
+func AssignConfiguredAdmins() {
+	for _, email := range configs.GetConfig().Admin.Emails {
+		email = strings.ToLower(strings.TrimSpace(email))
+		if email == "" {
+			continue
+		}
+
+		var user models.User
+		if err := db.GetDBInstance().Where("email = ?", email).First(&user).Error; err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				log.Printf("Failed to look up configured admin %s: %v", email, err)
+			}
+			continue
+		}
+		if !user.IsEmailVerified {
+			log.Printf("Not assigning the admin role to %s until the email address is verified", email)
+			continue
+		}
+		if err := AssignRole(user.UserID, RoleAdmin, nil); err != nil {
+			log.Printf("Failed to assign the admin role to %s: %v", email, err)
+		}
+	}
+}
+
+// PermissionsOfRoles returns the distinct permissions of the roles in name order
+func PermissionsOfRoles(roles []string) ([]string, error) {
+	permissions, err := RolePermissions()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var list []string
+	for _, role := range roles {
+		for _, permission := range permissions[role] {
+			if !seen[permission] {
+				seen[permission] = true
+				list = append(list, permission)
+			}
+		}
+	}
+	sort.Strings(list)
+	return list, nil
+}
@@ -0,0 +1,109 @@
+package common
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"strings"
+	"time"
+
+	"github.com/Debt-Solvers/BE-auth-service/db"
+	"github.com/Debt-Solvers/BE-auth-service/internal/models"
+	"github.com/Debt-Solvers/BE-auth-service/utils"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// recoveryCodeCount is how many codes a user gets per generation
+const recoveryCodeCount = 10
+
+// recoveryCodeBytes gives each code 160 bits, too many to brute-force from a leaked SHA-256 hash
+const recoveryCodeBytes = 20
+
+// recoveryCodeEncoding avoids padding and keeps codes case-insensitive once lowercased
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateRecoveryCodes replaces the user's recovery codes with a fresh set and returns them.
+// The plaintext codes are only available here; only their hashes are stored.
+func GenerateRecoveryCodes(userID uuid.UUID) ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	rows := make([]models.RecoveryCode, 0, recoveryCodeCount)
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, recoveryCodeBytes)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		// 32 characters, shown in groups of eight
+		encoded := strings.ToLower(recoveryCodeEncoding.EncodeToString(raw))
+		code := encoded[:8] + "-" + encoded[8:16] + "-" + encoded[16:24] + "-" + encoded[24:]
+
+		codes = append(codes, code)
+		rows = append(rows, models.RecoveryCode{
+			ID:        uuid.New(),
+			UserID:    userID,
+			CodeHash:  utils.HashToken(normalizeRecoveryCode(code)),
+			CreatedAt: time.Now(),
+		})
+	}
+
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&rows).Error; err != nil {
+			return err
+		}
+		return RecordAudit(tx, userID, "mfa_recovery_codes", "RECOVERY_CODES_GENERATED", nil, map[string]interface{}{"count": len(rows)})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// CountRecoveryCodes returns how many unused recovery codes the user has left
+func CountRecoveryCodes(userID uuid.UUID) (int64, error) {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	var count int64
+	err := DB.Model(&models.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count).Error
+	return count, err
+}
+
+// UseRecoveryCode checks a recovery code at the second-factor step and marks it used.
+// Failures count towards the same pause as wrong TOTP codes.
+func UseRecoveryCode(mfa *models.UserMFA, code string) error {
+	return verifySecondFactor(mfa, func(tx *gorm.DB, locked *models.UserMFA) (bool, error) {
+		result := tx.Model(&models.RecoveryCode{}).
+			Where("user_id = ? AND code_hash = ? AND used_at IS NULL", locked.UserID, utils.HashToken(normalizeRecoveryCode(code))).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return false, result.Error
+		}
+		if result.RowsAffected == 0 {
+			return false, nil
+		}
+
+		var remaining int64
+		if err := tx.Model(&models.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", locked.UserID).Count(&remaining).Error; err != nil {
+			return false, err
+		}
+		locked.FailedAttempts = 0
+		if err := tx.Model(locked).Update("failed_attempts", 0).Error; err != nil {
+			return false, err
+		}
+		return true, RecordAudit(tx, locked.UserID, "mfa_recovery_codes", "RECOVERY_CODE_USED", nil, map[string]interface{}{"remaining": remaining})
+	})
+}
+
+// normalizeRecoveryCode lets users type codes with or without the dash and in any case
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
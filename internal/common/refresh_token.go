@@ -0,0 +1,165 @@
+package common
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/Debt-Solvers/BE-auth-service/db"
+	"github.com/Debt-Solvers/BE-auth-service/internal/models"
+	"github.com/Debt-Solvers/BE-auth-service/utils"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrInvalidRefreshToken is returned for unknown or expired refresh tokens
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	// ErrRefreshTokenReused is returned when a retired refresh token is presented again
+	ErrRefreshTokenReused = errors.New("refresh token has already been used")
+)
+
+// refreshTokenBytes is the amount of entropy in an opaque refresh token
+const refreshTokenBytes = 32
+
+// CreateRefreshToken issues a new refresh token in the given family and returns the opaque token string
+func CreateRefreshToken(tx *gorm.DB, userID, familyID uuid.UUID) (string, error) {
+	return CreateClientRefreshToken(tx, userID, familyID, nil, "")
+}
+
+// CreateClientRefreshToken issues a refresh token for an OAuth client limited to the given scopes.
+// A nil clientID issues a first-party token.
+func CreateClientRefreshToken(tx *gorm.DB, userID, familyID uuid.UUID, clientID *string, scope string) (string, error) {
+	tokenString, err := utils.GenerateOpaqueToken(refreshTokenBytes)
+	if err != nil {
+		return "", err
+	}
+
+	refreshToken := models.RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: utils.HashToken(tokenString),
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().Add(utils.RefreshTokenTTL()),
+		ClientID:  clientID,
+		Scope:     scope,
+	}
+
+	if err := tx.Create(&refreshToken).Error; err != nil {
+		return "", err
+	}
+
+	return tokenString, nil
+}
+
+// StoreFamilyToken stores the access token issued for a refresh token family.
+// The family keeps a single auth_tokens row, so a refresh replaces the previous access token in place
+// and the row's TokenID stays stable as the session ID.
+func StoreFamilyToken(tx *gorm.DB, token *models.AuthToken) error {
+	updates := map[string]interface{}{
+		"token":        token.Token,
+		"expires_at":   token.ExpiresAt,
+		"last_used_at": token.CreatedAt,
+	}
+	if token.IPAddress != "" {
+		updates["ip_address"] = token.IPAddress
+	}
+	if token.UserAgent != "" {
+		updates["user_agent"] = token.UserAgent
+	}
+
+	result := tx.Model(&models.AuthToken{}).Where("family_id = ?", token.FamilyID).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+
+	return tx.Create(token).Error
+}
+
+// RotateRefreshToken retires the presented refresh token and issues its successor in the same family.
+// Presenting a token that was already rotated or revoked revokes the entire family. clientID must match
+// the OAuth client the token was issued to, or be empty for first-party tokens. issue, if not nil, runs in
+// the rotation's transaction to issue the access token, so if it fails the presented token stays valid
+// and a retry is not mistaken for reuse.
+func RotateRefreshToken(tokenString, clientID string, issue func(tx *gorm.DB, current *models.RefreshToken) error) (*models.RefreshToken, string, error) {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	var current models.RefreshToken
+	var newToken string
+	reused := false
+
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the row so two concurrent refreshes cannot both succeed
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", utils.HashToken(tokenString)).
+			First(&current).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidRefreshToken
+			}
+			return err
+		}
+
+		// A token presented by the wrong client is treated as unknown
+		if current.ClientID == nil && clientID != "" || current.ClientID != nil && *current.ClientID != clientID {
+			return ErrInvalidRefreshToken
+		}
+
+		// A retired token coming back means it was copied; kill the whole family
+		if current.RotatedAt != nil || current.RevokedAt != nil {
+			reused = true
+			return revokeTokenFamily(tx, current.FamilyID)
+		}
+
+		if current.ExpiresAt.Before(time.Now()) {
+			return ErrInvalidRefreshToken
+		}
+
+		now := time.Now()
+		if err := tx.Model(&current).Update("rotated_at", now).Error; err != nil {
+			return err
+		}
+
+		var err error
+		newToken, err = CreateClientRefreshToken(tx, current.UserID, current.FamilyID, current.ClientID, current.Scope)
+		if err != nil || issue == nil {
+			return err
+		}
+		return issue(tx, &current)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	if reused {
+		log.Printf("Refresh token reuse detected for user %s, revoked token family %s", current.UserID, current.FamilyID)
+		return nil, "", ErrRefreshTokenReused
+	}
+
+	return &current, newToken, nil
+}
+
+// RevokeTokenFamily revokes every refresh token in a family along with its access token
+func RevokeTokenFamily(familyID uuid.UUID) error {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		return revokeTokenFamily(tx, familyID)
+	})
+}
+
+func revokeTokenFamily(tx *gorm.DB, familyID uuid.UUID) error {
+	if err := tx.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error; err != nil {
+		return err
+	}
+
+	return tx.Where("family_id = ?", familyID).Delete(&models.AuthToken{}).Error
+}
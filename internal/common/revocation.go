@@ -0,0 +1,138 @@
+package common
+
+import (
+	"errors"
+
+	"github.com/Debt-Solvers/BE-auth-service/db"
+	"github.com/Debt-Solvers/BE-auth-service/internal/models"
+	"github.com/Debt-Solvers/BE-auth-service/utils"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RevokeToken revokes an access or refresh token together with the session it belongs to (RFC 7009).
+// clientID is the authenticated caller, empty for our own apps; only tokens issued to the caller are
+// revoked unless the caller is trusted. Personal access tokens count as our own apps' tokens, so anyone
+// holding a leaked one can revoke it. Unknown tokens and tokens of other clients are ignored, so the
+// caller cannot tell whether a token existed.
+func RevokeToken(token, tokenTypeHint, clientID string, trusted bool) error {
+	if utils.IsPersonalAccessToken(token) {
+		_, err := revokePersonalAccessToken(token, clientID, trusted)
+		return err
+	}
+
+	lookups := []func(string, string, bool) (bool, error){revokeAccessToken, revokeRefreshToken}
+	if tokenTypeHint == TokenTypeHintRefreshToken {
+		lookups[0], lookups[1] = lookups[1], lookups[0]
+	}
+
+	for _, lookup := range lookups {
+		found, err := lookup(token, clientID, trusted)
+		if err != nil || found {
+			return err
+		}
+	}
+	return nil
+}
+
+// revokeAccessToken ends the session of an access token and reports whether the token was found
+func revokeAccessToken(token, clientID string, trusted bool) (bool, error) {
+	session, err := GetActiveToken(token)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	ownToken := issuedTo(session.ClientID, clientID)
+	if !trusted && !ownToken {
+		return true, nil
+	}
+
+	err = RevokeSession(session)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return true, nil // Revoked concurrently
+	}
+	if err != nil {
+		return true, err
+	}
+	if !ownToken {
+		return true, recordRevocationOnBehalf(session.UserID, clientID, TokenTypeHintAccessToken)
+	}
+	return true, nil
+}
+
+// revokeRefreshToken revokes the family of a refresh token, ending the access token issued with it,
+// and reports whether the token was found
+func revokeRefreshToken(token, clientID string, trusted bool) (bool, error) {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	var refreshToken models.RefreshToken
+	err := DB.Where("token_hash = ?", utils.HashToken(token)).First(&refreshToken).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	ownToken := issuedTo(refreshToken.ClientID, clientID)
+	if !trusted && !ownToken {
+		return true, nil
+	}
+
+	if err := RevokeTokenFamily(refreshToken.FamilyID); err != nil {
+		return true, err
+	}
+	if !ownToken {
+		return true, recordRevocationOnBehalf(refreshToken.UserID, clientID, TokenTypeHintRefreshToken)
+	}
+	return true, nil
+}
+
+// revokePersonalAccessToken deletes a personal access token and reports whether the token was found
+func revokePersonalAccessToken(token, clientID string, trusted bool) (bool, error) {
+	pat, _, err := findPersonalAccessToken(token)
+	if errors.Is(err, ErrInvalidPersonalAccessToken) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	ownToken := clientID == ""
+	if !trusted && !ownToken {
+		return true, nil
+	}
+
+	err = DeletePersonalAccessToken(pat.UserID, pat.TokenID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return true, nil // Deleted concurrently
+	}
+	if err != nil {
+		return true, err
+	}
+	if !ownToken {
+		return true, recordRevocationOnBehalf(pat.UserID, clientID, "personal_access_token")
+	}
+	return true, nil
+}
+
+// recordRevocationOnBehalf audits a trusted client revoking a token that was not issued to it
+func recordRevocationOnBehalf(userID uuid.UUID, clientID, tokenType string) error {
+	return RecordAudit(db.GetDBInstance(), userID, "auth_tokens", "TOKEN_REVOKED", nil, map[string]interface{}{
+		"revoked_by_client": clientID,
+		"token_type":        tokenType,
+	})
+}
+
+// issuedTo reports whether a token's client matches the caller; nil and "" both mean our own apps
+func issuedTo(tokenClientID *string, clientID string) bool {
+	if tokenClientID == nil {
+		return clientID == ""
+	}
+	return *tokenClientID == clientID
+}
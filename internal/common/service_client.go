@@ -0,0 +1,202 @@
+package common
+
+import (
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Debt-Solvers/BE-auth-service/db"
+	"github.com/Debt-Solvers/BE-auth-service/internal/models"
+	"github.com/Debt-Solvers/BE-auth-service/utils"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ServiceClientIDPrefix starts every service client ID, keeping them apart from OAuth client IDs
+const ServiceClientIDPrefix = "svc_"
+
+var (
+	// ErrInvalidTarget is returned when a service asks for a token for an audience it may not call
+	ErrInvalidTarget = errors.New("invalid audience")
+	// ErrInvalidServiceValue is returned when registering a scope or audience that is not a valid scope token
+	ErrInvalidServiceValue = errors.New("scopes and audiences may not contain spaces, quotes or backslashes")
+)
+
+// validServiceToken reports whether the value is a scope-token as defined in RFC 6749 section 3.3.
+// Service scopes and audiences belong to the services that check them, so only their syntax is validated.
+func validServiceToken(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, r := range value {
+		if r < 0x21 || r > 0x7e || r == '"' || r == '\\' {
+			return false
+		}
+	}
+	return true
+}
+
+// parseServiceValues splits a space-separated list of scopes or audiences and removes duplicates
+func parseServiceValues(values []string) ([]string, error) {
+	seen := make(map[string]bool, len(values))
+	parsed := make([]string, 0, len(values))
+	for _, value := range values {
+		if !validServiceToken(value) {
+			return nil, ErrInvalidServiceValue
+		}
+		if !seen[value] {
+			seen[value] = true
+			parsed = append(parsed, value)
+		}
+	}
+	return parsed, nil
+}
+
+// CreateServiceClient registers one of our own services and returns its secret, which is only stored as a hash
+func CreateServiceClient(createdBy uuid.UUID, name, scope string, audiences []string) (*models.ServiceClient, string, error) {
+	scopes, err := parseServiceValues(strings.Fields(scope))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(scopes) == 0 {
+		return nil, "", ErrInvalidScope
+	}
+	audienceList, err := parseServiceValues(audiences)
+	if err != nil {
+		return nil, "", err
+	}
+
+	clientID, err := utils.GenerateOpaqueToken(clientIDBytes)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := utils.GenerateOpaqueToken(clientSecretBytes)
+	if err != nil {
+		return nil, "", err
+	}
+
+	client := models.ServiceClient{
+		ClientID:         ServiceClientIDPrefix + clientID,
+		ClientSecretHash: utils.HashToken(secret),
+		Name:             name,
+		Scope:            strings.Join(scopes, " "),
+		Audiences:        strings.Join(audienceList, " "),
+		CreatedBy:        &createdBy,
+		CreatedAt:        time.Now(),
+	}
+
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&client).Error; err != nil {
+			return err
+		}
+		return RecordAdminAudit(tx, createdBy, uuid.Nil, "service_clients", "SERVICE_CLIENT_CREATED", nil, map[string]interface{}{
+			"client_id": client.ClientID,
+			"scope":     client.Scope,
+			"audiences": client.Audiences,
+		})
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return &client, secret, nil
+}
+
+// GetServiceClient returns a registered service client
+func GetServiceClient(clientID string) (*models.ServiceClient, error) {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	var client models.ServiceClient
+	if err := DB.Where("client_id = ?", clientID).First(&client).Error; err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// AuthenticateServiceClient checks the credentials a service presents for the client credentials grant
+func AuthenticateServiceClient(clientID, clientSecret string) (*models.ServiceClient, error) {
+	if !strings.HasPrefix(clientID, ServiceClientIDPrefix) || clientSecret == "" {
+		return nil, ErrInvalidClient
+	}
+
+	client, err := GetServiceClient(clientID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidClient
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(client.ClientSecretHash), []byte(utils.HashToken(clientSecret))) != 1 {
+		return nil, ErrInvalidClient
+	}
+	return client, nil
+}
+
+// IssueServiceToken signs a token for the service. The scope and audience default to everything the
+// client is allowed; a narrower request must stay within what the client was registered with.
+func IssueServiceToken(client *models.ServiceClient, scope, audience string) (*OAuthTokens, error) {
+	grantedScope := client.Scope
+	if scope != "" {
+		requested, err := parseServiceValues(strings.Fields(scope))
+		if err != nil || !ScopeIncludes(client.Scope, requested) {
+			return nil, ErrInvalidScope
+		}
+		grantedScope = strings.Join(requested, " ")
+	}
+
+	audiences := client.AudienceList()
+	if audience != "" {
+		requested, err := parseServiceValues(strings.Fields(audience))
+		if err != nil || !ScopeIncludes(client.Audiences, requested) {
+			return nil, ErrInvalidTarget
+		}
+		audiences = requested
+	}
+	if len(audiences) == 0 {
+		return nil, ErrInvalidTarget
+	}
+
+	accessToken, err := utils.GenerateServiceToken(client.ClientID, audiences, grantedScope)
+	if err != nil {
+		return nil, err
+	}
+	return &OAuthTokens{
+		AccessToken: accessToken,
+		Scope:       grantedScope,
+		ExpiresIn:   int(utils.ServiceTokenTTL().Seconds()),
+	}, nil
+}
+
+// ListServiceClients returns every registered service client
+func ListServiceClients() ([]models.ServiceClient, error) {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	var clients []models.ServiceClient
+	err := DB.Order("created_at DESC").Find(&clients).Error
+	return clients, err
+}
+
+// DeleteServiceClient removes a service client. Tokens it already holds stop passing introspection
+// right away and expire within oauth.service_token_minutes.
+func DeleteServiceClient(deletedBy uuid.UUID, clientID string) error {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("client_id = ?", clientID).Delete(&models.ServiceClient{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return RecordAdminAudit(tx, deletedBy, uuid.Nil, "service_clients", "SERVICE_CLIENT_DELETED", map[string]interface{}{"client_id": clientID}, nil)
+	})
+}
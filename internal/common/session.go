@@ -0,0 +1,109 @@
+package common
+
+import (
+	"time"
+
+	"github.com/Debt-Solvers/BE-auth-service/db"
+	"github.com/Debt-Solvers/BE-auth-service/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// lastUsedResolution limits how often a session's last-used time is written back
+const lastUsedResolution = time.Minute
+
+// ListActiveSessions returns the user's sessions that can still be used, either through a live
+// access token or a refresh token that has not been rotated, revoked or expired
+func ListActiveSessions(userID uuid.UUID) ([]models.AuthToken, error) {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	now := time.Now()
+	liveFamilies := DB.Model(&models.RefreshToken{}).
+		Select("family_id").
+		Where("user_id = ? AND rotated_at IS NULL AND revoked_at IS NULL AND expires_at > ?", userID, now)
+
+	var sessions []models.AuthToken
+	err := DB.Where("user_id = ? AND (expires_at > ? OR family_id IN (?))", userID, now, liveFamilies).
+		Order("COALESCE(last_used_at, created_at) DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// GetUserSession returns one of the user's sessions by its ID
+func GetUserSession(userID, sessionID uuid.UUID) (*models.AuthToken, error) {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	var session models.AuthToken
+	if err := DB.Where("token_id = ? AND user_id = ?", sessionID, userID).First(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// RevokeSession ends a session by removing its access token and revoking its refresh token family
+func RevokeSession(session *models.AuthToken) error {
+	if session.FamilyID != nil {
+		return RevokeTokenFamily(*session.FamilyID)
+	}
+
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	result := DB.Delete(session)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound // Return a not found error if no rows were affected
+	}
+	return nil
+}
+
+// RevokeUserSessions ends every session of the user except the one identified by keep.
+// Pass uuid.Nil to end all of them.
+func RevokeUserSessions(userID, keep uuid.UUID) error {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		return revokeUserSessions(tx, userID, keep)
+	})
+}
+
+func revokeUserSessions(tx *gorm.DB, userID, keep uuid.UUID) error {
+	refreshTokens := tx.Model(&models.RefreshToken{}).Where("user_id = ? AND revoked_at IS NULL", userID)
+	authTokens := tx.Where("user_id = ?", userID)
+
+	if keep != uuid.Nil {
+		var kept models.AuthToken
+		if err := tx.Where("token_id = ? AND user_id = ?", keep, userID).First(&kept).Error; err != nil {
+			return err
+		}
+		if kept.FamilyID != nil {
+			refreshTokens = refreshTokens.Where("family_id <> ?", *kept.FamilyID)
+		}
+		authTokens = authTokens.Where("token_id <> ?", keep)
+	}
+
+	if err := refreshTokens.Update("revoked_at", time.Now()).Error; err != nil {
+		return err
+	}
+	return authTokens.Delete(&models.AuthToken{}).Error
+}
+
+// TouchSession records that the session was just used, writing at most once per lastUsedResolution
+func TouchSession(session *models.AuthToken) error {
+	if session.LastUsedAt != nil && time.Since(*session.LastUsedAt) < lastUsedResolution {
+		return nil
+	}
+
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	now := time.Now()
+	session.LastUsedAt = &now
+	return DB.Model(&models.AuthToken{}).Where("token_id = ?", session.TokenID).Update("last_used_at", now).Error
+}
@@ -0,0 +1,254 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Debt-Solvers/BE-auth-service/configs"
+	"github.com/Debt-Solvers/BE-auth-service/db"
+	"github.com/Debt-Solvers/BE-auth-service/internal/connector"
+	"github.com/Debt-Solvers/BE-auth-service/internal/mailer"
+	"github.com/Debt-Solvers/BE-auth-service/internal/models"
+	"github.com/Debt-Solvers/BE-auth-service/utils"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// socialLoginSecretBytes is the entropy of the state, nonce and PKCE verifier of a social login
+const socialLoginSecretBytes = 32
+
+var (
+	// ErrSocialLoginSessionInvalid is returned when finishing a social login that is unknown, expired or already finished
+	ErrSocialLoginSessionInvalid = errors.New("social login has expired or is invalid")
+	// ErrSocialEmailNotVerified is returned when the provider did not assert a verified email for a new identity
+	ErrSocialEmailNotVerified = errors.New("the login provider has not verified the email address")
+	// ErrSocialAccountConflict is returned when an account with an unverified email already uses the address
+	ErrSocialAccountConflict = errors.New("an account with this email address exists but is not verified")
+)
+
+// BeginSocialLogin starts a login with an external provider and returns the URL to send the user to
+// along with the state the provider hands back
+func BeginSocialLogin(provider string) (string, string, error) {
+	conn, err := connector.Get(provider)
+	if err != nil {
+		return "", "", err
+	}
+
+	var secrets [3]string
+	for i := range secrets {
+		if secrets[i], err = utils.GenerateOpaqueToken(socialLoginSecretBytes); err != nil {
+			return "", "", err
+		}
+	}
+	state, nonce, codeVerifier := secrets[0], secrets[1], secrets[2]
+
+	challenge := sha256.Sum256([]byte(codeVerifier))
+	authorizationURL, err := conn.AuthorizationURL(state, nonce, base64.RawURLEncoding.EncodeToString(challenge[:]))
+	if err != nil {
+		return "", "", err
+	}
+
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	// Clear out logins nobody finished
+	if err := DB.Where("expires_at < ?", time.Now()).Delete(&models.SocialLoginSession{}).Error; err != nil {
+		return "", "", err
+	}
+
+	session := models.SocialLoginSession{
+		StateHash:    utils.HashToken(state),
+		Provider:     provider,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		ExpiresAt:    time.Now().Add(time.Duration(configs.GetConfig().SocialLogin.SessionMinutes) * time.Minute),
+	}
+	if err := DB.Create(&session).Error; err != nil {
+		return "", "", err
+	}
+	return authorizationURL, state, nil
+}
+
+// FinishSocialLogin redeems the provider's authorization code and returns the user the identity belongs to.
+// An unknown identity is linked to the account with the same verified email, or gets a new account.
+func FinishSocialLogin(provider, state, code string) (*models.User, error) {
+	conn, err := connector.Get(provider)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	// Each state can be finished only once
+	var session models.SocialLoginSession
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("state_hash = ? AND provider = ? AND expires_at > ?", utils.HashToken(state), provider, time.Now()).
+			First(&session).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrSocialLoginSessionInvalid
+			}
+			return err
+		}
+
+		deleted := tx.Delete(&session)
+		if deleted.Error != nil {
+			return deleted.Error
+		}
+		if deleted.RowsAffected == 0 {
+			return ErrSocialLoginSessionInvalid // Someone else finished this login first
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	identity, err := conn.Exchange(code, session.CodeVerifier, session.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return resolveSocialIdentity(conn, identity)
+}
+
+// resolveSocialIdentity finds the user an identity is linked to, linking or creating one if needed
+func resolveSocialIdentity(conn *connector.Connector, identity *connector.Identity) (*models.User, error) {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	var user models.User
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		var linked models.UserIdentity
+		err := tx.Where("provider = ? AND subject = ?", conn.Name, identity.Subject).First(&linked).Error
+		if err == nil {
+			if err := tx.Model(&linked).Updates(map[string]interface{}{"email": identity.Email, "last_login_at": now}).Error; err != nil {
+				return err
+			}
+			return tx.Where("user_id = ?", linked.UserID).First(&user).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		// A new identity is only trusted with an address the provider has verified
+		email := strings.ToLower(strings.TrimSpace(identity.Email))
+		if email == "" || !identity.EmailVerified {
+			return ErrSocialEmailNotVerified
+		}
+
+		err = tx.Where("email = ?", email).First(&user).Error
+		switch {
+		case err == nil:
+			// Someone else may have registered the address without proving they own it; linking would hand
+			// them the account once the real owner signs in
+			if !user.IsEmailVerified {
+				return ErrSocialAccountConflict
+			}
+			if err := queueIdentityLinkedAlert(tx, user, conn.DisplayName()); err != nil {
+				return err
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if user, err = createSocialUser(tx, email, identity); err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		linked = models.UserIdentity{
+			IdentityID:  uuid.New(),
+			UserID:      user.UserID,
+			Provider:    conn.Name,
+			Subject:     identity.Subject,
+			Email:       identity.Email,
+			CreatedAt:   now,
+			LastLoginAt: &now,
+		}
+		if err := tx.Create(&linked).Error; err != nil {
+			return err
+		}
+		return RecordAudit(tx, user.UserID, "user_identities", "IDENTITY_LINKED", nil, map[string]interface{}{"provider": conn.Name})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// createSocialUser creates an account for a new identity. It gets a random password the user never
+// sees; they can set one later through password reset.
+func createSocialUser(tx *gorm.DB, email string, identity *connector.Identity) (models.User, error) {
+	password, err := utils.GenerateOpaqueToken(socialLoginSecretBytes)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	firstName := identity.GivenName
+	if firstName == "" {
+		firstName = strings.SplitN(email, "@", 2)[0]
+	}
+
+	user := models.User{
+		UserID:          uuid.New(),
+		FirstName:       firstName,
+		LastName:        identity.FamilyName,
+		Email:           email,
+		IsEmailVerified: true, // Verified by the provider
+		CreatedAt:       time.Now(),
+		Currency:        "CAD",
+	}
+	if user.PasswordHash, err = utils.HashPassword(password); err != nil {
+		return models.User{}, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	if err := tx.Create(&user).Error; err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+// queueIdentityLinkedAlert tells the user that a login provider was linked to their account
+func queueIdentityLinkedAlert(tx *gorm.DB, user models.User, providerName string) error {
+	message := fmt.Sprintf("Sign in with %s was linked to your account. If this was not you, reset your password and remove the linked account.", providerName)
+	email, err := mailer.SecurityAlertEmail(user.Email, "A new sign-in method was added to your account", message)
+	if err != nil {
+		return err
+	}
+	return EnqueueEmail(tx, email)
+}
+
+// ListUserIdentities returns the login provider accounts linked to the user
+func ListUserIdentities(userID uuid.UUID) ([]models.UserIdentity, error) {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	var identities []models.UserIdentity
+	err := DB.Where("user_id = ?", userID).Order("created_at").Find(&identities).Error
+	return identities, err
+}
+
+// UnlinkUserIdentity removes one of the user's linked identities. The password always remains, so
+// the user cannot lock themselves out.
+func UnlinkUserIdentity(userID, identityID uuid.UUID) error {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var identity models.UserIdentity
+		if err := tx.Where("identity_id = ? AND user_id = ?", identityID, userID).First(&identity).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&identity).Error; err != nil {
+			return err
+		}
+		return RecordAudit(tx, userID, "user_identities", "IDENTITY_UNLINKED", nil, map[string]interface{}{"provider": identity.Provider})
+	})
+}
@@ -0,0 +1,188 @@
+package common
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Debt-Solvers/BE-auth-service/configs"
+	"github.com/Debt-Solvers/BE-auth-service/db"
+	"github.com/Debt-Solvers/BE-auth-service/internal/connector"
+	"github.com/Debt-Solvers/BE-auth-service/internal/models"
+	"github.com/Debt-Solvers/BE-auth-service/internal/testutil"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// testProvider is the name the mock identity provider is configured under
+const testProvider = "mock"
+
+// socialLogin runs a social login as the subject, letting tamper change the authorization URL the
+// user is sent to, and returns the finished login
+func socialLogin(t *testing.T, provider *testutil.IdentityProvider, subject string, claims jwt.MapClaims, tamper func(url.Values)) (*models.User, error) {
+	t.Helper()
+
+	authorizationURL, state, err := BeginSocialLogin(testProvider)
+	if err != nil {
+		t.Fatalf("BeginSocialLogin: %v", err)
+	}
+	if tamper != nil {
+		target, err := url.Parse(authorizationURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		query := target.Query()
+		tamper(query)
+		target.RawQuery = query.Encode()
+		authorizationURL = target.String()
+	}
+
+	returnedState, code := provider.Authorize(t, authorizationURL, subject, claims)
+	if returnedState != state {
+		t.Fatalf("the provider returned state %q, want %q", returnedState, state)
+	}
+	return FinishSocialLogin(testProvider, state, code)
+}
+
+// linkedIdentities returns the identities of a provider subject
+func linkedIdentities(t *testing.T, subject string) []models.UserIdentity {
+	t.Helper()
+
+	var identities []models.UserIdentity
+	if err := db.GetDBInstance().Where("provider = ? AND subject = ?", testProvider, subject).Find(&identities).Error; err != nil {
+		t.Fatal(err)
+	}
+	return identities
+}
+
+// newEmail returns an address no account uses
+func newEmail() string {
+	return "social-" + uuid.NewString() + "@example.com"
+}
+
+func TestSocialLogin(t *testing.T) {
+	testutil.Database(t)
+
+	// Connectors are created from the configuration on first use, so all cases share one provider
+	provider := testutil.NewIdentityProvider(t)
+	config := configs.GetConfig()
+	if config.SocialLogin.Providers == nil {
+		config.SocialLogin.Providers = make(map[string]configs.SocialLoginProvider)
+	}
+	config.SocialLogin.Providers[testProvider] = provider.Config()
+	if _, err := connector.Get(testProvider); err != nil {
+		t.Fatalf("the mock provider is not configured: %v", err)
+	}
+
+	t.Run("creates a user", func(t *testing.T) {
+		subject, email := uuid.NewString(), newEmail()
+		claims := jwt.MapClaims{"email": strings.ToUpper(email), "email_verified": true, "given_name": "Ada", "family_name": "Lovelace"}
+
+		user, err := socialLogin(t, provider, subject, claims, nil)
+		if err != nil {
+			t.Fatalf("FinishSocialLogin: %v", err)
+		}
+		if user.Email != email || !user.IsEmailVerified || user.FirstName != "Ada" || user.LastName != "Lovelace" {
+			t.Errorf("new user = %+v", user)
+		}
+		if identities := linkedIdentities(t, subject); len(identities) != 1 || identities[0].UserID != user.UserID {
+			t.Fatalf("identities = %+v, want one linked to the new user", identities)
+		}
+
+		// The next login finds the linked identity
+		again, err := socialLogin(t, provider, subject, claims, nil)
+		if err != nil {
+			t.Fatalf("second FinishSocialLogin: %v", err)
+		}
+		if again.UserID != user.UserID {
+			t.Errorf("second login signed in %s, want %s", again.UserID, user.UserID)
+		}
+		if identities := linkedIdentities(t, subject); len(identities) != 1 {
+			t.Errorf("second login left %d identities, want 1", len(identities))
+		}
+	})
+
+	t.Run("links an account by verified email", func(t *testing.T) {
+		existing := testutil.CreateUser(t, "correct horse battery staple", true)
+		subject := uuid.NewString()
+
+		user, err := socialLogin(t, provider, subject, jwt.MapClaims{"email": existing.Email, "email_verified": true}, nil)
+		if err != nil {
+			t.Fatalf("FinishSocialLogin: %v", err)
+		}
+		if user.UserID != existing.UserID {
+			t.Errorf("signed in %s, want the existing account %s", user.UserID, existing.UserID)
+		}
+		if identities := linkedIdentities(t, subject); len(identities) != 1 || identities[0].UserID != existing.UserID {
+			t.Errorf("identities = %+v, want one linked to the existing account", identities)
+		}
+	})
+
+	t.Run("rejects an email the provider has not verified", func(t *testing.T) {
+		subject, email := uuid.NewString(), newEmail()
+
+		_, err := socialLogin(t, provider, subject, jwt.MapClaims{"email": email, "email_verified": false}, nil)
+		if !errors.Is(err, ErrSocialEmailNotVerified) {
+			t.Fatalf("FinishSocialLogin = %v, want %v", err, ErrSocialEmailNotVerified)
+		}
+
+		var count int64
+		if err := db.GetDBInstance().Model(&models.User{}).Where("email = ?", email).Count(&count).Error; err != nil {
+			t.Fatal(err)
+		}
+		if count != 0 || len(linkedIdentities(t, subject)) != 0 {
+			t.Error("an account or identity was created for an unverified email")
+		}
+	})
+
+	t.Run("does not link an unverified account", func(t *testing.T) {
+		existing := testutil.CreateUser(t, "correct horse battery staple", false)
+		subject := uuid.NewString()
+
+		_, err := socialLogin(t, provider, subject, jwt.MapClaims{"email": existing.Email, "email_verified": true}, nil)
+		if !errors.Is(err, ErrSocialAccountConflict) {
+			t.Fatalf("FinishSocialLogin = %v, want %v", err, ErrSocialAccountConflict)
+		}
+		if len(linkedIdentities(t, subject)) != 0 {
+			t.Error("the identity was linked to an unverified account")
+		}
+	})
+
+	t.Run("state is single use", func(t *testing.T) {
+		authorizationURL, state, err := BeginSocialLogin(testProvider)
+		if err != nil {
+			t.Fatalf("BeginSocialLogin: %v", err)
+		}
+		_, code := provider.Authorize(t, authorizationURL, uuid.NewString(), jwt.MapClaims{"email": newEmail(), "email_verified": true})
+
+		if _, err := FinishSocialLogin(testProvider, state, code); err != nil {
+			t.Fatalf("FinishSocialLogin: %v", err)
+		}
+		if _, err := FinishSocialLogin(testProvider, state, code); !errors.Is(err, ErrSocialLoginSessionInvalid) {
+			t.Errorf("replayed FinishSocialLogin = %v, want %v", err, ErrSocialLoginSessionInvalid)
+		}
+		if _, err := FinishSocialLogin(testProvider, "unknown-state", code); !errors.Is(err, ErrSocialLoginSessionInvalid) {
+			t.Errorf("FinishSocialLogin with an unknown state = %v, want %v", err, ErrSocialLoginSessionInvalid)
+		}
+	})
+
+	t.Run("rejects the nonce of another login", func(t *testing.T) {
+		claims := jwt.MapClaims{"email": newEmail(), "email_verified": true, "nonce": "nonce-of-another-login"}
+		if _, err := socialLogin(t, provider, uuid.NewString(), claims, nil); !errors.Is(err, connector.ErrInvalidIDToken) {
+			t.Errorf("FinishSocialLogin = %v, want %v", err, connector.ErrInvalidIDToken)
+		}
+	})
+
+	t.Run("sends the PKCE verifier of the login", func(t *testing.T) {
+		// A code issued for another challenge cannot be redeemed with this login's verifier
+		other := strings.Repeat("A", 43)
+		tamper := func(query url.Values) { query.Set("code_challenge", other) }
+
+		claims := jwt.MapClaims{"email": newEmail(), "email_verified": true}
+		if _, err := socialLogin(t, provider, uuid.NewString(), claims, tamper); err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+			t.Errorf("FinishSocialLogin = %v, want the provider's invalid_grant", err)
+		}
+	})
+}
@@ -0,0 +1,383 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Debt-Solvers/BE-auth-service/configs"
+	"github.com/Debt-Solvers/BE-auth-service/db"
+	"github.com/Debt-Solvers/BE-auth-service/internal/models"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Ceremony names stored with a WebAuthnSession
+const (
+	CeremonyRegistration = "registration"
+	CeremonyLogin        = "login"
+)
+
+var (
+	// ErrWebAuthnSessionInvalid is returned when a finish call references an unknown, expired or mismatched ceremony
+	ErrWebAuthnSessionInvalid = errors.New("passkey ceremony has expired or is invalid")
+	// ErrWebAuthnCloneDetected is returned when a credential's signature counter goes backwards
+	ErrWebAuthnCloneDetected = errors.New("passkey signature counter indicates a cloned authenticator")
+)
+
+var (
+	relyingParty     *webauthn.WebAuthn
+	relyingPartyErr  error
+	relyingPartyOnce sync.Once
+)
+
+// GetWebAuthn returns the relying party configured from configs.Config
+func GetWebAuthn() (*webauthn.WebAuthn, error) {
+	relyingPartyOnce.Do(func() {
+		config := configs.GetConfig().WebAuthn
+		relyingParty, relyingPartyErr = webauthn.New(&webauthn.Config{
+			RPID:          config.RPID,
+			RPDisplayName: config.RPDisplayName,
+			RPOrigins:     config.RPOrigins,
+			// Login only offers discoverable credentials, so every passkey must be one
+			AuthenticatorSelection: protocol.AuthenticatorSelection{
+				ResidentKey:      protocol.ResidentKeyRequirementRequired,
+				UserVerification: protocol.VerificationPreferred,
+			},
+		})
+	})
+	return relyingParty, relyingPartyErr
+}
+
+// webAuthnUser adapts a user and their stored credentials to webauthn.User
+type webAuthnUser struct {
+	user        models.User
+	credentials []models.WebAuthnCredential
+}
+
+func (u *webAuthnUser) WebAuthnID() []byte {
+	return u.user.UserID[:]
+}
+
+func (u *webAuthnUser) WebAuthnName() string {
+	return u.user.Email
+}
+
+func (u *webAuthnUser) WebAuthnDisplayName() string {
+	return strings.TrimSpace(u.user.FirstName + " " + u.user.LastName)
+}
+
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, 0, len(u.credentials))
+	for _, stored := range u.credentials {
+		credentials = append(credentials, toLibraryCredential(stored))
+	}
+	return credentials
+}
+
+// loadWebAuthnUser loads a user together with their registered credentials
+func loadWebAuthnUser(tx *gorm.DB, userID uuid.UUID) (*webAuthnUser, error) {
+	var user models.User
+	if err := tx.Where("user_id = ?", userID).First(&user).Error; err != nil {
+		return nil, err
+	}
+
+	var credentials []models.WebAuthnCredential
+	if err := tx.Where("user_id = ?", userID).Find(&credentials).Error; err != nil {
+		return nil, err
+	}
+
+	return &webAuthnUser{user: user, credentials: credentials}, nil
+}
+
+// toLibraryCredential converts a stored credential into the form the webauthn library verifies against
+func toLibraryCredential(stored models.WebAuthnCredential) webauthn.Credential {
+	var transports []protocol.AuthenticatorTransport
+	for _, transport := range strings.Split(stored.Transports, ",") {
+		if transport != "" {
+			transports = append(transports, protocol.AuthenticatorTransport(transport))
+		}
+	}
+
+	return webauthn.Credential{
+		ID:              stored.CredentialID,
+		PublicKey:       stored.PublicKey,
+		AttestationType: stored.AttestationType,
+		Transport:       transports,
+		Flags: webauthn.CredentialFlags{
+			UserVerified:   stored.UserVerified,
+			BackupEligible: stored.BackupEligible,
+			BackupState:    stored.BackupState,
+		},
+		Authenticator: webauthn.Authenticator{
+			AAGUID:       stored.AAGUID,
+			SignCount:    uint32(stored.SignCount),
+			CloneWarning: stored.CloneWarning,
+		},
+	}
+}
+
+// saveWebAuthnSession stores ceremony state and returns the ID the client must send back on finish
+func saveWebAuthnSession(userID *uuid.UUID, ceremony string, session *webauthn.SessionData) (uuid.UUID, error) {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	// Clear out ceremonies nobody finished
+	if err := DB.Where("expires_at < ?", time.Now()).Delete(&models.WebAuthnSession{}).Error; err != nil {
+		return uuid.Nil, err
+	}
+
+	timeout := time.Duration(configs.GetConfig().WebAuthn.TimeoutMinutes) * time.Minute
+	stored := models.WebAuthnSession{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Ceremony:  ceremony,
+		Data:      data,
+		ExpiresAt: time.Now().Add(timeout),
+	}
+	if err := DB.Create(&stored).Error; err != nil {
+		return uuid.Nil, err
+	}
+	return stored.ID, nil
+}
+
+// consumeWebAuthnSession loads and deletes ceremony state so each challenge can be answered only once
+func consumeWebAuthnSession(tx *gorm.DB, sessionID uuid.UUID, ceremony string) (*models.WebAuthnSession, *webauthn.SessionData, error) {
+	var stored models.WebAuthnSession
+	result := tx.Where("id = ? AND ceremony = ? AND expires_at > ?", sessionID, ceremony, time.Now()).First(&stored)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrWebAuthnSessionInvalid
+		}
+		return nil, nil, result.Error
+	}
+
+	deleted := tx.Delete(&stored)
+	if deleted.Error != nil {
+		return nil, nil, deleted.Error
+	}
+	if deleted.RowsAffected == 0 {
+		return nil, nil, ErrWebAuthnSessionInvalid // Someone else finished this ceremony first
+	}
+
+	var session webauthn.SessionData
+	if err := json.Unmarshal(stored.Data, &session); err != nil {
+		return nil, nil, err
+	}
+	return &stored, &session, nil
+}
+
+// BeginWebAuthnRegistration starts registering a new credential for the user
+func BeginWebAuthnRegistration(userID uuid.UUID) (*protocol.CredentialCreation, uuid.UUID, error) {
+	relyingParty, err := GetWebAuthn()
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+
+	user, err := loadWebAuthnUser(db.GetDBInstance(), userID)
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+
+	// Stop the authenticator from registering a credential it already holds for this account
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(user.credentials))
+	for _, credential := range user.WebAuthnCredentials() {
+		exclusions = append(exclusions, credential.Descriptor())
+	}
+
+	creation, session, err := relyingParty.BeginRegistration(user, webauthn.WithExclusions(exclusions))
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+
+	sessionID, err := saveWebAuthnSession(&userID, CeremonyRegistration, session)
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+	return creation, sessionID, nil
+}
+
+// FinishWebAuthnRegistration verifies the authenticator's attestation and stores the new credential
+func FinishWebAuthnRegistration(userID, sessionID uuid.UUID, name string, response []byte) (*models.WebAuthnCredential, error) {
+	relyingParty, err := GetWebAuthn()
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(response)
+	if err != nil {
+		return nil, err
+	}
+
+	// The challenge is spent even if verification fails, so it cannot be retried
+	ceremony, session, err := consumeWebAuthnSession(db.GetDBInstance(), sessionID, CeremonyRegistration)
+	if err != nil {
+		return nil, err
+	}
+	if ceremony.UserID == nil || *ceremony.UserID != userID {
+		return nil, ErrWebAuthnSessionInvalid
+	}
+
+	var stored models.WebAuthnCredential
+	err = db.GetDBInstance().Transaction(func(tx *gorm.DB) error {
+
+		user, err := loadWebAuthnUser(tx, userID)
+		if err != nil {
+			return err
+		}
+
+		credential, err := relyingParty.CreateCredential(user, *session, parsed)
+		if err != nil {
+			return err
+		}
+
+		transports := make([]string, 0, len(credential.Transport))
+		for _, transport := range credential.Transport {
+			transports = append(transports, string(transport))
+		}
+
+		stored = models.WebAuthnCredential{
+			ID:              uuid.New(),
+			UserID:          userID,
+			Name:            name,
+			CredentialID:    credential.ID,
+			PublicKey:       credential.PublicKey,
+			AttestationType: credential.AttestationType,
+			Transports:      strings.Join(transports, ","),
+			AAGUID:          credential.Authenticator.AAGUID,
+			SignCount:       int64(credential.Authenticator.SignCount),
+			UserVerified:    credential.Flags.UserVerified,
+			BackupEligible:  credential.Flags.BackupEligible,
+			BackupState:     credential.Flags.BackupState,
+			CreatedAt:       time.Now(),
+		}
+		return tx.Create(&stored).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &stored, nil
+}
+
+// BeginWebAuthnLogin starts an assertion that asks the authenticator for any discoverable passkey
+// for this relying party. It never names a user, so the options do not reveal which accounts exist
+// or which credentials they hold.
+func BeginWebAuthnLogin() (*protocol.CredentialAssertion, uuid.UUID, error) {
+	relyingParty, err := GetWebAuthn()
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+
+	assertion, session, err := relyingParty.BeginDiscoverableLogin()
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+
+	sessionID, err := saveWebAuthnSession(nil, CeremonyLogin, session)
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+	return assertion, sessionID, nil
+}
+
+// FinishWebAuthnLogin verifies an assertion, updates the credential's sign count and returns the authenticated user's ID
+func FinishWebAuthnLogin(sessionID uuid.UUID, response []byte) (uuid.UUID, error) {
+	relyingParty, err := GetWebAuthn()
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	// The challenge is spent even if verification fails, so it cannot be retried
+	_, session, err := consumeWebAuthnSession(db.GetDBInstance(), sessionID, CeremonyLogin)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	var userID uuid.UUID
+	err = db.GetDBInstance().Transaction(func(tx *gorm.DB) error {
+		var user *webAuthnUser
+		// The user handle returned by the authenticator is the user's ID
+		credential, err := relyingParty.ValidateDiscoverableLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+			handleID, err := uuid.FromBytes(userHandle)
+			if err != nil {
+				return nil, err
+			}
+			user, err = loadWebAuthnUser(tx, handleID)
+			return user, err
+		}, *session, parsed)
+		if err != nil {
+			return err
+		}
+
+		if credential.Authenticator.CloneWarning {
+			return ErrWebAuthnCloneDetected
+		}
+
+		now := time.Now()
+		if err := tx.Model(&models.WebAuthnCredential{}).
+			Where("credential_id = ? AND user_id = ?", credential.ID, user.user.UserID).
+			Updates(map[string]interface{}{
+				"sign_count":   int64(credential.Authenticator.SignCount),
+				"backup_state": credential.Flags.BackupState,
+				"last_used_at": now,
+			}).Error; err != nil {
+			return err
+		}
+
+		userID = user.user.UserID
+		return nil
+	})
+	if errors.Is(err, ErrWebAuthnCloneDetected) {
+		// Flag the credential so it shows up in the user's credential list
+		if err := db.GetDBInstance().Model(&models.WebAuthnCredential{}).
+			Where("credential_id = ?", parsed.RawID).
+			Update("clone_warning", true).Error; err != nil {
+			return uuid.Nil, err
+		}
+		return uuid.Nil, ErrWebAuthnCloneDetected
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return userID, nil
+}
+
+// ListWebAuthnCredentials returns the user's registered credentials
+func ListWebAuthnCredentials(userID uuid.UUID) ([]models.WebAuthnCredential, error) {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	var credentials []models.WebAuthnCredential
+	err := DB.Where("user_id = ?", userID).Order("created_at").Find(&credentials).Error
+	return credentials, err
+}
+
+// DeleteWebAuthnCredential removes one of the user's credentials
+func DeleteWebAuthnCredential(userID, credentialID uuid.UUID) error {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	result := DB.Where("id = ? AND user_id = ?", credentialID, userID).Delete(&models.WebAuthnCredential{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
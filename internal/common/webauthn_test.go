@@ -0,0 +1,144 @@
+package common
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Debt-Solvers/BE-auth-service/configs"
+	"github.com/Debt-Solvers/BE-auth-service/db"
+	"github.com/Debt-Solvers/BE-auth-service/internal/models"
+	"github.com/Debt-Solvers/BE-auth-service/internal/testutil"
+
+	"github.com/google/uuid"
+)
+
+// registerPasskey runs a registration ceremony for the user with a new software authenticator
+func registerPasskey(t *testing.T, userID uuid.UUID) (*testutil.Authenticator, *models.WebAuthnCredential) {
+	t.Helper()
+
+	authenticator, err := testutil.NewAuthenticator(configs.GetConfig().WebAuthn.RPOrigins[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	creation, sessionID, err := BeginWebAuthnRegistration(userID)
+	if err != nil {
+		t.Fatalf("BeginWebAuthnRegistration: %v", err)
+	}
+	response, err := authenticator.Register(creation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credential, err := FinishWebAuthnRegistration(userID, sessionID, "Test key", response)
+	if err != nil {
+		t.Fatalf("FinishWebAuthnRegistration: %v", err)
+	}
+	return authenticator, credential
+}
+
+// loginWithPasskey runs a discoverable login ceremony
+func loginWithPasskey(t *testing.T, authenticator *testutil.Authenticator) (uuid.UUID, error) {
+	t.Helper()
+
+	assertion, sessionID, err := BeginWebAuthnLogin()
+	if err != nil {
+		t.Fatalf("BeginWebAuthnLogin: %v", err)
+	}
+	response, err := authenticator.Login(assertion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return FinishWebAuthnLogin(sessionID, response)
+}
+
+// storedCredential reloads a credential to see what the ceremonies recorded
+func storedCredential(t *testing.T, id uuid.UUID) models.WebAuthnCredential {
+	t.Helper()
+
+	var credential models.WebAuthnCredential
+	if err := db.GetDBInstance().Where("id = ?", id).First(&credential).Error; err != nil {
+		t.Fatal(err)
+	}
+	return credential
+}
+
+func TestWebAuthnRegistrationAndLogin(t *testing.T) {
+	testutil.Database(t)
+	user := testutil.CreateUser(t, "correct horse battery staple", true)
+
+	authenticator, credential := registerPasskey(t, user.UserID)
+	if credential.UserID != user.UserID || credential.Name != "Test key" {
+		t.Fatalf("registered credential = %+v", credential)
+	}
+	if !credential.UserVerified {
+		t.Error("registered credential is not marked user verified")
+	}
+
+	// The counter is tracked across logins
+	for _, signCount := range []uint32{1, 7} {
+		authenticator.SignCount = signCount
+		loggedIn, err := loginWithPasskey(t, authenticator)
+		if err != nil {
+			t.Fatalf("FinishWebAuthnLogin: %v", err)
+		}
+		if loggedIn != user.UserID {
+			t.Errorf("logged in as %s, want %s", loggedIn, user.UserID)
+		}
+
+		stored := storedCredential(t, credential.ID)
+		if stored.SignCount != int64(signCount) {
+			t.Errorf("sign count = %d, want %d", stored.SignCount, signCount)
+		}
+		if stored.LastUsedAt == nil {
+			t.Error("last use was not recorded")
+		}
+	}
+}
+
+func TestWebAuthnCloneDetection(t *testing.T) {
+	testutil.Database(t)
+	user := testutil.CreateUser(t, "correct horse battery staple", true)
+	authenticator, credential := registerPasskey(t, user.UserID)
+
+	authenticator.SignCount = 5
+	if _, err := loginWithPasskey(t, authenticator); err != nil {
+		t.Fatalf("FinishWebAuthnLogin: %v", err)
+	}
+
+	// A copy of the key that has signed less often than the original
+	authenticator.SignCount = 3
+	if _, err := loginWithPasskey(t, authenticator); !errors.Is(err, ErrWebAuthnCloneDetected) {
+		t.Fatalf("FinishWebAuthnLogin with a lower counter = %v, want %v", err, ErrWebAuthnCloneDetected)
+	}
+
+	stored := storedCredential(t, credential.ID)
+	if !stored.CloneWarning {
+		t.Error("credential was not flagged as cloned")
+	}
+	if stored.SignCount != 5 {
+		t.Errorf("sign count = %d, want it to stay at 5", stored.SignCount)
+	}
+}
+
+func TestWebAuthnCeremonyIsSingleUse(t *testing.T) {
+	testutil.Database(t)
+	user := testutil.CreateUser(t, "correct horse battery staple", true)
+	authenticator, _ := registerPasskey(t, user.UserID)
+
+	assertion, sessionID, err := BeginWebAuthnLogin()
+	if err != nil {
+		t.Fatalf("BeginWebAuthnLogin: %v", err)
+	}
+	authenticator.SignCount = 1
+	response, err := authenticator.Login(assertion)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := FinishWebAuthnLogin(sessionID, response); err != nil {
+		t.Fatalf("FinishWebAuthnLogin: %v", err)
+	}
+	if _, err := FinishWebAuthnLogin(sessionID, response); !errors.Is(err, ErrWebAuthnSessionInvalid) {
+		t.Errorf("replayed FinishWebAuthnLogin = %v, want %v", err, ErrWebAuthnSessionInvalid)
+	}
+}
@@ -0,0 +1,228 @@
+// Package connector signs users in through external OpenID Connect providers such as Google or Apple.
+package connector
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Debt-Solvers/BE-auth-service/configs"
+)
+
+// httpTimeout bounds every request to a provider
+const httpTimeout = 10 * time.Second
+
+var (
+	// ErrUnknownProvider is returned for providers that are not configured or have no client ID
+	ErrUnknownProvider = errors.New("unknown login provider")
+	// ErrInvalidIDToken is returned when the provider's ID token fails verification
+	ErrInvalidIDToken = errors.New("invalid ID token")
+)
+
+// Identity is what the provider asserted about the user
+type Identity struct {
+	Subject       string // Stable user ID at the provider
+	Email         string
+	EmailVerified bool
+	GivenName     string
+	FamilyName    string
+}
+
+// metadata is the part of the provider's discovery document the connector needs
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Connector runs the authorization code flow against one provider
+type Connector struct {
+	Name   string
+	config configs.SocialLoginProvider
+	client *http.Client
+
+	mu            sync.Mutex
+	metadata      *metadata
+	keys          map[string]interface{}
+	keysFetchedAt time.Time
+}
+
+// New creates a connector for a provider. A nil client uses one with a short timeout.
+func New(name string, config configs.SocialLoginProvider, client *http.Client) *Connector {
+	if client == nil {
+		client = &http.Client{Timeout: httpTimeout}
+	}
+	return &Connector{Name: name, config: config, client: client}
+}
+
+// DisplayName returns the name shown to users, falling back to the provider key
+func (c *Connector) DisplayName() string {
+	if c.config.DisplayName != "" {
+		return c.config.DisplayName
+	}
+	return c.Name
+}
+
+var (
+	connectors   map[string]*Connector
+	connectorsMu sync.Mutex
+)
+
+// Get returns the connector for a configured provider
+func Get(name string) (*Connector, error) {
+	connectorsMu.Lock()
+	defer connectorsMu.Unlock()
+
+	connector, ok := loadConnectors()[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return connector, nil
+}
+
+// Providers returns the enabled connectors sorted by name
+func Providers() []*Connector {
+	connectorsMu.Lock()
+	defer connectorsMu.Unlock()
+
+	list := make([]*Connector, 0, len(connectors))
+	for _, connector := range loadConnectors() {
+		list = append(list, connector)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// loadConnectors creates a connector for every enabled provider on first use. The caller holds connectorsMu.
+func loadConnectors() map[string]*Connector {
+	if connectors == nil {
+		connectors = make(map[string]*Connector)
+		for name, config := range configs.GetConfig().SocialLogin.Providers {
+			if config.ClientID != "" && config.Issuer != "" {
+				connectors[name] = New(name, config, nil)
+			}
+		}
+	}
+	return connectors
+}
+
+// AuthorizationURL returns the provider URL the user is sent to. The state, nonce and PKCE challenge
+// come back to us with the code and in the ID token.
+func (c *Connector) AuthorizationURL(state, nonce, codeChallenge string) (string, error) {
+	meta, err := c.discover()
+	if err != nil {
+		return "", err
+	}
+
+	target, err := url.Parse(meta.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid authorization endpoint: %w", err)
+	}
+
+	query := target.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", c.config.ClientID)
+	query.Set("redirect_uri", c.config.RedirectURL)
+	query.Set("scope", strings.Join(append([]string{"openid"}, c.config.Scopes...), " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+	if c.config.ResponseMode != "" {
+		query.Set("response_mode", c.config.ResponseMode)
+	}
+	target.RawQuery = query.Encode()
+	return target.String(), nil
+}
+
+// Exchange redeems an authorization code and returns the identity from the verified ID token
+func (c *Connector) Exchange(code, codeVerifier, nonce string) (*Identity, error) {
+	meta, err := c.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {c.config.RedirectURL},
+		"code_verifier": {codeVerifier},
+		"client_id":     {c.config.ClientID},
+	}
+	if c.config.ClientSecret != "" {
+		form.Set("client_secret", c.config.ClientSecret)
+	}
+
+	resp, err := c.client.PostForm(meta.TokenEndpoint, form)
+	if err != nil {
+		return nil, fmt.Errorf("token request to %s failed: %w", c.Name, err)
+	}
+	defer resp.Body.Close()
+
+	var tokenResp struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&tokenResp); err != nil {
+		return nil, fmt.Errorf("could not read token response from %s: %w", c.Name, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token request to %s failed: %s %s", c.Name, tokenResp.Error, tokenResp.ErrorDescription)
+	}
+	if tokenResp.IDToken == "" {
+		return nil, fmt.Errorf("%w: %s returned no ID token", ErrInvalidIDToken, c.Name)
+	}
+
+	return c.verifyIDToken(meta, tokenResp.IDToken, nonce)
+}
+
+// discover loads the provider's discovery document once
+func (c *Connector) discover() (*metadata, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.metadata != nil {
+		return c.metadata, nil
+	}
+
+	var meta metadata
+	if err := c.getJSON(strings.TrimSuffix(c.config.Issuer, "/")+"/.well-known/openid-configuration", &meta); err != nil {
+		return nil, err
+	}
+	// OpenID Connect Discovery section 4.3: the document must belong to the configured issuer
+	if meta.Issuer != c.config.Issuer {
+		return nil, fmt.Errorf("%s discovery document is for issuer %q, expected %q", c.Name, meta.Issuer, c.config.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, fmt.Errorf("%s discovery document is missing endpoints", c.Name)
+	}
+
+	c.metadata = &meta
+	return c.metadata, nil
+}
+
+// getJSON fetches and decodes a JSON document from the provider
+func (c *Connector) getJSON(target string, v interface{}) error {
+	resp, err := c.client.Get(target)
+	if err != nil {
+		return fmt.Errorf("request to %s failed: %w", c.Name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s for %s", c.Name, resp.Status, target)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v); err != nil {
+		return fmt.Errorf("could not read %s from %s: %w", target, c.Name, err)
+	}
+	return nil
+}
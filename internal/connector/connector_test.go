@@ -0,0 +1,149 @@
+package connector
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Debt-Solvers/BE-auth-service/internal/testutil"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testState    = "state-0123456789"
+	testNonce    = "nonce-0123456789"
+	testVerifier = "verifier-0123456789-0123456789-0123456789-0123456789"
+)
+
+// codeChallenge is the PKCE S256 challenge for a verifier
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// authorize sends the user to the provider with testState, testNonce and testVerifier and returns
+// the code the provider hands back for the subject
+func authorize(t *testing.T, provider *testutil.IdentityProvider, conn *Connector, subject string, claims jwt.MapClaims) string {
+	t.Helper()
+
+	authorizationURL, err := conn.AuthorizationURL(testState, testNonce, codeChallenge(testVerifier))
+	if err != nil {
+		t.Fatalf("AuthorizationURL: %v", err)
+	}
+	state, code := provider.Authorize(t, authorizationURL, subject, claims)
+	if state != testState {
+		t.Fatalf("state = %q, want %q", state, testState)
+	}
+	return code
+}
+
+func TestAuthorizationURL(t *testing.T) {
+	provider := testutil.NewIdentityProvider(t)
+	conn := New("test", provider.Config(), nil)
+
+	authorizationURL, err := conn.AuthorizationURL(testState, testNonce, codeChallenge(testVerifier))
+	if err != nil {
+		t.Fatalf("AuthorizationURL: %v", err)
+	}
+	target, err := url.Parse(authorizationURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(authorizationURL, provider.URL+"/authorize?") {
+		t.Errorf("authorization URL %s is not the provider's authorization endpoint", authorizationURL)
+	}
+	for name, want := range map[string]string{
+		"response_type":         "code",
+		"client_id":             provider.ClientID,
+		"redirect_uri":          provider.RedirectURL,
+		"scope":                 "openid email profile",
+		"state":                 testState,
+		"nonce":                 testNonce,
+		"code_challenge":        codeChallenge(testVerifier),
+		"code_challenge_method": "S256",
+	} {
+		if got := target.Query().Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestExchange(t *testing.T) {
+	provider := testutil.NewIdentityProvider(t)
+	conn := New("test", provider.Config(), nil)
+
+	code := authorize(t, provider, conn, "subject-1", jwt.MapClaims{
+		"email":          "user@example.com",
+		"email_verified": "true", // As Apple sends it
+		"given_name":     "Ada",
+		"family_name":    "Lovelace",
+	})
+	identity, err := conn.Exchange(code, testVerifier, testNonce)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+
+	want := Identity{Subject: "subject-1", Email: "user@example.com", EmailVerified: true, GivenName: "Ada", FamilyName: "Lovelace"}
+	if *identity != want {
+		t.Errorf("identity = %+v, want %+v", *identity, want)
+	}
+
+	// Codes are single use at the provider
+	if _, err := conn.Exchange(code, testVerifier, testNonce); err == nil {
+		t.Error("a redeemed code was accepted again")
+	}
+}
+
+func TestExchangeRejectsWrongPKCEVerifier(t *testing.T) {
+	provider := testutil.NewIdentityProvider(t)
+	conn := New("test", provider.Config(), nil)
+
+	code := authorize(t, provider, conn, "subject-1", nil)
+	_, err := conn.Exchange(code, "another-verifier-0123456789-0123456789-0123456789", testNonce)
+	if err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Errorf("Exchange with the wrong verifier = %v, want the provider's invalid_grant", err)
+	}
+}
+
+func TestExchangeRejectsInvalidIDTokens(t *testing.T) {
+	now := time.Now()
+	for _, test := range []struct {
+		name   string
+		claims jwt.MapClaims
+	}{
+		{"nonce of another login", jwt.MapClaims{"nonce": "nonce-of-another-login"}},
+		{"missing nonce", jwt.MapClaims{"nonce": ""}},
+		{"another audience", jwt.MapClaims{"aud": "another-client"}},
+		{"another authorized party", jwt.MapClaims{"azp": "another-client"}},
+		{"another issuer", jwt.MapClaims{"iss": "https://issuer.example.com"}},
+		{"expired", jwt.MapClaims{"iat": now.Add(-2 * time.Hour).Unix(), "exp": now.Add(-time.Hour).Unix()}},
+		{"missing subject", jwt.MapClaims{"sub": ""}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			provider := testutil.NewIdentityProvider(t)
+			conn := New("test", provider.Config(), nil)
+
+			code := authorize(t, provider, conn, "subject-1", test.claims)
+			if _, err := conn.Exchange(code, testVerifier, testNonce); !errors.Is(err, ErrInvalidIDToken) {
+				t.Errorf("Exchange = %v, want %v", err, ErrInvalidIDToken)
+			}
+		})
+	}
+}
+
+func TestDiscoveryMustMatchIssuer(t *testing.T) {
+	provider := testutil.NewIdentityProvider(t)
+	config := provider.Config()
+	config.Issuer += "/"
+	conn := New("test", config, nil)
+
+	if _, err := conn.AuthorizationURL(testState, testNonce, codeChallenge(testVerifier)); err == nil {
+		t.Error("a discovery document for another issuer was accepted")
+	}
+}
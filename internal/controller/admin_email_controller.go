@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Debt-Solvers/BE-auth-service/internal/common"
+	"github.com/Debt-Solvers/BE-auth-service/internal/models"
+	"github.com/Debt-Solvers/BE-auth-service/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ListOutboxEmails returns recent outbox entries; ?status=pending|sent|dead filters them and ?limit= caps the list (default 50)
+func ListOutboxEmails(c *gin.Context) {
+	status := c.Query("status")
+	if status != "" && status != models.EmailStatusPending && status != models.EmailStatusSent && status != models.EmailStatusDead {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid status", nil, nil)
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 500 {
+		utils.SendResponse(c, http.StatusBadRequest, "Limit must be between 1 and 500", nil, nil)
+		return
+	}
+
+	emails, err := common.ListOutboxEmails(status, limit)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Could not retrieve emails", nil, nil)
+		return
+	}
+
+	// Bodies are left out, they can contain reset codes and verification links
+	emailList := make([]gin.H, 0, len(emails))
+	for _, email := range emails {
+		emailList = append(emailList, gin.H{
+			"id":              email.EmailID,
+			"template":        email.Template,
+			"recipient":       email.Recipient,
+			"subject":         email.Subject,
+			"status":          email.Status,
+			"attempts":        email.Attempts,
+			"last_error":      email.LastError,
+			"next_attempt_at": email.NextAttemptAt,
+			"created_at":      email.CreatedAt,
+			"sent_at":         email.SentAt,
+		})
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Emails retrieved successfully", gin.H{"emails": emailList}, nil)
+}
+
+// RetryOutboxEmail queues a dead email for delivery again
+func RetryOutboxEmail(c *gin.Context) {
+	emailID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid email ID", nil, nil)
+		return
+	}
+
+	adminID := c.MustGet("userId").(uuid.UUID)
+
+	if err := common.RetryOutboxEmail(adminID, emailID); err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			utils.SendResponse(c, http.StatusNotFound, "Email not found", nil, nil)
+		case errors.Is(err, common.ErrEmailNotRetryable):
+			utils.SendResponse(c, http.StatusConflict, "Only dead emails can be retried", nil, nil)
+		default:
+			utils.SendResponse(c, http.StatusInternalServerError, "Could not retry email", nil, nil)
+		}
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Email queued for delivery", nil, nil)
+}
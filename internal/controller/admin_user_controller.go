@@ -0,0 +1,219 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Debt-Solvers/BE-auth-service/internal/common"
+	"github.com/Debt-Solvers/BE-auth-service/internal/models"
+	"github.com/Debt-Solvers/BE-auth-service/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SearchUsers returns a page of users matching the search, for support and admins
+func SearchUsers(c *gin.Context) {
+	var search models.AdminUserSearch
+	if err := c.ShouldBindQuery(&search); err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid request data", nil, gin.H{"error": err.Error()})
+		return
+	}
+	adminID := c.MustGet("userId").(uuid.UUID)
+
+	users, total, err := common.SearchUsers(adminID, search)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Could not retrieve users", nil, nil)
+		return
+	}
+
+	userList := make([]gin.H, 0, len(users))
+	for _, user := range users {
+		userList = append(userList, adminUserResponse(user))
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Users retrieved successfully", gin.H{"users": userList, "total": total}, nil)
+}
+
+// GetUser returns one user along with their roles, second factor and session count
+func GetUser(c *gin.Context) {
+	userID, ok := adminUserID(c)
+	if !ok {
+		return
+	}
+	adminID := c.MustGet("userId").(uuid.UUID)
+
+	user, err := common.GetUserForAdmin(adminID, userID)
+	if err != nil {
+		sendAdminUserError(c, err, "Could not retrieve user")
+		return
+	}
+	roles, _, err := common.GetUserRoles(userID)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Could not retrieve user", nil, nil)
+		return
+	}
+	mfaEnabled, err := common.IsMFAEnabled(userID)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Could not retrieve user", nil, nil)
+		return
+	}
+	sessions, err := common.CountActiveSessions(userID)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Could not retrieve user", nil, nil)
+		return
+	}
+
+	data := adminUserResponse(*user)
+	data["roles"] = roles
+	data["mfa_enabled"] = mfaEnabled
+	data["active_sessions"] = sessions
+	utils.SendResponse(c, http.StatusOK, "User retrieved successfully", data, nil)
+}
+
+// DisableUser blocks sign-in to an account and ends its sessions
+func DisableUser(c *gin.Context) {
+	setUserDisabled(c, true)
+}
+
+// EnableUser lets a disabled account sign in again
+func EnableUser(c *gin.Context) {
+	setUserDisabled(c, false)
+}
+
+func setUserDisabled(c *gin.Context, disabled bool) {
+	userID, ok := adminUserID(c)
+	if !ok {
+		return
+	}
+	adminID := c.MustGet("userId").(uuid.UUID)
+
+	if err := common.SetUserDisabled(adminID, userID, disabled); err != nil {
+		sendAdminUserError(c, err, "Could not update user")
+		return
+	}
+
+	if disabled {
+		utils.SendResponse(c, http.StatusOK, "User disabled successfully", nil, nil)
+	} else {
+		utils.SendResponse(c, http.StatusOK, "User enabled successfully", nil, nil)
+	}
+}
+
+// ForcePasswordReset signs a user out and makes them choose a new password before signing in again
+func ForcePasswordReset(c *gin.Context) {
+	userID, ok := adminUserID(c)
+	if !ok {
+		return
+	}
+	adminID := c.MustGet("userId").(uuid.UUID)
+
+	if err := common.ForcePasswordReset(adminID, userID); err != nil {
+		sendAdminUserError(c, err, "Could not reset password")
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Password reset required, a reset code was sent to the user", nil, nil)
+}
+
+// MarkEmailVerified verifies a user's email address on their behalf
+func MarkEmailVerified(c *gin.Context) {
+	userID, ok := adminUserID(c)
+	if !ok {
+		return
+	}
+	adminID := c.MustGet("userId").(uuid.UUID)
+
+	if err := common.MarkEmailVerified(adminID, userID); err != nil {
+		sendAdminUserError(c, err, "Could not verify email")
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Email marked as verified", nil, nil)
+}
+
+// UnlockUserLogin lifts a login lock on a user's email address and forgets the failed attempts
+func UnlockUserLogin(c *gin.Context) {
+	userID, ok := adminUserID(c)
+	if !ok {
+		return
+	}
+	adminID := c.MustGet("userId").(uuid.UUID)
+
+	if err := common.UnlockLogin(adminID, userID); err != nil {
+		sendAdminUserError(c, err, "Could not unlock login")
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Login unlocked successfully", nil, nil)
+}
+
+// RevokeAllUserSessions signs a user out on every device
+func RevokeAllUserSessions(c *gin.Context) {
+	userID, ok := adminUserID(c)
+	if !ok {
+		return
+	}
+	adminID := c.MustGet("userId").(uuid.UUID)
+
+	if err := common.RevokeAllUserSessions(adminID, userID); err != nil {
+		sendAdminUserError(c, err, "Could not revoke sessions")
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Sessions revoked successfully", nil, nil)
+}
+
+// DeleteUser removes an account and all of its data
+func DeleteUser(c *gin.Context) {
+	userID, ok := adminUserID(c)
+	if !ok {
+		return
+	}
+	adminID := c.MustGet("userId").(uuid.UUID)
+
+	if err := common.DeleteUser(adminID, userID); err != nil {
+		sendAdminUserError(c, err, "Could not delete user")
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "User deleted successfully", nil, nil)
+}
+
+// adminUserID parses the user ID in the path. ok is false once a response was written.
+func adminUserID(c *gin.Context) (uuid.UUID, bool) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid user ID", nil, nil)
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+// sendAdminUserError maps admin user management errors to responses
+func sendAdminUserError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		utils.SendResponse(c, http.StatusNotFound, "User not found", nil, nil)
+	case errors.Is(err, common.ErrSelfAdminAction), errors.Is(err, common.ErrLastAdmin):
+		utils.SendResponse(c, http.StatusConflict, err.Error(), nil, nil)
+	default:
+		utils.SendResponse(c, http.StatusInternalServerError, message, nil, nil)
+	}
+}
+
+// adminUserResponse lists the fields of a user shown to admins
+func adminUserResponse(user models.User) gin.H {
+	return gin.H{
+		"user_id":                 user.UserID,
+		"email":                   user.Email,
+		"first_name":              user.FirstName,
+		"last_name":               user.LastName,
+		"is_email_verified":       user.IsEmailVerified,
+		"created_at":              user.CreatedAt,
+		"disabled_at":             user.DisabledAt,
+		"password_reset_required": user.PasswordResetRequired,
+		"password_breached_at":    user.PasswordBreachedAt,
+	}
+}
@@ -1,15 +1,23 @@
 package controller
 
 import (
+	"errors"
+	"log"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/Debt-Solvers/BE-auth-service/configs"
 	"github.com/Debt-Solvers/BE-auth-service/db"
 	"github.com/Debt-Solvers/BE-auth-service/internal/common"
+	"github.com/Debt-Solvers/BE-auth-service/internal/mailer"
 	"github.com/Debt-Solvers/BE-auth-service/internal/models"
+	"github.com/Debt-Solvers/BE-auth-service/internal/passwordpolicy"
 	"github.com/Debt-Solvers/BE-auth-service/utils"
 
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
@@ -23,15 +31,34 @@ func Signup(context *gin.Context) {
 		return
 	}
 	
-	// Call a model function to save the user
-	if err := user.CreateUser(); err != nil {
+	// Check the password against the policy before anything is stored
+	err := passwordpolicy.Validate(user.PasswordHash, passwordpolicy.PersonalInfo{Email: user.Email, FirstName: user.FirstName, LastName: user.LastName})
+	if sendPasswordPolicyError(context, err) {
+		return
+	}
+
+	// CreateUser replaces the password with its hash
+	password := user.PasswordHash
+
+	// Call a model function to save the user, queueing the verification email in the same transaction
+	err = db.GetDBInstance().Transaction(func(tx *gorm.DB) error {
+		if err := user.CreateUser(tx); err != nil {
+			return err
+		}
+		return queueVerificationEmail(tx, user)
+	})
+	if errors.Is(err, utils.ErrPasswordHashingBusy) {
+		sendPasswordHashingBusy(context)
+		return
+	}
+	if err != nil {
 		// If saving fails, send an error response
 		utils.SendResponse(context, http.StatusInternalServerError, "User could not be created", nil, gin.H{"error": err.Error()})
 		return
 	}
-	
+
 	// Send a success response with a simplified user representation (like user ID) or an empty object
-	utils.SendResponse(context, http.StatusCreated, "User registered successfully", gin.H{"userId": user.UserID}, nil)
+	utils.SendResponse(context, http.StatusCreated, "User registered successfully, please check your email to verify your address", withPasswordWarnings(gin.H{"userId": user.UserID}, password), nil)
 }
 
 // Login handles user login
@@ -48,37 +75,243 @@ func Login(context *gin.Context) {
 		return
 	}
 	
+	// Addresses with recent failed logins have to wait, whether or not an account uses them. The attempt
+	// counts as failed until the password turns out to be right.
+	retryAfter, err := common.ReserveLoginAttempt(loginReq.Email)
+	if err != nil {
+		utils.SendResponse(context, http.StatusInternalServerError, "Could not check login attempts", nil, nil)
+		return
+	}
+	if retryAfter > 0 {
+		sendLoginThrottled(context, retryAfter)
+		return
+	}
+
 	// Get User Email
 	var user models.User
 	if err := user.GetUserByEmail(loginReq.Email); err != nil {
-		utils.SendResponse(context, http.StatusUnauthorized, "Invalid credentials", nil, nil)
+		// Spend as long as a wrong password would, so the response time does not reveal unknown addresses
+		if err := utils.CheckDummyPassword(loginReq.Password); err != nil {
+			sendLoginHashingBusy(context, loginReq.Email)
+			return
+		}
+		sendInvalidCredentials(context)
 		return
 	}
 
 	// Check the password using the CheckPassword function
 	if err := utils.CheckPassword(user.PasswordHash, user.Salt, loginReq.Password); err != nil {
-		utils.SendResponse(context, http.StatusUnauthorized, "Invalid credentials", nil, nil)
+		if errors.Is(err, utils.ErrPasswordHashingBusy) {
+			sendLoginHashingBusy(context, loginReq.Email)
+			return
+		}
+		sendInvalidCredentials(context)
 		return
 	}
+	if err := common.ClearLoginFailures(loginReq.Email); err != nil {
+		log.Printf("Failed to clear failed logins: %v", err)
+	}
+	if err := common.UpgradePasswordHash(&user, loginReq.Password); err != nil {
+		log.Printf("Failed to upgrade the password hash: %v", err)
+	}
+	common.ScreenPassword(user, loginReq.Password)
 
-	// Generate JWT token
-	token, err := utils.GenerateToken(user.UserID) // Assuming user.UserID is a uuid.UUID
+	// Disabled accounts and accounts awaiting a forced reset are stopped before the second factor
+	if err := common.CheckAccountStatus(&user); err != nil {
+		utils.SendResponse(context, http.StatusForbidden, err.Error(), nil, nil)
+		return
+	}
+
+	// Depending on configuration, unverified accounts may not log in at all
+	if !user.IsEmailVerified && configs.GetConfig().EmailVerification.UnverifiedLogin == configs.UnverifiedLoginBlock {
+		utils.SendResponse(context, http.StatusForbidden, "Please verify your email address before logging in", nil, nil)
+		return
+	}
+
+	// Users with a second factor get a challenge instead of tokens
+	mfaEnabled, err := common.IsMFAEnabled(user.UserID)
+	if err != nil {
+		utils.SendResponse(context, http.StatusInternalServerError, "Could not check multi-factor authentication", nil, nil)
+		return
+	}
+	if mfaEnabled {
+		sendMFAChallenge(context, user.UserID, loginReq.DeviceName)
+		return
+	}
+
+	// Issue an access token and a refresh token for a new session
+	tokens, err := issueTokens(context, user.UserID, loginReq.DeviceName)
 	if err != nil {
-		utils.SendResponse(context, http.StatusInternalServerError, "Could not generate token", nil, nil)
+		sendIssueTokensError(context, err)
 		return
 	}
 
-	// Store Generated token in Auth_Token table
-	createdTime := time.Now() // Get the current time for when the token is created
-	expirationTime := time.Now().Add(time.Hour * 24) // Make a 24 hour expiration time
-	
-	err = common.StoreToken(user.UserID, token, createdTime, expirationTime)
+	tokens["userId"] = user.UserID
+	if user.PasswordBreachedAt != nil {
+		tokens["password_breached"] = true
+	}
+	utils.SendResponse(context, http.StatusOK, "Login successful", tokens, nil)
+}
+
+// RefreshToken exchanges a refresh token for a new access token and rotates the refresh token
+func RefreshToken(c *gin.Context) {
+	var refreshReq models.RefreshTokenRequest
+	if err := c.ShouldBindJSON(&refreshReq); err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid request data", nil, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Retire the presented token, get its successor and issue a new access token for the same family,
+	// all in one transaction
+	var token string
+	var issueErr error
+	refreshToken, newRefreshToken, err := common.RotateRefreshToken(refreshReq.RefreshToken, "", func(tx *gorm.DB, refreshToken *models.RefreshToken) error {
+		token, issueErr = generateAccessToken(refreshToken.UserID)
+		if issueErr != nil {
+			return issueErr
+		}
+
+		createdTime := time.Now()
+		return common.StoreFamilyToken(tx, &models.AuthToken{
+			UserID:    refreshToken.UserID,
+			FamilyID:  &refreshToken.FamilyID,
+			Token:     token,
+			UserAgent: c.Request.UserAgent(),
+			IPAddress: c.ClientIP(),
+			CreatedAt: createdTime,
+			ExpiresAt: createdTime.Add(utils.AccessTokenTTL()),
+		})
+	})
+	if err != nil {
+		switch {
+		case issueErr != nil:
+			sendIssueTokensError(c, issueErr)
+		case errors.Is(err, common.ErrRefreshTokenReused):
+			utils.SendResponse(c, http.StatusUnauthorized, "Refresh token has already been used, please log in again", nil, nil)
+		case errors.Is(err, common.ErrInvalidRefreshToken):
+			utils.SendResponse(c, http.StatusUnauthorized, "Invalid or expired refresh token", nil, nil)
+		default:
+			utils.SendResponse(c, http.StatusInternalServerError, "Could not refresh token", nil, nil)
+		}
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Token refreshed", gin.H{
+		"userId":        refreshToken.UserID,
+		"token":         token,
+		"refresh_token": newRefreshToken,
+		"expires_in":    int(utils.AccessTokenTTL().Seconds()),
+	}, nil)
+}
+
+// errEmailNotVerified stops token issuance for unverified accounts when logins are blocked until verification
+var errEmailNotVerified = errors.New("email address is not verified")
+
+// generateAccessToken generates an access token reflecting the user's current account state
+func generateAccessToken(userID uuid.UUID) (string, error) {
+	var user models.User
+	if err := db.GetDBInstance().Where("user_id = ?", userID).First(&user).Error; err != nil {
+		return "", err
+	}
+	if err := common.CheckAccountStatus(&user); err != nil {
+		return "", err
+	}
+
+	claims := jwt.MapClaims{}
+	if !user.IsEmailVerified {
+		if configs.GetConfig().EmailVerification.UnverifiedLogin == configs.UnverifiedLoginBlock {
+			return "", errEmailNotVerified
+		}
+		// Reduced-scope token, see middleware.RequireVerifiedEmail
+		claims["email_verified"] = false
+	}
+
+	// The role version lets middleware.RequirePermission notice roles that changed after issuance
+	roles, roleVersion, err := common.GetUserRoles(userID)
 	if err != nil {
-		utils.SendResponse(context, http.StatusInternalServerError, "Could not store token", nil, nil)
+		return "", err
+	}
+	claims["roles"] = roles
+	claims["role_version"] = roleVersion
+
+	return utils.GenerateTokenWithClaims(userID, claims)
+}
+
+// sendMFAChallenge answers a successful first login step with a challenge for the second factor
+func sendMFAChallenge(c *gin.Context, userID uuid.UUID, deviceName string) {
+	mfaToken, err := utils.GenerateMFAChallengeToken(userID, deviceName)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Could not generate token", nil, nil)
 		return
 	}
+	utils.SendResponse(c, http.StatusOK, "Multi-factor authentication required", gin.H{
+		"mfa_required": true,
+		"mfa_token":    mfaToken,
+		"expires_in":   int(utils.MFAChallengeTTL().Seconds()),
+	}, nil)
+}
+
+// sendIssueTokensError maps token issuance errors to responses
+func sendIssueTokensError(c *gin.Context, err error) {
+	if errors.Is(err, errEmailNotVerified) {
+		utils.SendResponse(c, http.StatusForbidden, "Please verify your email address before logging in", nil, nil)
+		return
+	}
+	if errors.Is(err, common.ErrAccountDisabled) || errors.Is(err, common.ErrPasswordResetRequired) {
+		utils.SendResponse(c, http.StatusForbidden, err.Error(), nil, nil)
+		return
+	}
+	utils.SendResponse(c, http.StatusInternalServerError, "Could not generate token", nil, nil)
+}
+
+// sendPasswordHashingBusy refuses a request that found every password hashing slot taken
+func sendPasswordHashingBusy(c *gin.Context) {
+	c.Header("Retry-After", "1")
+	utils.SendResponse(c, http.StatusServiceUnavailable, "The service is busy, please try again shortly", nil, nil)
+}
+
+// issueTokens starts a new session for the user and returns its first access and refresh tokens
+func issueTokens(c *gin.Context, userID uuid.UUID, deviceName string) (gin.H, error) {
+	// Generate JWT token
+	token, err := generateAccessToken(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	createdTime := time.Now()
+	familyID := uuid.New()
+	session := models.AuthToken{
+		TokenID:    uuid.New(),
+		UserID:     userID,
+		FamilyID:   &familyID,
+		Token:      token,
+		DeviceName: deviceName,
+		UserAgent:  c.Request.UserAgent(),
+		IPAddress:  c.ClientIP(),
+		CreatedAt:  createdTime,
+		ExpiresAt:  createdTime.Add(utils.AccessTokenTTL()),
+		LastUsedAt: &createdTime,
+	}
 
-	utils.SendResponse(context, http.StatusOK, "Login successful", gin.H{"userId": user.UserID, "token": token}, nil)
+	// Store the access token and the first refresh token of the family together
+	var refreshToken string
+	err = db.GetDBInstance().Transaction(func(tx *gorm.DB) error {
+		if err := common.StoreFamilyToken(tx, &session); err != nil {
+			return err
+		}
+		refreshToken, err = common.CreateRefreshToken(tx, userID, familyID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{
+		"sessionId":     session.TokenID,
+		"token":         token,
+		"refresh_token": refreshToken,
+		"expires_in":    int(utils.AccessTokenTTL().Seconds()),
+	}, nil
 }
 
 // ResetPassword handles the password reset request.
@@ -97,24 +330,24 @@ func ResetPassword(c *gin.Context) {
 		return
 	}
 
-	// Generate a reset token
-	token := utils.GenerateResetToken()
+	// Generate a reset code and queue the email with it, the outbox worker delivers it
+	err := db.GetDBInstance().Transaction(func(tx *gorm.DB) error {
+		token, err := common.CreatePasswordResetToken(tx, user.UserID)
+		if err != nil {
+			return err
+		}
 
-	// Store the token in the database using existing function
-	expirationTime := time.Now().Add(time.Hour * 1) // Make a 1 hour expiration time
-	
-	resetToken := common.StoreResetToken(user.UserID, token, expirationTime)
-	if resetToken != nil {
+		email, err := mailer.PasswordResetEmail(user.Email, token)
+		if err != nil {
+			return err
+		}
+		return common.EnqueueEmail(tx, email)
+	})
+	if err != nil {
 		utils.SendResponse(c, http.StatusInternalServerError, "Could not store token", nil, nil)
 		return
 	}
 
-	// Send email with the reset token (implement email sending function)
-	if err := utils.SendResetTokenEmail(resetPassword.Email, token); err != nil {
-		utils.SendResponse(c, http.StatusInternalServerError, "Could not send reset email", nil, nil)
-		return
-	}
-
 	utils.SendResponse(c, http.StatusOK, "Reset email sent", gin.H{"status": "success",
     "message": "Please check your email for instructions to reset your password.",}, nil)
 }
@@ -129,36 +362,33 @@ func ConfirmResetPassword(c *gin.Context) {
 		return
 	}
 
-	// Get the DB instance
-	DB := db.GetDBInstance()
-
-	// Find the user by the reset token and ensure the token hasn't expired
+	// Find the user the code was sent to
 	var user models.User
-	if err := DB.Where("reset_password_token = ? AND reset_password_expires > ?", confirmResetPassword.Token, time.Now()).First(&user).Error; err != nil {
+	if err := user.GetUserByEmail(confirmResetPassword.Email); err != nil {
 		utils.SendResponse(c, http.StatusBadRequest, "Invalid or expired reset token", nil, nil)
 		return
 	}
 
-	// Use the retrieved salt to hash the new password
-	hashedPassword, err := utils.HashPassword(confirmResetPassword.NewPassword, user.Salt) // Using the user's existing salt here
-	if err != nil {
-		utils.SendResponse(c, http.StatusInternalServerError, "Could not hash password", nil, nil)
-		return
-	}
-
-	// Update the user's password hash and clear the reset token fields
-	user.PasswordHash = hashedPassword
-	user.ResetPasswordToken = ""
-	user.ResetPasswordExpires = time.Time{} 
-
-	// Save the updated user record
-	if err := DB.Save(&user).Error; err != nil {
-		utils.SendResponse(c, http.StatusInternalServerError, "Could not update password", nil, nil)
+	// Check the code, set the new password and sign the user out everywhere
+	if err := common.ResetPasswordWithToken(&user, confirmResetPassword.Token, confirmResetPassword.NewPassword); err != nil {
+		if sendPasswordPolicyError(c, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, common.ErrInvalidResetToken):
+			utils.SendResponse(c, http.StatusBadRequest, "Invalid or expired reset token", nil, nil)
+		case errors.Is(err, common.ErrTooManyResetAttempts):
+			utils.SendResponse(c, http.StatusTooManyRequests, "Too many failed attempts, please request a new reset code", nil, nil)
+		case errors.Is(err, utils.ErrPasswordHashingBusy):
+			sendPasswordHashingBusy(c)
+		default:
+			utils.SendResponse(c, http.StatusInternalServerError, "Could not update password", nil, nil)
+		}
 		return
 	}
 
 	// Send a success response
-	utils.SendResponse(c, http.StatusOK, "Password successfully reset", nil, nil)
+	utils.SendResponse(c, http.StatusOK, "Password successfully reset", withPasswordWarnings(nil, confirmResetPassword.NewPassword), nil)
 }
 
 // logout handles user logout
@@ -217,6 +447,9 @@ func GetUserInfo(c *gin.Context) {
 		"last_name":  user.LastName,
 		"email":      user.Email,
 		"created_at": user.CreatedAt,
+
+		// Set once a login finds the password in a data breach, until it is changed
+		"password_breached": user.PasswordBreachedAt != nil,
 	}
 
 	// Send the response
@@ -248,12 +481,26 @@ func UpdatePassword(c *gin.Context) {
    
 	// Verify the current password
 	if err := utils.CheckPassword(user.PasswordHash, user.Salt, updatePassword.CurrentPassword); err != nil {
+		if errors.Is(err, utils.ErrPasswordHashingBusy) {
+			sendPasswordHashingBusy(c)
+			return
+		}
 		utils.SendResponse(c, http.StatusUnauthorized, "Current password is incorrect", nil, nil)
 		return
 	}
 
+	// The new password must meet the policy
+	err := passwordpolicy.Validate(updatePassword.NewPassword, passwordpolicy.PersonalInfo{Email: user.Email, FirstName: user.FirstName, LastName: user.LastName})
+	if sendPasswordPolicyError(c, err) {
+		return
+	}
+
 	// Hash the new password
-	hashedPassword, err := utils.HashPassword(updatePassword.NewPassword, user.Salt)
+	hashedPassword, err := utils.HashPassword(updatePassword.NewPassword)
+	if errors.Is(err, utils.ErrPasswordHashingBusy) {
+		sendPasswordHashingBusy(c)
+		return
+	}
 	if err != nil {
 		utils.SendResponse(c, http.StatusInternalServerError, "Could not hash password", nil, nil)
 		return
@@ -261,13 +508,14 @@ func UpdatePassword(c *gin.Context) {
 
 	// Update the user's password in the database
 	user.PasswordHash = hashedPassword
-	// user.Salt = salt
+	user.PasswordBreachedAt = nil
+	user.Salt = "" // The hash carries its own salt
 	if err := DB.Save(&user).Error; err != nil {
 		utils.SendResponse(c, http.StatusInternalServerError, "Could not update password", nil, nil)
 		return
 	}
 
-	utils.SendResponse(c, http.StatusOK, "Password updated successfully", nil, nil)
+	utils.SendResponse(c, http.StatusOK, "Password updated successfully", withPasswordWarnings(nil, updatePassword.NewPassword), nil)
 }
 
 
@@ -293,13 +541,28 @@ func UpdateUserInfo(c *gin.Context) {
 		return
 	}
 
+	// A new email address has to be verified again
+	emailChanged := !strings.EqualFold(user.Email, updateUser.Email)
+
 	// Update user fields
 	user.FirstName = updateUser.FirstName
 	user.LastName = updateUser.LastName
-	user.Email = updateUser.Email
+	user.Email = strings.ToLower(updateUser.Email)
+	if emailChanged {
+		user.IsEmailVerified = false
+	}
 
 	// Save updated user information in the database
-	if err := DB.Save(&user).Error; err != nil {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+		if emailChanged {
+			return queueVerificationEmail(tx, user)
+		}
+		return nil
+	})
+	if err != nil {
 			utils.SendResponse(c, http.StatusInternalServerError, "Could not update user information", nil, nil)
 			return
 	}
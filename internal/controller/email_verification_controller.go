@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/Debt-Solvers/BE-auth-service/db"
+	"github.com/Debt-Solvers/BE-auth-service/internal/common"
+	"github.com/Debt-Solvers/BE-auth-service/internal/mailer"
+	"github.com/Debt-Solvers/BE-auth-service/internal/models"
+	"github.com/Debt-Solvers/BE-auth-service/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// VerifyEmail marks the user's email address as verified. It accepts the token as a query
+// parameter, so the link in the email works directly, or in a JSON body for the mobile app.
+func VerifyEmail(c *gin.Context) {
+	var verifyReq models.VerifyEmailRequest
+	if err := c.ShouldBind(&verifyReq); err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid request data", nil, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, err := utils.VerifyPurposeToken(verifyReq.Token, utils.PurposeEmailVerification)
+	if err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid or expired verification link", nil, nil)
+		return
+	}
+	subject, _ := claims["sub"].(string)
+	email, _ := claims["email"].(string)
+	userID, err := uuid.Parse(subject)
+	if err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid or expired verification link", nil, nil)
+		return
+	}
+
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	var user models.User
+	if err := DB.Where("user_id = ?", userID).First(&user).Error; err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid or expired verification link", nil, nil)
+		return
+	}
+
+	// A link sent to an earlier address must not verify the current one
+	if user.Email != email {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid or expired verification link", nil, nil)
+		return
+	}
+
+	if !user.IsEmailVerified {
+		if err := DB.Model(&user).Update("is_email_verified", true).Error; err != nil {
+			utils.SendResponse(c, http.StatusInternalServerError, "Could not verify email address", nil, nil)
+			return
+		}
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Email address verified successfully", nil, nil)
+}
+
+// ResendVerificationEmail sends a new verification link. The response is the same whether or not
+// the address belongs to an unverified account, so it cannot be used to discover accounts.
+func ResendVerificationEmail(c *gin.Context) {
+	var resendReq models.ResendVerificationRequest
+	if err := c.ShouldBindJSON(&resendReq); err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid request data", nil, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := user.GetUserByEmail(resendReq.Email); err == nil && !user.IsEmailVerified {
+		if err := queueVerificationEmail(db.GetDBInstance(), user); err != nil {
+			utils.SendResponse(c, http.StatusInternalServerError, "Could not send verification email", nil, nil)
+			return
+		}
+	}
+
+	utils.SendResponse(c, http.StatusOK, "If the address belongs to an unverified account, a new verification email has been sent", nil, nil)
+}
+
+// queueVerificationEmail adds a fresh verification link for the user's current address to the email outbox
+func queueVerificationEmail(tx *gorm.DB, user models.User) error {
+	token, err := utils.GenerateEmailVerificationToken(user.UserID, user.Email)
+	if err != nil {
+		return err
+	}
+
+	email, err := mailer.VerificationEmail(user.Email, token)
+	if err != nil {
+		return err
+	}
+	return common.EnqueueEmail(tx, email)
+}
@@ -0,0 +1,19 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/Debt-Solvers/BE-auth-service/internal/keystore"
+
+	"github.com/gin-gonic/gin"
+)
+
+// jwksMaxAge is how long clients may cache the key set. New keys are published long before they
+// start signing, so a cached copy never misses a key that is in use.
+const jwksMaxAge = "public, max-age=300"
+
+// JWKS publishes the public keys tokens are signed with in RFC 7517 format
+func JWKS(c *gin.Context) {
+	c.Header("Cache-Control", jwksMaxAge)
+	c.JSON(http.StatusOK, gin.H{"keys": keystore.Default().JWKS()})
+}
@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Debt-Solvers/BE-auth-service/internal/common"
+	"github.com/Debt-Solvers/BE-auth-service/internal/models"
+	"github.com/Debt-Solvers/BE-auth-service/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UnlockLogin lifts a login lock with the token from the unlock email
+func UnlockLogin(c *gin.Context) {
+	var unlockReq models.UnlockLoginRequest
+	if err := c.ShouldBind(&unlockReq); err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid request data", nil, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := common.UnlockLoginWithToken(unlockReq.Token); err != nil {
+		if errors.Is(err, common.ErrInvalidUnlockToken) {
+			utils.SendResponse(c, http.StatusBadRequest, "Invalid or expired unlock link", nil, nil)
+		} else {
+			utils.SendResponse(c, http.StatusInternalServerError, "Could not unlock login", nil, nil)
+		}
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Login unlocked, you can sign in again", nil, nil)
+}
+
+// sendLoginThrottled refuses a login attempt that came too soon after failed ones. The response is the
+// same for every address, so it does not reveal whether an account exists.
+func sendLoginThrottled(c *gin.Context, retryAfter time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	utils.SendResponse(c, http.StatusTooManyRequests, "Too many failed login attempts, please try again later", nil, nil)
+}
+
+// sendInvalidCredentials rejects a wrong password, which ReserveLoginAttempt already counted as a failure
+func sendInvalidCredentials(c *gin.Context) {
+	utils.SendResponse(c, http.StatusUnauthorized, "Invalid credentials", nil, nil)
+}
+
+// sendLoginHashingBusy takes back the reserved attempt of a login whose password could not be checked
+func sendLoginHashingBusy(c *gin.Context, email string) {
+	if err := common.ReleaseLoginAttempt(email); err != nil {
+		log.Printf("Failed to release a login attempt: %v", err)
+	}
+	sendPasswordHashingBusy(c)
+}
+
+// checkCurrentPassword re-checks the password of a signed-in user before a sensitive change. It is
+// throttled and counted like a login, so a stolen access token cannot be used to guess the password.
+// ok is false once a response was written.
+func checkCurrentPassword(c *gin.Context, user *models.User, password string) bool {
+	retryAfter, err := common.ReserveLoginAttempt(user.Email)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Could not check login attempts", nil, nil)
+		return false
+	}
+	if retryAfter > 0 {
+		sendLoginThrottled(c, retryAfter)
+		return false
+	}
+
+	if err := utils.CheckPassword(user.PasswordHash, user.Salt, password); err != nil {
+		if errors.Is(err, utils.ErrPasswordHashingBusy) {
+			sendLoginHashingBusy(c, user.Email)
+			return false
+		}
+		utils.SendResponse(c, http.StatusUnauthorized, "Password is incorrect", nil, nil)
+		return false
+	}
+	if err := common.ClearLoginFailures(user.Email); err != nil {
+		log.Printf("Failed to clear failed logins: %v", err)
+	}
+	return true
+}
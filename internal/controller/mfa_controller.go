@@ -0,0 +1,268 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/Debt-Solvers/BE-auth-service/configs"
+	"github.com/Debt-Solvers/BE-auth-service/db"
+	"github.com/Debt-Solvers/BE-auth-service/internal/common"
+	"github.com/Debt-Solvers/BE-auth-service/internal/mailer"
+	"github.com/Debt-Solvers/BE-auth-service/internal/models"
+	"github.com/Debt-Solvers/BE-auth-service/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// EnrollTOTP starts TOTP enrollment after re-checking the password, and returns the secret and
+// otpauth:// URI for the authenticator app
+func EnrollTOTP(c *gin.Context) {
+	var enrollReq models.EnrollTOTPRequest
+	if err := c.ShouldBindJSON(&enrollReq); err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid request data", nil, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.MustGet("userId").(uuid.UUID)
+
+	// Find the user so the account name in the URI matches their email
+	var user models.User
+	if err := db.GetDBInstance().Where("user_id = ?", userID).First(&user).Error; err != nil {
+		utils.SendResponse(c, http.StatusNotFound, "User not found", nil, nil)
+		return
+	}
+
+	// Verify the current password
+	if !checkCurrentPassword(c, &user, enrollReq.Password) {
+		return
+	}
+
+	secret, err := common.StartTOTPEnrollment(userID)
+	if err != nil {
+		if errors.Is(err, common.ErrMFAAlreadyEnabled) {
+			utils.SendResponse(c, http.StatusConflict, "Multi-factor authentication is already enabled", nil, nil)
+		} else {
+			utils.SendResponse(c, http.StatusInternalServerError, "Could not start enrollment", nil, nil)
+		}
+		return
+	}
+
+	issuer := configs.GetConfig().MFA.Issuer
+	utils.SendResponse(c, http.StatusOK, "Scan the code with your authenticator app, then verify it", gin.H{
+		"secret":      secret,
+		"otpauth_uri": utils.TOTPURI(issuer, user.Email, secret),
+	}, nil)
+}
+
+// VerifyTOTP activates a pending TOTP enrollment with a code from the authenticator app
+func VerifyTOTP(c *gin.Context) {
+	var verifyReq models.VerifyTOTPRequest
+	if err := c.ShouldBindJSON(&verifyReq); err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid request data", nil, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.MustGet("userId").(uuid.UUID)
+
+	if err := common.ActivateTOTP(userID, verifyReq.Code); err != nil {
+		sendMFAError(c, err)
+		return
+	}
+
+	// Hand out recovery codes straight away so losing the device never locks the user out
+	codes, err := common.GenerateRecoveryCodes(userID)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Multi-factor authentication enabled, but recovery codes could not be generated", nil, nil)
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Multi-factor authentication enabled", gin.H{"recovery_codes": codes}, nil)
+}
+
+// RegenerateRecoveryCodes replaces the caller's recovery codes after re-checking their password
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var regenerateReq models.RegenerateRecoveryCodesRequest
+	if err := c.ShouldBindJSON(&regenerateReq); err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid request data", nil, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.MustGet("userId").(uuid.UUID)
+
+	var user models.User
+	if err := db.GetDBInstance().Where("user_id = ?", userID).First(&user).Error; err != nil {
+		utils.SendResponse(c, http.StatusNotFound, "User not found", nil, nil)
+		return
+	}
+
+	// Verify the current password
+	if !checkCurrentPassword(c, &user, regenerateReq.Password) {
+		return
+	}
+
+	mfaEnabled, err := common.IsMFAEnabled(userID)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Could not check multi-factor authentication", nil, nil)
+		return
+	}
+	if !mfaEnabled {
+		utils.SendResponse(c, http.StatusBadRequest, "Multi-factor authentication is not enabled", nil, nil)
+		return
+	}
+
+	codes, err := common.GenerateRecoveryCodes(userID)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Could not generate recovery codes", nil, nil)
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Recovery codes regenerated, previous codes no longer work", gin.H{"recovery_codes": codes}, nil)
+}
+
+// GetRecoveryCodeStatus returns how many unused recovery codes the caller has left
+func GetRecoveryCodeStatus(c *gin.Context) {
+	userID := c.MustGet("userId").(uuid.UUID)
+
+	remaining, err := common.CountRecoveryCodes(userID)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Could not count recovery codes", nil, nil)
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Recovery code status retrieved successfully", gin.H{"remaining": remaining}, nil)
+}
+
+// DisableTOTP turns off the second factor after re-checking the user's password
+func DisableTOTP(c *gin.Context) {
+	var disableReq models.DisableTOTPRequest
+	if err := c.ShouldBindJSON(&disableReq); err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid request data", nil, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.MustGet("userId").(uuid.UUID)
+
+	var user models.User
+	if err := db.GetDBInstance().Where("user_id = ?", userID).First(&user).Error; err != nil {
+		utils.SendResponse(c, http.StatusNotFound, "User not found", nil, nil)
+		return
+	}
+
+	// Verify the current password
+	if !checkCurrentPassword(c, &user, disableReq.Password) {
+		return
+	}
+
+	if err := common.DisableTOTP(userID); err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Could not disable multi-factor authentication", nil, nil)
+		return
+	}
+	notifyTOTPDisabled(user, c.ClientIP())
+
+	utils.SendResponse(c, http.StatusOK, "Multi-factor authentication disabled", nil, nil)
+}
+
+// LoginMFA completes a login that returned an MFA challenge by checking the second factor
+func LoginMFA(c *gin.Context) {
+	var mfaReq models.MFALoginRequest
+	if err := c.ShouldBindJSON(&mfaReq); err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid request data", nil, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The challenge token proves the password step succeeded
+	claims, err := utils.VerifyPurposeToken(mfaReq.MFAToken, utils.PurposeMFAChallenge)
+	if err != nil {
+		utils.SendResponse(c, http.StatusUnauthorized, "Invalid or expired MFA challenge", nil, nil)
+		return
+	}
+	subject, _ := claims["sub"].(string)
+	userID, err := uuid.Parse(subject)
+	if err != nil {
+		utils.SendResponse(c, http.StatusUnauthorized, "Invalid or expired MFA challenge", nil, nil)
+		return
+	}
+	deviceName, _ := claims["device_name"].(string)
+
+	mfa, err := common.GetUserMFA(userID)
+	if err != nil || !mfa.Enabled {
+		utils.SendResponse(c, http.StatusUnauthorized, "Invalid or expired MFA challenge", nil, nil)
+		return
+	}
+
+	if mfaReq.RecoveryCode != "" {
+		if err := common.UseRecoveryCode(mfa, mfaReq.RecoveryCode); err != nil {
+			sendMFAError(c, err)
+			return
+		}
+		notifyRecoveryCodeUsed(userID, c.ClientIP())
+	} else if err := common.VerifyTOTPCode(mfa, mfaReq.Code); err != nil {
+		sendMFAError(c, err)
+		return
+	}
+
+	// Issue an access token and a refresh token for a new session
+	tokens, err := issueTokens(c, userID, deviceName)
+	if err != nil {
+		sendIssueTokensError(c, err)
+		return
+	}
+
+	tokens["userId"] = userID
+	utils.SendResponse(c, http.StatusOK, "Login successful", tokens, nil)
+}
+
+// notifyRecoveryCodeUsed queues an email telling the user that a recovery code was just used to sign in
+func notifyRecoveryCodeUsed(userID uuid.UUID, ipAddress string) {
+	var user models.User
+	if err := db.GetDBInstance().Where("user_id = ?", userID).First(&user).Error; err != nil {
+		log.Printf("Could not load user %s for recovery code alert: %v", userID, err)
+		return
+	}
+
+	remaining, err := common.CountRecoveryCodes(userID)
+	if err != nil {
+		log.Printf("Could not count recovery codes for user %s: %v", userID, err)
+	}
+
+	message := fmt.Sprintf("A recovery code was used to sign in to your account from %s. You have %d recovery codes left.", ipAddress, remaining)
+	email, err := mailer.SecurityAlertEmail(user.Email, "A recovery code was used on your account", message)
+	if err == nil {
+		err = common.EnqueueEmail(db.GetDBInstance(), email)
+	}
+	if err != nil {
+		log.Printf("Could not queue recovery code alert for user %s: %v", userID, err)
+	}
+}
+
+// notifyTOTPDisabled queues an email telling the user that their second factor was just turned off
+func notifyTOTPDisabled(user models.User, ipAddress string) {
+	message := fmt.Sprintf("Multi-factor authentication was turned off for your account from %s, and your recovery codes no longer work. If this wasn't you, reset your password and turn it on again.", ipAddress)
+	email, err := mailer.SecurityAlertEmail(user.Email, "Multi-factor authentication was turned off", message)
+	if err == nil {
+		err = common.EnqueueEmail(db.GetDBInstance(), email)
+	}
+	if err != nil {
+		log.Printf("Could not queue MFA disabled alert for user %s: %v", user.UserID, err)
+	}
+}
+
+// sendMFAError maps second-factor errors to responses
+func sendMFAError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, common.ErrInvalidMFACode):
+		utils.SendResponse(c, http.StatusUnauthorized, "Invalid verification code", nil, nil)
+	case errors.Is(err, common.ErrTooManyMFAAttempts):
+		utils.SendResponse(c, http.StatusTooManyRequests, "Too many failed verification codes, try again later", nil, nil)
+	case errors.Is(err, common.ErrMFANotEnabled), errors.Is(err, gorm.ErrRecordNotFound):
+		utils.SendResponse(c, http.StatusBadRequest, "Multi-factor authentication enrollment not started", nil, nil)
+	case errors.Is(err, common.ErrMFAAlreadyEnabled):
+		utils.SendResponse(c, http.StatusConflict, "Multi-factor authentication is already enabled", nil, nil)
+	default:
+		utils.SendResponse(c, http.StatusInternalServerError, "Could not verify code", nil, nil)
+	}
+}
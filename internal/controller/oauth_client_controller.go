@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Debt-Solvers/BE-auth-service/internal/common"
+	"github.com/Debt-Solvers/BE-auth-service/internal/models"
+	"github.com/Debt-Solvers/BE-auth-service/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CreateOAuthClient registers a third-party application owned by the caller
+func CreateOAuthClient(c *gin.Context) {
+	var createReq models.CreateOAuthClientRequest
+	if err := c.ShouldBindJSON(&createReq); err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid request data", nil, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.MustGet("userId").(uuid.UUID)
+
+	client, secret, err := common.CreateOAuthClient(userID, createReq.Name, createReq.ClientType, createReq.RedirectURIs, createReq.Scope)
+	if err != nil {
+		switch {
+		case errors.Is(err, common.ErrInvalidScope), errors.Is(err, common.ErrInvalidRedirectURI):
+			utils.SendResponse(c, http.StatusBadRequest, err.Error(), nil, nil)
+		default:
+			utils.SendResponse(c, http.StatusInternalServerError, "Could not register application", nil, nil)
+		}
+		return
+	}
+
+	data := oauthClientResponse(*client)
+	if secret != "" {
+		// The secret is only stored as a hash, so this is the one chance to copy it
+		data["client_secret"] = secret
+	}
+	utils.SendResponse(c, http.StatusCreated, "Application registered successfully", data, nil)
+}
+
+// ListOAuthClients returns the applications registered by the caller
+func ListOAuthClients(c *gin.Context) {
+	userID := c.MustGet("userId").(uuid.UUID)
+
+	clients, err := common.ListOAuthClients(userID)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Could not retrieve applications", nil, nil)
+		return
+	}
+
+	clientList := make([]gin.H, 0, len(clients))
+	for _, client := range clients {
+		clientList = append(clientList, oauthClientResponse(client))
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Applications retrieved successfully", gin.H{"clients": clientList}, nil)
+}
+
+// DeleteOAuthClient removes one of the caller's applications and every token issued to it
+func DeleteOAuthClient(c *gin.Context) {
+	userID := c.MustGet("userId").(uuid.UUID)
+
+	if err := common.DeleteOAuthClient(userID, c.Param("id")); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.SendResponse(c, http.StatusNotFound, "Application not found", nil, nil)
+		} else {
+			utils.SendResponse(c, http.StatusInternalServerError, "Could not delete application", nil, nil)
+		}
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Application deleted successfully", nil, nil)
+}
+
+// ListOAuthConsents returns the applications the caller has granted access to
+func ListOAuthConsents(c *gin.Context) {
+	userID := c.MustGet("userId").(uuid.UUID)
+
+	consents, err := common.ListOAuthConsents(userID)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Could not retrieve connected applications", nil, nil)
+		return
+	}
+
+	consentList := make([]gin.H, 0, len(consents))
+	for _, consent := range consents {
+		entry := gin.H{
+			"client_id":  consent.ClientID,
+			"scope":      consent.Scope,
+			"granted_at": consent.CreatedAt,
+			"updated_at": consent.UpdatedAt,
+		}
+		if client, err := common.GetOAuthClient(consent.ClientID); err == nil {
+			entry["name"] = client.Name
+		}
+		consentList = append(consentList, entry)
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Connected applications retrieved successfully", gin.H{"consents": consentList}, nil)
+}
+
+// RevokeOAuthConsent disconnects an application from the caller's account
+func RevokeOAuthConsent(c *gin.Context) {
+	userID := c.MustGet("userId").(uuid.UUID)
+
+	if err := common.RevokeOAuthConsent(userID, c.Param("client_id")); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.SendResponse(c, http.StatusNotFound, "Connected application not found", nil, nil)
+		} else {
+			utils.SendResponse(c, http.StatusInternalServerError, "Could not disconnect application", nil, nil)
+		}
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Application disconnected successfully", nil, nil)
+}
+
+// oauthClientResponse lists the public fields of a client
+func oauthClientResponse(client models.OAuthClient) gin.H {
+	return gin.H{
+		"client_id":     client.ClientID,
+		"client_type":   client.ClientType,
+		"name":          client.Name,
+		"redirect_uris": client.RedirectURIList(),
+		"scope":         client.Scope,
+		"created_at":    client.CreatedAt,
+	}
+}
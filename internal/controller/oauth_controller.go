@@ -0,0 +1,553 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Debt-Solvers/BE-auth-service/configs"
+	"github.com/Debt-Solvers/BE-auth-service/internal/common"
+	"github.com/Debt-Solvers/BE-auth-service/internal/models"
+	"github.com/Debt-Solvers/BE-auth-service/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// authorizeError is an OAuth error that is reported back to the client's redirect URI
+type authorizeError struct {
+	code        string
+	description string
+}
+
+// maxNonceLength bounds the OpenID Connect nonce stored with an authorization code
+const maxNonceLength = 512
+
+// validatedAuthorizeRequest is an authorization request whose client and redirect URI have been checked
+type validatedAuthorizeRequest struct {
+	client      *models.OAuthClient
+	redirectURI string
+	scopes      []string
+}
+
+// Authorize shows the login and consent page for an authorization code request
+func Authorize(c *gin.Context) {
+	var authorizeReq models.AuthorizeRequest
+	if err := c.ShouldBindQuery(&authorizeReq); err != nil {
+		renderPage(c, http.StatusBadRequest, "oauth_error.html", gin.H{"Title": "Error", "Error": "The authorization request is malformed."})
+		return
+	}
+
+	validated, ok := validateAuthorizeRequest(c, authorizeReq)
+	if !ok {
+		return
+	}
+
+	renderAuthorizePage(c, http.StatusOK, authorizeReq, validated, "", "")
+}
+
+// AuthorizeDecision handles the login and consent form. On approval the browser is sent back to the
+// client's redirect URI with an authorization code.
+func AuthorizeDecision(c *gin.Context) {
+	var decisionReq models.AuthorizeDecisionRequest
+	if err := c.ShouldBind(&decisionReq); err != nil {
+		renderPage(c, http.StatusBadRequest, "oauth_error.html", gin.H{"Title": "Error", "Error": "The authorization request is malformed."})
+		return
+	}
+
+	validated, ok := validateAuthorizeRequest(c, decisionReq.AuthorizeRequest)
+	if !ok {
+		return
+	}
+
+	if decisionReq.Decision != "approve" {
+		redirectWithError(c, validated.redirectURI, decisionReq.State, authorizeError{"access_denied", "The user denied the request"})
+		return
+	}
+
+	// The existing account credentials act as the resource owner login, throttled like the login endpoint
+	retryAfter, err := common.ReserveLoginAttempt(decisionReq.Email)
+	if err != nil {
+		redirectWithError(c, validated.redirectURI, decisionReq.State, authorizeError{"server_error", "Could not check login attempts"})
+		return
+	}
+	if retryAfter > 0 {
+		renderAuthorizePage(c, http.StatusTooManyRequests, decisionReq.AuthorizeRequest, validated, decisionReq.Email, "Too many failed login attempts, please try again later.")
+		return
+	}
+
+	// Unknown addresses are checked against a dummy hash, so the response time does not reveal them
+	var user models.User
+	var passwordErr error
+	if err := user.GetUserByEmail(strings.ToLower(strings.TrimSpace(decisionReq.Email))); err != nil {
+		passwordErr = utils.ErrPasswordMismatch
+		if err := utils.CheckDummyPassword(decisionReq.Password); err != nil {
+			passwordErr = err
+		}
+	} else {
+		passwordErr = utils.CheckPassword(user.PasswordHash, user.Salt, decisionReq.Password)
+	}
+	if errors.Is(passwordErr, utils.ErrPasswordHashingBusy) {
+		if err := common.ReleaseLoginAttempt(decisionReq.Email); err != nil {
+			log.Printf("Failed to release a login attempt: %v", err)
+		}
+		c.Header("Retry-After", "1")
+		renderAuthorizePage(c, http.StatusServiceUnavailable, decisionReq.AuthorizeRequest, validated, decisionReq.Email, "The service is busy, please try again shortly.")
+		return
+	}
+	if passwordErr != nil {
+		renderAuthorizePage(c, http.StatusUnauthorized, decisionReq.AuthorizeRequest, validated, decisionReq.Email, "Invalid email or password.")
+		return
+	}
+	if err := common.ClearLoginFailures(decisionReq.Email); err != nil {
+		log.Printf("Failed to clear failed logins: %v", err)
+	}
+	if err := common.UpgradePasswordHash(&user, decisionReq.Password); err != nil {
+		log.Printf("Failed to upgrade the password hash: %v", err)
+	}
+	common.ScreenPassword(user, decisionReq.Password)
+
+	if err := common.CheckAccountStatus(&user); err != nil {
+		renderAuthorizePage(c, http.StatusForbidden, decisionReq.AuthorizeRequest, validated, decisionReq.Email, "This account cannot sign in until it is enabled or its password is reset.")
+		return
+	}
+
+	if !user.IsEmailVerified {
+		renderAuthorizePage(c, http.StatusForbidden, decisionReq.AuthorizeRequest, validated, decisionReq.Email, "Please verify your email address before connecting other applications.")
+		return
+	}
+
+	// Accounts with a second factor must also pass it
+	mfaEnabled, err := common.IsMFAEnabled(user.UserID)
+	if err != nil {
+		redirectWithError(c, validated.redirectURI, decisionReq.State, authorizeError{"server_error", "Could not check multi-factor authentication"})
+		return
+	}
+	if mfaEnabled {
+		mfa, err := common.GetUserMFA(user.UserID)
+		if err != nil {
+			redirectWithError(c, validated.redirectURI, decisionReq.State, authorizeError{"server_error", "Could not check multi-factor authentication"})
+			return
+		}
+		if err := common.VerifyTOTPCode(mfa, decisionReq.Code); err != nil {
+			message := "Invalid authentication code."
+			if errors.Is(err, common.ErrTooManyMFAAttempts) {
+				message = "Too many failed authentication codes, try again later."
+			}
+			renderAuthorizePage(c, http.StatusUnauthorized, decisionReq.AuthorizeRequest, validated, decisionReq.Email, message)
+			return
+		}
+	}
+
+	if err := common.GrantOAuthConsent(user.UserID, validated.client.ClientID, validated.scopes); err != nil {
+		redirectWithError(c, validated.redirectURI, decisionReq.State, authorizeError{"server_error", "Could not record consent"})
+		return
+	}
+
+	code, err := common.CreateAuthorizationCode(validated.client, user.UserID, validated.redirectURI, strings.Join(validated.scopes, " "), decisionReq.CodeChallenge, decisionReq.Nonce)
+	if err != nil {
+		redirectWithError(c, validated.redirectURI, decisionReq.State, authorizeError{"server_error", "Could not issue an authorization code"})
+		return
+	}
+
+	redirectWithParams(c, validated.redirectURI, url.Values{"code": {code}, "state": {decisionReq.State}})
+}
+
+// validateAuthorizeRequest checks an authorization request. Problems with the client or redirect URI
+// are shown on an error page, since redirecting to an unverified URI would be an open redirect; all
+// other problems are reported to the client's redirect URI. ok is false once a response was written.
+func validateAuthorizeRequest(c *gin.Context, authorizeReq models.AuthorizeRequest) (*validatedAuthorizeRequest, bool) {
+	client, err := common.GetOAuthClient(authorizeReq.ClientID)
+	if err != nil {
+		renderPage(c, http.StatusBadRequest, "oauth_error.html", gin.H{"Title": "Error", "Error": "The application is not registered."})
+		return nil, false
+	}
+
+	redirectURI, ok := common.ResolveRedirectURI(client, authorizeReq.RedirectURI)
+	if !ok {
+		renderPage(c, http.StatusBadRequest, "oauth_error.html", gin.H{"Title": "Error", "Error": "The redirect URI is not registered for this application."})
+		return nil, false
+	}
+
+	fail := func(authErr authorizeError) (*validatedAuthorizeRequest, bool) {
+		redirectWithError(c, redirectURI, authorizeReq.State, authErr)
+		return nil, false
+	}
+
+	if authorizeReq.ResponseType != "code" {
+		return fail(authorizeError{"unsupported_response_type", "Only the authorization code flow is supported"})
+	}
+	// PKCE is required for every client
+	if authorizeReq.CodeChallengeMethod != "S256" || !common.ValidCodeChallenge(authorizeReq.CodeChallenge) {
+		return fail(authorizeError{"invalid_request", "PKCE with code_challenge_method=S256 is required"})
+	}
+
+	scopes, err := common.ParseScope(authorizeReq.Scope)
+	if err != nil || len(scopes) == 0 || !common.ScopeIncludes(client.Scope, scopes) {
+		return fail(authorizeError{"invalid_scope", "The requested scope is invalid or not allowed for this application"})
+	}
+
+	// OpenID Connect parameters. The consent form always asks for credentials, so any max_age is met.
+	if len(authorizeReq.Nonce) > maxNonceLength {
+		return fail(authorizeError{"invalid_request", "The nonce is too long"})
+	}
+	if authorizeReq.MaxAge != "" {
+		if maxAge, err := strconv.Atoi(authorizeReq.MaxAge); err != nil || maxAge < 0 {
+			return fail(authorizeError{"invalid_request", "max_age must be a non-negative number of seconds"})
+		}
+	}
+	for _, prompt := range strings.Fields(authorizeReq.Prompt) {
+		if prompt == "none" {
+			return fail(authorizeError{"login_required", "The user must sign in"})
+		}
+	}
+
+	return &validatedAuthorizeRequest{client: client, redirectURI: redirectURI, scopes: scopes}, true
+}
+
+// renderAuthorizePage shows the login and consent form, carrying the request parameters in hidden fields
+func renderAuthorizePage(c *gin.Context, status int, authorizeReq models.AuthorizeRequest, validated *validatedAuthorizeRequest, email, errorMessage string) {
+	scopeDescriptions := make([]string, 0, len(validated.scopes))
+	for _, scope := range validated.scopes {
+		scopeDescriptions = append(scopeDescriptions, common.ScopeDescriptions[scope])
+	}
+
+	renderPage(c, status, "oauth_authorize.html", gin.H{
+		"Title":      "Authorize " + validated.client.Name,
+		"ClientName": validated.client.Name,
+		"Scopes":     scopeDescriptions,
+		"Email":      email,
+		"Error":      errorMessage,
+		"Params": map[string]string{
+			"response_type":         authorizeReq.ResponseType,
+			"client_id":             authorizeReq.ClientID,
+			"redirect_uri":          validated.redirectURI,
+			"scope":                 strings.Join(validated.scopes, " "),
+			"state":                 authorizeReq.State,
+			"code_challenge":        authorizeReq.CodeChallenge,
+			"code_challenge_method": authorizeReq.CodeChallengeMethod,
+			"nonce":                 authorizeReq.Nonce,
+			"max_age":               authorizeReq.MaxAge,
+		},
+	})
+}
+
+// redirectWithError sends an OAuth error to the client's redirect URI
+func redirectWithError(c *gin.Context, redirectURI, state string, authErr authorizeError) {
+	redirectWithParams(c, redirectURI, url.Values{
+		"error":             {authErr.code},
+		"error_description": {authErr.description},
+		"state":             {state},
+	})
+}
+
+// redirectWithParams adds query parameters to a registered redirect URI and redirects the browser to it
+func redirectWithParams(c *gin.Context, redirectURI string, params url.Values) {
+	target, _ := url.Parse(redirectURI) // Registered URIs were validated when the client was created
+	query := target.Query()
+	for name, values := range params {
+		if len(values) > 0 && values[0] != "" {
+			query.Set(name, values[0])
+		}
+	}
+	target.RawQuery = query.Encode()
+
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusSeeOther, target.String())
+}
+
+// Token exchanges an authorization code or refresh token for tokens, or issues a service token to one
+// of our own services (RFC 6749 section 3.2)
+func Token(c *gin.Context) {
+	var tokenReq models.OAuthTokenRequest
+	if err := c.ShouldBind(&tokenReq); err != nil {
+		sendOAuthError(c, http.StatusBadRequest, "invalid_request", "The token request is malformed")
+		return
+	}
+
+	// Service clients are a separate registry from OAuth clients
+	if tokenReq.GrantType == "client_credentials" {
+		serviceToken(c, tokenReq)
+		return
+	}
+
+	client, ok := authenticateClient(c, tokenReq.ClientID, tokenReq.ClientSecret)
+	if !ok {
+		return
+	}
+
+	var tokens *common.OAuthTokens
+	var err error
+	switch tokenReq.GrantType {
+	case "authorization_code":
+		var authorizationCode *models.OAuthAuthorizationCode
+		authorizationCode, err = common.RedeemAuthorizationCode(client, tokenReq.Code, tokenReq.RedirectURI, tokenReq.CodeVerifier)
+		if err == nil {
+			tokens, err = common.IssueOAuthTokens(client, authorizationCode, c.Request.UserAgent(), c.ClientIP())
+		}
+	case "refresh_token":
+		tokens, err = common.RefreshOAuthTokens(client, tokenReq.RefreshToken, tokenReq.Scope, c.Request.UserAgent(), c.ClientIP())
+	default:
+		sendOAuthError(c, http.StatusBadRequest, "unsupported_grant_type", "Supported grant types are authorization_code, refresh_token and client_credentials")
+		return
+	}
+
+	if err != nil {
+		switch {
+		case errors.Is(err, common.ErrInvalidGrant), errors.Is(err, common.ErrInvalidRefreshToken), errors.Is(err, common.ErrRefreshTokenReused),
+			errors.Is(err, common.ErrAccountDisabled), errors.Is(err, common.ErrPasswordResetRequired):
+			sendOAuthError(c, http.StatusBadRequest, "invalid_grant", "The grant is invalid, expired or was already used")
+		case errors.Is(err, common.ErrInvalidScope):
+			sendOAuthError(c, http.StatusBadRequest, "invalid_scope", "The requested scope exceeds the granted scope")
+		default:
+			sendOAuthError(c, http.StatusInternalServerError, "server_error", "Could not issue tokens")
+		}
+		return
+	}
+
+	response := gin.H{
+		"access_token": tokens.AccessToken,
+		"token_type":   "Bearer",
+		"expires_in":   tokens.ExpiresIn,
+		"scope":        tokens.Scope,
+	}
+	if tokens.RefreshToken != "" {
+		response["refresh_token"] = tokens.RefreshToken
+	}
+	if tokens.IDToken != "" {
+		response["id_token"] = tokens.IDToken
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+	c.JSON(http.StatusOK, response)
+}
+
+// clientCredentials reads the client credentials from HTTP Basic or from the client_id and
+// client_secret in the request body. ok is false once an error response was written.
+func clientCredentials(c *gin.Context, formClientID, formClientSecret string) (clientID, clientSecret string, basic, ok bool) {
+	clientID, clientSecret = formClientID, formClientSecret
+	basicID, basicSecret, basic := c.Request.BasicAuth()
+	if basic {
+		// Only one authentication method may be used (RFC 6749 section 2.3)
+		if formClientSecret != "" {
+			sendOAuthError(c, http.StatusBadRequest, "invalid_request", "Use only one client authentication method")
+			return "", "", basic, false
+		}
+		// Credentials in the Basic header are form-encoded (RFC 6749 section 2.3.1)
+		var err1, err2 error
+		clientID, err1 = url.QueryUnescape(basicID)
+		clientSecret, err2 = url.QueryUnescape(basicSecret)
+		if err1 != nil || err2 != nil || (formClientID != "" && formClientID != clientID) {
+			sendOAuthError(c, http.StatusBadRequest, "invalid_request", "The client credentials are malformed")
+			return "", "", basic, false
+		}
+	}
+	return clientID, clientSecret, basic, true
+}
+
+// authenticateClient identifies the OAuth client from its credentials. ok is false once an error
+// response was written.
+func authenticateClient(c *gin.Context, formClientID, formClientSecret string) (*models.OAuthClient, bool) {
+	clientID, clientSecret, basic, ok := clientCredentials(c, formClientID, formClientSecret)
+	if !ok {
+		return nil, false
+	}
+
+	client, err := common.AuthenticateOAuthClient(clientID, clientSecret)
+	if err != nil {
+		sendClientAuthenticationError(c, err, basic)
+		return nil, false
+	}
+	return client, true
+}
+
+// sendClientAuthenticationError answers a failed client authentication
+func sendClientAuthenticationError(c *gin.Context, err error, basic bool) {
+	if errors.Is(err, common.ErrInvalidClient) {
+		if basic {
+			c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+		}
+		sendOAuthError(c, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+	} else {
+		sendOAuthError(c, http.StatusInternalServerError, "server_error", "Could not authenticate the client")
+	}
+}
+
+// serviceToken answers the client credentials grant (RFC 6749 section 4.4), which only our own
+// service clients may use
+func serviceToken(c *gin.Context, tokenReq models.OAuthTokenRequest) {
+	clientID, clientSecret, basic, ok := clientCredentials(c, tokenReq.ClientID, tokenReq.ClientSecret)
+	if !ok {
+		return
+	}
+
+	client, err := common.AuthenticateServiceClient(clientID, clientSecret)
+	if err != nil {
+		sendClientAuthenticationError(c, err, basic)
+		return
+	}
+
+	tokens, err := common.IssueServiceToken(client, tokenReq.Scope, tokenReq.Audience)
+	if err != nil {
+		switch {
+		case errors.Is(err, common.ErrInvalidScope):
+			sendOAuthError(c, http.StatusBadRequest, "invalid_scope", "The requested scope exceeds the client's scope")
+		case errors.Is(err, common.ErrInvalidTarget):
+			// RFC 8707 section 2 error code for resources the client may not access
+			sendOAuthError(c, http.StatusBadRequest, "invalid_target", "The client may not request tokens for this audience")
+		default:
+			sendOAuthError(c, http.StatusInternalServerError, "server_error", "Could not issue tokens")
+		}
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+	c.JSON(http.StatusOK, gin.H{
+		"access_token": tokens.AccessToken,
+		"token_type":   "Bearer",
+		"expires_in":   tokens.ExpiresIn,
+		"scope":        tokens.Scope,
+	})
+}
+
+// Introspect reports whether a token is active (RFC 7662). Service clients and trusted OAuth clients
+// can introspect any token, other confidential clients only the tokens issued to them.
+func Introspect(c *gin.Context) {
+	var introspectReq models.IntrospectionRequest
+	if err := c.ShouldBind(&introspectReq); err != nil || introspectReq.Token == "" {
+		sendOAuthError(c, http.StatusBadRequest, "invalid_request", "The token parameter is required")
+		return
+	}
+
+	clientID, trusted, ok := authenticateIntrospectionClient(c, introspectReq.ClientID, introspectReq.ClientSecret)
+	if !ok {
+		return
+	}
+
+	introspection, err := common.IntrospectToken(introspectReq.Token, introspectReq.TokenTypeHint)
+	if err != nil {
+		sendOAuthError(c, http.StatusInternalServerError, "server_error", "Could not introspect the token")
+		return
+	}
+	// Other clients' tokens are reported as inactive rather than revealing that they exist
+	if introspection != nil && introspection.ClientID != clientID && !trusted {
+		introspection = nil
+	}
+
+	// Callers may cache the answer briefly, but never beyond the token's expiry. A token that is not
+	// active can never become active again.
+	maxAge := configs.GetConfig().OAuth.IntrospectionCacheSeconds
+	if introspection != nil && !introspection.ExpiresAt.IsZero() {
+		if remaining := int(time.Until(introspection.ExpiresAt).Seconds()); remaining < maxAge {
+			maxAge = remaining
+		}
+	}
+	c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", maxAge))
+	c.Header("Vary", "Authorization")
+
+	if introspection == nil {
+		c.JSON(http.StatusOK, gin.H{"active": false})
+		return
+	}
+
+	response := gin.H{
+		"active":     true,
+		"sub":        introspection.Subject,
+		"token_type": introspection.TokenType,
+		"iat":        introspection.IssuedAt.Unix(),
+	}
+	if !introspection.ExpiresAt.IsZero() {
+		response["exp"] = introspection.ExpiresAt.Unix()
+	}
+	if introspection.Scope != "" {
+		response["scope"] = introspection.Scope
+	}
+	if introspection.ClientID != "" {
+		response["client_id"] = introspection.ClientID
+	}
+	if len(introspection.Audience) > 0 {
+		response["aud"] = introspection.Audience
+	}
+	if introspection.EmailVerified != nil {
+		response["email_verified"] = *introspection.EmailVerified
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// authenticateIntrospectionClient identifies the caller of the introspection endpoint: one of our
+// service clients, which are always trusted, or a confidential OAuth client, which is trusted when
+// listed in the configuration. ok is false once an error response was written.
+func authenticateIntrospectionClient(c *gin.Context, formClientID, formClientSecret string) (clientID string, trusted, ok bool) {
+	clientID, clientSecret, basic, ok := clientCredentials(c, formClientID, formClientSecret)
+	if !ok {
+		return "", false, false
+	}
+
+	// An OAuth client ID can start with the service prefix by chance, so a failed service
+	// authentication falls through to the OAuth clients
+	if strings.HasPrefix(clientID, common.ServiceClientIDPrefix) {
+		service, err := common.AuthenticateServiceClient(clientID, clientSecret)
+		if err == nil {
+			return service.ClientID, true, true
+		}
+		if !errors.Is(err, common.ErrInvalidClient) {
+			sendClientAuthenticationError(c, err, basic)
+			return "", false, false
+		}
+	}
+
+	client, err := common.AuthenticateOAuthClient(clientID, clientSecret)
+	if err != nil {
+		sendClientAuthenticationError(c, err, basic)
+		return "", false, false
+	}
+	if client.ClientType != models.OAuthClientConfidential {
+		sendOAuthError(c, http.StatusUnauthorized, "invalid_client", "Only confidential clients can introspect tokens")
+		return "", false, false
+	}
+	return client.ClientID, common.IsTrustedOAuthClient(client.ClientID), true
+}
+
+// Revoke revokes an access or refresh token and the session it belongs to (RFC 7009). OAuth clients
+// authenticate and can revoke their own tokens, trusted clients any token; without client credentials
+// only tokens of our own apps can be revoked. The answer is 200 whether or not the token was revoked.
+func Revoke(c *gin.Context) {
+	var revokeReq models.RevocationRequest
+	if err := c.ShouldBind(&revokeReq); err != nil || revokeReq.Token == "" {
+		sendOAuthError(c, http.StatusBadRequest, "invalid_request", "The token parameter is required")
+		return
+	}
+
+	// Our own apps are not registered clients; holding the token is enough for them to revoke it
+	clientID := ""
+	trusted := false
+	if _, _, basic := c.Request.BasicAuth(); basic || revokeReq.ClientID != "" {
+		client, ok := authenticateClient(c, revokeReq.ClientID, revokeReq.ClientSecret)
+		if !ok {
+			return
+		}
+		clientID = client.ClientID
+		trusted = client.ClientType == models.OAuthClientConfidential && common.IsTrustedOAuthClient(client.ClientID)
+	}
+
+	if err := common.RevokeToken(revokeReq.Token, revokeReq.TokenTypeHint, clientID, trusted); err != nil {
+		sendOAuthError(c, http.StatusServiceUnavailable, "temporarily_unavailable", "Could not revoke the token, try again")
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+}
+
+// sendOAuthError writes an error response in the format of RFC 6749 section 5.2
+func sendOAuthError(c *gin.Context, status int, code, description string) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+	c.JSON(status, gin.H{"error": code, "error_description": description})
+}
@@ -0,0 +1,32 @@
+package controller
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+var pageTemplates = template.Must(template.ParseFS(templateFS, "templates/*.html"))
+
+// renderPage writes one of the HTML pages used by the browser-facing OAuth endpoints.
+// The pages must never be framed, so the consent form cannot be clickjacked.
+func renderPage(c *gin.Context, status int, name string, data gin.H) {
+	var page bytes.Buffer
+	if err := pageTemplates.ExecuteTemplate(&page, name, data); err != nil {
+		log.Printf("Could not render %s: %v", name, err)
+		c.String(http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	c.Header("X-Frame-Options", "DENY")
+	c.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'none'")
+	c.Header("Cache-Control", "no-store")
+	c.Data(status, "text/html; charset=utf-8", page.Bytes())
+}
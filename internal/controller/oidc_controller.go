@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/Debt-Solvers/BE-auth-service/configs"
+	"github.com/Debt-Solvers/BE-auth-service/internal/common"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// OpenIDConfiguration publishes the OpenID Connect discovery document
+func OpenIDConfiguration(c *gin.Context) {
+	config := configs.GetConfig()
+	issuer := strings.TrimSuffix(config.OAuth.Issuer, "/")
+
+	scopes := make([]string, 0, len(common.ScopeDescriptions))
+	for scope := range common.ScopeDescriptions {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.JSON(http.StatusOK, gin.H{
+		"issuer":                                        config.OAuth.Issuer,
+		"authorization_endpoint":                        issuer + "/oauth/authorize",
+		"token_endpoint":                                issuer + "/oauth/token",
+		"userinfo_endpoint":                             issuer + "/oauth/userinfo",
+		"introspection_endpoint":                        issuer + "/oauth/introspect",
+		"revocation_endpoint":                           issuer + "/oauth/revoke",
+		"jwks_uri":                                      issuer + "/.well-known/jwks.json",
+		"scopes_supported":                              scopes,
+		"response_types_supported":                      []string{"code"},
+		"response_modes_supported":                      []string{"query"},
+		"grant_types_supported":                         []string{"authorization_code", "refresh_token", "client_credentials"},
+		"subject_types_supported":                       []string{"public"},
+		"id_token_signing_alg_values_supported":         []string{config.JWT.SigningAlgorithm},
+		"token_endpoint_auth_methods_supported":         []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":              []string{"S256"},
+		"introspection_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post"},
+		"revocation_endpoint_auth_methods_supported":    []string{"client_secret_basic", "client_secret_post", "none"},
+		"claims_supported":                              common.OIDCClaimsSupported,
+	})
+}
+
+// UserInfo returns the claims about the caller covered by the token's scopes (OpenID Connect Core section 5.3)
+func UserInfo(c *gin.Context) {
+	userID := c.MustGet("userId").(uuid.UUID)
+
+	// OAuth and personal access tokens only see the claims they were granted; our own apps see all of them
+	var scopes []string
+	if _, delegated := c.Get("scopes"); delegated {
+		scopes = c.GetStringSlice("scopes")
+	}
+
+	claims, err := common.GetUserClaims(userID, scopes)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, claims)
+}
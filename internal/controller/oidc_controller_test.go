@@ -0,0 +1,351 @@
+package controller_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Debt-Solvers/BE-auth-service/configs"
+	"github.com/Debt-Solvers/BE-auth-service/internal/common"
+	"github.com/Debt-Solvers/BE-auth-service/internal/keystore"
+	"github.com/Debt-Solvers/BE-auth-service/internal/models"
+	"github.com/Debt-Solvers/BE-auth-service/internal/testutil"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// relyingPartyRedirectURI is registered for the test client. The browser is never sent there; the
+// test reads the code from the redirect response.
+const relyingPartyRedirectURI = "http://127.0.0.1/callback"
+
+// relyingParty is an OpenID Connect client of the service, configured from its discovery document
+type relyingParty struct {
+	server       *httptest.Server
+	browser      *http.Client // Does not follow redirects, so the code can be read from them
+	client       *models.OAuthClient
+	clientSecret string
+	user         models.User
+	password     string
+
+	discovery struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		UserinfoEndpoint      string `json:"userinfo_endpoint"`
+		JWKSURI               string `json:"jwks_uri"`
+	}
+}
+
+// newRelyingParty registers a confidential client for a new user and loads the discovery document.
+// The issuer is the test server, so every URL the service publishes can be followed.
+func newRelyingParty(t *testing.T) *relyingParty {
+	t.Helper()
+	testutil.Database(t)
+
+	server := newServer(t)
+	config := configs.GetConfig()
+	issuer := config.OAuth.Issuer
+	config.OAuth.Issuer = server.URL
+	t.Cleanup(func() { config.OAuth.Issuer = issuer })
+
+	rp := &relyingParty{
+		server: server,
+		browser: &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}},
+		password: "correct horse battery staple",
+	}
+	rp.user = testutil.CreateUser(t, rp.password, true)
+
+	var err error
+	rp.client, rp.clientSecret, err = common.CreateOAuthClient(rp.user.UserID, "Test RP", models.OAuthClientConfidential,
+		[]string{relyingPartyRedirectURI}, "openid profile email")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rp.getJSON(t, server.URL+"/.well-known/openid-configuration", "", &rp.discovery)
+	if rp.discovery.Issuer != server.URL {
+		t.Fatalf("discovery issuer = %q, want %q", rp.discovery.Issuer, server.URL)
+	}
+	return rp
+}
+
+// authorizeParams are the parameters of an authorization request with a fresh state and PKCE verifier
+func (rp *relyingParty) authorizeParams(extra url.Values) (url.Values, string) {
+	verifier := strings.Repeat("v", 43) + fmt.Sprint(time.Now().UnixNano())
+	challenge := sha256.Sum256([]byte(verifier))
+
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {rp.client.ClientID},
+		"redirect_uri":          {relyingPartyRedirectURI},
+		"scope":                 {"openid profile email"},
+		"state":                 {"state-" + verifier[len(verifier)-8:]},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	for name, values := range extra {
+		params[name] = values
+	}
+	return params, verifier
+}
+
+// redirectParams returns the query of a redirect to the client's redirect URI
+func (rp *relyingParty) redirectParams(t *testing.T, resp *http.Response) url.Values {
+	t.Helper()
+
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("authorization returned %d, want a redirect", resp.StatusCode)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target := location.Scheme + "://" + location.Host + location.Path; target != relyingPartyRedirectURI {
+		t.Fatalf("redirected to %s, want %s", target, relyingPartyRedirectURI)
+	}
+	return location.Query()
+}
+
+// authorize shows the consent page, approves it with the user's password and returns the code
+func (rp *relyingParty) authorize(t *testing.T, params url.Values) string {
+	t.Helper()
+
+	page, err := rp.browser.Get(rp.discovery.AuthorizationEndpoint + "?" + params.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	page.Body.Close()
+	if page.StatusCode != http.StatusOK {
+		t.Fatalf("authorization page returned %d", page.StatusCode)
+	}
+
+	form := url.Values{"email": {rp.user.Email}, "password": {rp.password}, "decision": {"approve"}}
+	for name, values := range params {
+		form[name] = values
+	}
+	resp, err := rp.browser.PostForm(rp.discovery.AuthorizationEndpoint, form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	query := rp.redirectParams(t, resp)
+	if query.Get("state") != params.Get("state") {
+		t.Errorf("state = %q, want %q", query.Get("state"), params.Get("state"))
+	}
+	if query.Get("code") == "" {
+		t.Fatalf("no code in the redirect: %s", query.Get("error_description"))
+	}
+	return query.Get("code")
+}
+
+// exchange redeems the code at the token endpoint
+func (rp *relyingParty) exchange(t *testing.T, code, verifier string) (accessToken, idToken string) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, rp.discovery.TokenEndpoint, strings.NewReader(url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {relyingPartyRedirectURI},
+		"code_verifier": {verifier},
+	}.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(rp.client.ClientID), url.QueryEscape(rp.clientSecret))
+
+	resp, err := rp.server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var tokens struct {
+		AccessToken string `json:"access_token"`
+		IDToken     string `json:"id_token"`
+		Error       string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || tokens.AccessToken == "" || tokens.IDToken == "" {
+		t.Fatalf("token endpoint returned %d %s", resp.StatusCode, tokens.Error)
+	}
+	return tokens.AccessToken, tokens.IDToken
+}
+
+// verifyIDToken checks the ID token against the published key set the way a relying party does
+func (rp *relyingParty) verifyIDToken(t *testing.T, idToken string) jwt.MapClaims {
+	t.Helper()
+
+	var keySet struct {
+		Keys []keystore.JWK `json:"keys"`
+	}
+	rp.getJSON(t, rp.discovery.JWKSURI, "", &keySet)
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		for _, key := range keySet.Keys {
+			if key.KeyID == token.Header["kid"] {
+				if key.Algorithm != token.Method.Alg() {
+					return nil, fmt.Errorf("key %s is for %s", key.KeyID, key.Algorithm)
+				}
+				return jwkPublicKey(key)
+			}
+		}
+		return nil, fmt.Errorf("key %v is not published", token.Header["kid"])
+	},
+		jwt.WithIssuer(rp.discovery.Issuer),
+		jwt.WithAudience(rp.client.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		t.Fatalf("ID token does not verify: %v", err)
+	}
+	if claims["sub"] != rp.user.UserID.String() {
+		t.Errorf("sub = %v, want %s", claims["sub"], rp.user.UserID)
+	}
+	return claims
+}
+
+// getJSON fetches a JSON document, with the access token if one is given
+func (rp *relyingParty) getJSON(t *testing.T, target, accessToken string, v interface{}) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	resp, err := rp.server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s returned %d", target, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// jwkPublicKey decodes a published key
+func jwkPublicKey(key keystore.JWK) (interface{}, error) {
+	decode := func(value string) *big.Int {
+		raw, _ := base64.RawURLEncoding.DecodeString(value)
+		return new(big.Int).SetBytes(raw)
+	}
+
+	switch key.KeyType {
+	case "RSA":
+		return &rsa.PublicKey{N: decode(key.N), E: int(decode(key.E).Int64())}, nil
+	case "EC":
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: decode(key.X), Y: decode(key.Y)}, nil
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(key.X)
+		return ed25519.PublicKey(x), err
+	default:
+		return nil, fmt.Errorf("unexpected key type %q", key.KeyType)
+	}
+}
+
+func TestOpenIDConnectFlow(t *testing.T) {
+	rp := newRelyingParty(t)
+
+	started := time.Now().Truncate(time.Second)
+	params, verifier := rp.authorizeParams(url.Values{"nonce": {"n-0S6_WzA2Mj"}, "max_age": {"0"}})
+	accessToken, idToken := rp.exchange(t, rp.authorize(t, params), verifier)
+
+	claims := rp.verifyIDToken(t, idToken)
+	if claims["nonce"] != "n-0S6_WzA2Mj" {
+		t.Errorf("nonce = %v, want the one sent with the authorization request", claims["nonce"])
+	}
+	// max_age=0 asks for a fresh login, which the consent form always is
+	authTime, ok := claims["auth_time"].(float64)
+	if !ok {
+		t.Fatalf("auth_time is missing")
+	}
+	if at := time.Unix(int64(authTime), 0); at.Before(started) || at.After(time.Now()) {
+		t.Errorf("auth_time = %s, want the time of the login at %s", at, started)
+	}
+	if claims["email"] != rp.user.Email {
+		t.Errorf("email = %v, want %s", claims["email"], rp.user.Email)
+	}
+
+	var userInfo map[string]interface{}
+	rp.getJSON(t, rp.discovery.UserinfoEndpoint, accessToken, &userInfo)
+	if userInfo["sub"] != claims["sub"] {
+		t.Errorf("userinfo sub = %v, want %v", userInfo["sub"], claims["sub"])
+	}
+	if userInfo["email"] != rp.user.Email || userInfo["given_name"] != rp.user.FirstName {
+		t.Errorf("userinfo = %v", userInfo)
+	}
+}
+
+func TestOpenIDConnectWithoutNonce(t *testing.T) {
+	rp := newRelyingParty(t)
+
+	params, verifier := rp.authorizeParams(nil)
+	_, idToken := rp.exchange(t, rp.authorize(t, params), verifier)
+
+	if nonce, ok := rp.verifyIDToken(t, idToken)["nonce"]; ok {
+		t.Errorf("ID token carries nonce %v that was never sent", nonce)
+	}
+}
+
+func TestOpenIDConnectAuthorizeErrors(t *testing.T) {
+	rp := newRelyingParty(t)
+
+	for _, test := range []struct {
+		name  string
+		extra url.Values
+		error string
+	}{
+		// There is no browser session, so a login can never happen without the user
+		{"prompt=none", url.Values{"prompt": {"none"}}, "login_required"},
+		{"prompt=none with consent", url.Values{"prompt": {"none consent"}}, "login_required"},
+		{"negative max_age", url.Values{"max_age": {"-1"}}, "invalid_request"},
+		{"malformed max_age", url.Values{"max_age": {"soon"}}, "invalid_request"},
+		{"long nonce", url.Values{"nonce": {strings.Repeat("n", 513)}}, "invalid_request"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			params, _ := rp.authorizeParams(test.extra)
+			resp, err := rp.browser.Get(rp.discovery.AuthorizationEndpoint + "?" + params.Encode())
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			query := rp.redirectParams(t, resp)
+			if query.Get("error") != test.error {
+				t.Errorf("error = %q, want %q", query.Get("error"), test.error)
+			}
+			if query.Get("state") != params.Get("state") {
+				t.Errorf("state = %q, want %q", query.Get("state"), params.Get("state"))
+			}
+			if query.Get("code") != "" {
+				t.Error("an error redirect carries a code")
+			}
+		})
+	}
+}
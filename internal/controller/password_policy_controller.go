@@ -0,0 +1,45 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Debt-Solvers/BE-auth-service/internal/passwordpolicy"
+	"github.com/Debt-Solvers/BE-auth-service/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetPasswordPolicy returns the rules new passwords must meet, so apps can check them as the user types
+func GetPasswordPolicy(c *gin.Context) {
+	policy := passwordpolicy.Current()
+	utils.SendResponse(c, http.StatusOK, "Password policy retrieved successfully", gin.H{
+		"policy":       policy,
+		"requirements": policy.Requirements(),
+	}, nil)
+}
+
+// sendPasswordPolicyError answers with the violated rules if err is a policy error. It reports whether
+// a response was written.
+func sendPasswordPolicyError(c *gin.Context, err error) bool {
+	var policyErr *passwordpolicy.Error
+	if !errors.As(err, &policyErr) {
+		return false
+	}
+	utils.SendResponse(c, http.StatusBadRequest, "Password does not meet the requirements", nil, gin.H{"violations": policyErr.Violations})
+	return true
+}
+
+// withPasswordWarnings adds the warnings about an accepted password to the response data, such as it
+// having appeared in a data breach when the policy only warns about that
+func withPasswordWarnings(data gin.H, password string) gin.H {
+	warnings := passwordpolicy.Warnings(password)
+	if len(warnings) == 0 {
+		return data
+	}
+	if data == nil {
+		data = gin.H{}
+	}
+	data["password_warnings"] = warnings
+	return data
+}
@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Debt-Solvers/BE-auth-service/internal/common"
+	"github.com/Debt-Solvers/BE-auth-service/internal/models"
+	"github.com/Debt-Solvers/BE-auth-service/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CreatePersonalAccessToken issues a scoped token the caller can use in scripts
+func CreatePersonalAccessToken(c *gin.Context) {
+	var createReq models.CreatePersonalAccessTokenRequest
+	if err := c.ShouldBindJSON(&createReq); err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid request data", nil, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.MustGet("userId").(uuid.UUID)
+
+	pat, token, err := common.CreatePersonalAccessToken(userID, createReq.Name, createReq.Scope, createReq.ExpiresInDays)
+	if err != nil {
+		switch {
+		case errors.Is(err, common.ErrInvalidScope), errors.Is(err, common.ErrTooManyPersonalAccessTokens):
+			utils.SendResponse(c, http.StatusBadRequest, err.Error(), nil, nil)
+		default:
+			utils.SendResponse(c, http.StatusInternalServerError, "Could not create token", nil, nil)
+		}
+		return
+	}
+
+	data := personalAccessTokenResponse(*pat)
+	// The token is only stored as a hash, so this is the one chance to copy it
+	data["token"] = token
+	utils.SendResponse(c, http.StatusCreated, "Token created successfully", data, nil)
+}
+
+// ListPersonalAccessTokens returns the caller's personal access tokens without their secrets
+func ListPersonalAccessTokens(c *gin.Context) {
+	userID := c.MustGet("userId").(uuid.UUID)
+
+	pats, err := common.ListPersonalAccessTokens(userID)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Could not retrieve tokens", nil, nil)
+		return
+	}
+
+	tokenList := make([]gin.H, 0, len(pats))
+	for _, pat := range pats {
+		tokenList = append(tokenList, personalAccessTokenResponse(pat))
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Tokens retrieved successfully", gin.H{"tokens": tokenList}, nil)
+}
+
+// DeletePersonalAccessToken revokes one of the caller's personal access tokens
+func DeletePersonalAccessToken(c *gin.Context) {
+	userID := c.MustGet("userId").(uuid.UUID)
+
+	tokenID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid token ID", nil, nil)
+		return
+	}
+
+	if err := common.DeletePersonalAccessToken(userID, tokenID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.SendResponse(c, http.StatusNotFound, "Token not found", nil, nil)
+		} else {
+			utils.SendResponse(c, http.StatusInternalServerError, "Could not delete token", nil, nil)
+		}
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Token deleted successfully", nil, nil)
+}
+
+// personalAccessTokenResponse lists the fields of a token that are safe to show
+func personalAccessTokenResponse(pat models.PersonalAccessToken) gin.H {
+	return gin.H{
+		"id":           pat.TokenID,
+		"name":         pat.Name,
+		"token_hint":   pat.TokenHint,
+		"scope":        pat.Scope,
+		"created_at":   pat.CreatedAt,
+		"expires_at":   pat.ExpiresAt,
+		"last_used_at": pat.LastUsedAt,
+	}
+}
@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Debt-Solvers/BE-auth-service/internal/common"
+	"github.com/Debt-Solvers/BE-auth-service/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ListRoles returns the roles with the permissions they grant
+func ListRoles(c *gin.Context) {
+	roles, err := common.ListRoles()
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Could not retrieve roles", nil, nil)
+		return
+	}
+	permissions, err := common.RolePermissions()
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Could not retrieve roles", nil, nil)
+		return
+	}
+
+	roleList := make([]gin.H, 0, len(roles))
+	for _, role := range roles {
+		roleList = append(roleList, gin.H{
+			"name":        role.Name,
+			"description": role.Description,
+			"permissions": permissions[role.Name],
+		})
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Roles retrieved successfully", gin.H{"roles": roleList}, nil)
+}
+
+// GetUserRoles returns a user's roles and the permissions they add up to
+func GetUserRoles(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid user ID", nil, nil)
+		return
+	}
+
+	roles, _, err := common.GetUserRoles(userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.SendResponse(c, http.StatusNotFound, "User not found", nil, nil)
+		} else {
+			utils.SendResponse(c, http.StatusInternalServerError, "Could not retrieve roles", nil, nil)
+		}
+		return
+	}
+	permissions, err := common.PermissionsOfRoles(roles)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Could not retrieve roles", nil, nil)
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Roles retrieved successfully", gin.H{"roles": roles, "permissions": permissions}, nil)
+}
+
+// AssignRole gives a user a role; their existing tokens pick it up on the next permission check
+func AssignRole(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid user ID", nil, nil)
+		return
+	}
+	adminID := c.MustGet("userId").(uuid.UUID)
+
+	if err := common.AssignRole(userID, c.Param("role"), &adminID); err != nil {
+		sendRoleError(c, err, "Could not assign role")
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Role assigned successfully", nil, nil)
+}
+
+// RemoveRole takes a role away from a user; their existing tokens lose it on the next permission check
+func RemoveRole(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid user ID", nil, nil)
+		return
+	}
+	adminID := c.MustGet("userId").(uuid.UUID)
+
+	if err := common.RemoveRole(userID, c.Param("role"), adminID); err != nil {
+		sendRoleError(c, err, "Could not remove role")
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Role removed successfully", nil, nil)
+}
+
+// sendRoleError maps role assignment errors to responses
+func sendRoleError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		utils.SendResponse(c, http.StatusNotFound, "User or role assignment not found", nil, nil)
+	case errors.Is(err, common.ErrUnknownRole), errors.Is(err, common.ErrImplicitRole):
+		utils.SendResponse(c, http.StatusBadRequest, err.Error(), nil, nil)
+	case errors.Is(err, common.ErrLastAdmin):
+		utils.SendResponse(c, http.StatusConflict, err.Error(), nil, nil)
+	default:
+		utils.SendResponse(c, http.StatusInternalServerError, fallback, nil, nil)
+	}
+}
@@ -0,0 +1,84 @@
+package controller_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Debt-Solvers/BE-auth-service/internal/routes"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiResponse is the envelope written by utils.SendResponse
+type apiResponse struct {
+	Status  int             `json:"status"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// newServer returns the service's routes on an in-process HTTP server
+func newServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	routes.RegisterRoutes(engine)
+
+	server := httptest.NewServer(engine)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// callAPI sends a JSON request, with the access token if one is given, and decodes the envelope's data into v
+func callAPI(t *testing.T, server *httptest.Server, method, path, token string, body, v interface{}) int {
+	t.Helper()
+
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req, err := http.NewRequest(method, server.URL+path, &payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var envelope apiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		t.Fatalf("%s %s: could not decode the response: %v", method, path, err)
+	}
+	if v != nil && resp.StatusCode < 300 {
+		if err := json.Unmarshal(envelope.Data, v); err != nil {
+			t.Fatalf("%s %s: could not decode the data: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// login signs in with a password and returns the access token
+func login(t *testing.T, server *httptest.Server, email, password string) string {
+	t.Helper()
+
+	var tokens struct {
+		Token string `json:"token"`
+	}
+	status := callAPI(t, server, http.MethodPost, "/api/v1/login", "", gin.H{"email": email, "password": password}, &tokens)
+	if status != http.StatusOK || tokens.Token == "" {
+		t.Fatalf("login returned %d", status)
+	}
+	return tokens.Token
+}
@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Debt-Solvers/BE-auth-service/internal/common"
+	"github.com/Debt-Solvers/BE-auth-service/internal/models"
+	"github.com/Debt-Solvers/BE-auth-service/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CreateServiceClient registers one of our own services for the client credentials grant
+func CreateServiceClient(c *gin.Context) {
+	var createReq models.CreateServiceClientRequest
+	if err := c.ShouldBindJSON(&createReq); err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid request data", nil, gin.H{"error": err.Error()})
+		return
+	}
+
+	adminID := c.MustGet("userId").(uuid.UUID)
+
+	client, secret, err := common.CreateServiceClient(adminID, createReq.Name, createReq.Scope, createReq.Audiences)
+	if err != nil {
+		switch {
+		case errors.Is(err, common.ErrInvalidScope), errors.Is(err, common.ErrInvalidServiceValue):
+			utils.SendResponse(c, http.StatusBadRequest, err.Error(), nil, nil)
+		default:
+			utils.SendResponse(c, http.StatusInternalServerError, "Could not register service", nil, nil)
+		}
+		return
+	}
+
+	data := serviceClientResponse(*client)
+	// The secret is only stored as a hash, so this is the one chance to copy it
+	data["client_secret"] = secret
+	utils.SendResponse(c, http.StatusCreated, "Service registered successfully", data, nil)
+}
+
+// ListServiceClients returns every registered service client
+func ListServiceClients(c *gin.Context) {
+	clients, err := common.ListServiceClients()
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Could not retrieve services", nil, nil)
+		return
+	}
+
+	clientList := make([]gin.H, 0, len(clients))
+	for _, client := range clients {
+		clientList = append(clientList, serviceClientResponse(client))
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Services retrieved successfully", gin.H{"clients": clientList}, nil)
+}
+
+// DeleteServiceClient removes a service client, after which it can no longer get tokens
+func DeleteServiceClient(c *gin.Context) {
+	adminID := c.MustGet("userId").(uuid.UUID)
+
+	if err := common.DeleteServiceClient(adminID, c.Param("id")); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.SendResponse(c, http.StatusNotFound, "Service not found", nil, nil)
+		} else {
+			utils.SendResponse(c, http.StatusInternalServerError, "Could not delete service", nil, nil)
+		}
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Service deleted successfully", nil, nil)
+}
+
+// serviceClientResponse lists the fields of a service client that are safe to show
+func serviceClientResponse(client models.ServiceClient) gin.H {
+	return gin.H{
+		"client_id":  client.ClientID,
+		"name":       client.Name,
+		"scope":      client.Scope,
+		"audiences":  client.AudienceList(),
+		"created_by": client.CreatedBy,
+		"created_at": client.CreatedAt,
+	}
+}
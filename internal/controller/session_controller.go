@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Debt-Solvers/BE-auth-service/internal/common"
+	"github.com/Debt-Solvers/BE-auth-service/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ListSessions returns the caller's active sessions
+func ListSessions(c *gin.Context) {
+	// Get the user ID and current session ID from the middleware
+	userID := c.MustGet("userId").(uuid.UUID)
+	currentSessionID := c.MustGet("sessionId").(uuid.UUID)
+
+	sessions, err := common.ListActiveSessions(userID)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Could not retrieve sessions", nil, nil)
+		return
+	}
+
+	// Only expose the fields a user needs to recognise a device
+	sessionList := make([]gin.H, 0, len(sessions))
+	for _, session := range sessions {
+		sessionList = append(sessionList, gin.H{
+			"id":           session.TokenID,
+			"device_name":  session.DeviceName,
+			"user_agent":   session.UserAgent,
+			"ip_address":   session.IPAddress,
+			"created_at":   session.CreatedAt,
+			"last_used_at": session.LastUsedAt,
+			"client_id":    session.ClientID, // Set for sessions held by third-party applications
+			"current":      session.TokenID == currentSessionID,
+		})
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Sessions retrieved successfully", gin.H{"sessions": sessionList}, nil)
+}
+
+// RevokeSession ends one of the caller's sessions by ID
+func RevokeSession(c *gin.Context) {
+	userID := c.MustGet("userId").(uuid.UUID)
+
+	sessionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid session ID", nil, nil)
+		return
+	}
+
+	// Look the session up through the user so nobody can revoke someone else's session
+	session, err := common.GetUserSession(userID, sessionID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.SendResponse(c, http.StatusNotFound, "Session not found", nil, nil)
+		} else {
+			utils.SendResponse(c, http.StatusInternalServerError, "Could not revoke session", nil, nil)
+		}
+		return
+	}
+
+	if err := common.RevokeSession(session); err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Could not revoke session", nil, nil)
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Session revoked successfully", nil, nil)
+}
+
+// RevokeOtherSessions ends every session of the caller except the one making the request
+func RevokeOtherSessions(c *gin.Context) {
+	userID := c.MustGet("userId").(uuid.UUID)
+	currentSessionID := c.MustGet("sessionId").(uuid.UUID)
+
+	if err := common.RevokeUserSessions(userID, currentSessionID); err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Could not revoke sessions", nil, nil)
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "All other sessions revoked successfully", nil, nil)
+}
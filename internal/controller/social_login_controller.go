@@ -0,0 +1,141 @@
+package controller
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/Debt-Solvers/BE-auth-service/internal/common"
+	"github.com/Debt-Solvers/BE-auth-service/internal/connector"
+	"github.com/Debt-Solvers/BE-auth-service/internal/models"
+	"github.com/Debt-Solvers/BE-auth-service/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ListSocialLoginProviders returns the external providers users can sign in with
+func ListSocialLoginProviders(c *gin.Context) {
+	providers := make([]gin.H, 0)
+	for _, provider := range connector.Providers() {
+		providers = append(providers, gin.H{"name": provider.Name, "display_name": provider.DisplayName()})
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Login providers retrieved successfully", gin.H{"providers": providers}, nil)
+}
+
+// BeginSocialLogin returns the provider URL the app opens to sign the user in
+func BeginSocialLogin(c *gin.Context) {
+	authorizationURL, state, err := common.BeginSocialLogin(c.Param("provider"))
+	if err != nil {
+		if errors.Is(err, connector.ErrUnknownProvider) {
+			utils.SendResponse(c, http.StatusNotFound, "Login provider not found", nil, nil)
+		} else {
+			log.Printf("Could not start %s login: %v", c.Param("provider"), err)
+			utils.SendResponse(c, http.StatusBadGateway, "Could not reach the login provider", nil, nil)
+		}
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Social login started", gin.H{
+		"authorization_url": authorizationURL,
+		"state":             state,
+	}, nil)
+}
+
+// FinishSocialLogin exchanges the code the provider returned for our tokens, linking or creating the account
+func FinishSocialLogin(c *gin.Context) {
+	var finishReq models.FinishSocialLoginRequest
+	if err := c.ShouldBindJSON(&finishReq); err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid request data", nil, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := common.FinishSocialLogin(c.Param("provider"), finishReq.State, finishReq.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, connector.ErrUnknownProvider):
+			utils.SendResponse(c, http.StatusNotFound, "Login provider not found", nil, nil)
+		case errors.Is(err, common.ErrSocialLoginSessionInvalid):
+			utils.SendResponse(c, http.StatusBadRequest, "Social login has expired, please start again", nil, nil)
+		case errors.Is(err, common.ErrSocialEmailNotVerified):
+			utils.SendResponse(c, http.StatusForbidden, "The login provider has not verified your email address", nil, nil)
+		case errors.Is(err, utils.ErrPasswordHashingBusy):
+			sendPasswordHashingBusy(c)
+		case errors.Is(err, common.ErrSocialAccountConflict):
+			utils.SendResponse(c, http.StatusConflict, "An account with this email address already exists, please verify it or sign in with your password first", nil, nil)
+		default:
+			log.Printf("Could not finish %s login: %v", c.Param("provider"), err)
+			utils.SendResponse(c, http.StatusUnauthorized, "Login with the provider failed", nil, nil)
+		}
+		return
+	}
+
+	// The provider replaces the password, not the second factor
+	mfaEnabled, err := common.IsMFAEnabled(user.UserID)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Could not check multi-factor authentication", nil, nil)
+		return
+	}
+	if mfaEnabled {
+		sendMFAChallenge(c, user.UserID, finishReq.DeviceName)
+		return
+	}
+
+	// Issue an access token and a refresh token for a new session
+	tokens, err := issueTokens(c, user.UserID, finishReq.DeviceName)
+	if err != nil {
+		sendIssueTokensError(c, err)
+		return
+	}
+
+	tokens["userId"] = user.UserID
+	utils.SendResponse(c, http.StatusOK, "Login successful", tokens, nil)
+}
+
+// ListUserIdentities returns the login provider accounts linked to the caller
+func ListUserIdentities(c *gin.Context) {
+	userID := c.MustGet("userId").(uuid.UUID)
+
+	identities, err := common.ListUserIdentities(userID)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Could not retrieve linked accounts", nil, nil)
+		return
+	}
+
+	identityList := make([]gin.H, 0, len(identities))
+	for _, identity := range identities {
+		identityList = append(identityList, gin.H{
+			"id":            identity.IdentityID,
+			"provider":      identity.Provider,
+			"email":         identity.Email,
+			"created_at":    identity.CreatedAt,
+			"last_login_at": identity.LastLoginAt,
+		})
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Linked accounts retrieved successfully", gin.H{"identities": identityList}, nil)
+}
+
+// UnlinkUserIdentity removes one of the caller's linked login provider accounts
+func UnlinkUserIdentity(c *gin.Context) {
+	userID := c.MustGet("userId").(uuid.UUID)
+
+	identityID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid linked account ID", nil, nil)
+		return
+	}
+
+	if err := common.UnlinkUserIdentity(userID, identityID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.SendResponse(c, http.StatusNotFound, "Linked account not found", nil, nil)
+		} else {
+			utils.SendResponse(c, http.StatusInternalServerError, "Could not remove linked account", nil, nil)
+		}
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Linked account removed successfully", nil, nil)
+}
@@ -0,0 +1,145 @@
+package controller
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/Debt-Solvers/BE-auth-service/internal/common"
+	"github.com/Debt-Solvers/BE-auth-service/internal/models"
+	"github.com/Debt-Solvers/BE-auth-service/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// BeginWebAuthnRegistration returns the options the client passes to navigator.credentials.create
+func BeginWebAuthnRegistration(c *gin.Context) {
+	userID := c.MustGet("userId").(uuid.UUID)
+
+	creation, sessionID, err := common.BeginWebAuthnRegistration(userID)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Could not start passkey registration", nil, nil)
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Passkey registration started", gin.H{
+		"session_id": sessionID,
+		"options":    creation,
+	}, nil)
+}
+
+// FinishWebAuthnRegistration verifies the authenticator's response and stores the new credential
+func FinishWebAuthnRegistration(c *gin.Context) {
+	var finishReq models.FinishWebAuthnRequest
+	if err := c.ShouldBindJSON(&finishReq); err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid request data", nil, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.MustGet("userId").(uuid.UUID)
+
+	credential, err := common.FinishWebAuthnRegistration(userID, finishReq.SessionID, finishReq.Name, finishReq.Credential)
+	if err != nil {
+		if errors.Is(err, common.ErrWebAuthnSessionInvalid) {
+			utils.SendResponse(c, http.StatusBadRequest, "Passkey registration has expired, please start again", nil, nil)
+		} else {
+			utils.SendResponse(c, http.StatusBadRequest, "Passkey could not be verified", nil, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	utils.SendResponse(c, http.StatusCreated, "Passkey registered successfully", gin.H{"id": credential.ID}, nil)
+}
+
+// ListWebAuthnCredentials returns the caller's registered passkeys
+func ListWebAuthnCredentials(c *gin.Context) {
+	userID := c.MustGet("userId").(uuid.UUID)
+
+	credentials, err := common.ListWebAuthnCredentials(userID)
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Could not retrieve passkeys", nil, nil)
+		return
+	}
+
+	credentialList := make([]gin.H, 0, len(credentials))
+	for _, credential := range credentials {
+		credentialList = append(credentialList, gin.H{
+			"id":            credential.ID,
+			"name":          credential.Name,
+			"sign_count":    credential.SignCount,
+			"clone_warning": credential.CloneWarning,
+			"backed_up":     credential.BackupState,
+			"created_at":    credential.CreatedAt,
+			"last_used_at":  credential.LastUsedAt,
+		})
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Passkeys retrieved successfully", gin.H{"credentials": credentialList}, nil)
+}
+
+// DeleteWebAuthnCredential removes one of the caller's passkeys
+func DeleteWebAuthnCredential(c *gin.Context) {
+	userID := c.MustGet("userId").(uuid.UUID)
+
+	credentialID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid passkey ID", nil, nil)
+		return
+	}
+
+	if err := common.DeleteWebAuthnCredential(userID, credentialID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.SendResponse(c, http.StatusNotFound, "Passkey not found", nil, nil)
+		} else {
+			utils.SendResponse(c, http.StatusInternalServerError, "Could not delete passkey", nil, nil)
+		}
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Passkey deleted successfully", nil, nil)
+}
+
+// BeginWebAuthnLogin returns the options the client passes to navigator.credentials.get.
+// The authenticator picks a discoverable passkey, so every caller gets the same kind of response.
+func BeginWebAuthnLogin(c *gin.Context) {
+	assertion, sessionID, err := common.BeginWebAuthnLogin()
+	if err != nil {
+		utils.SendResponse(c, http.StatusInternalServerError, "Could not start passkey login", nil, nil)
+		return
+	}
+
+	utils.SendResponse(c, http.StatusOK, "Passkey login started", gin.H{
+		"session_id": sessionID,
+		"options":    assertion,
+	}, nil)
+}
+
+// FinishWebAuthnLogin verifies the assertion and issues tokens the same way as password login
+func FinishWebAuthnLogin(c *gin.Context) {
+	var finishReq models.FinishWebAuthnRequest
+	if err := c.ShouldBindJSON(&finishReq); err != nil {
+		utils.SendResponse(c, http.StatusBadRequest, "Invalid request data", nil, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := common.FinishWebAuthnLogin(finishReq.SessionID, finishReq.Credential)
+	if err != nil {
+		if errors.Is(err, common.ErrWebAuthnCloneDetected) {
+			log.Printf("Rejected passkey login with a cloned authenticator, session %s", finishReq.SessionID)
+		}
+		utils.SendResponse(c, http.StatusUnauthorized, "Invalid credentials", nil, nil)
+		return
+	}
+
+	// Issue an access token and a refresh token for a new session
+	tokens, err := issueTokens(c, userID, finishReq.DeviceName)
+	if err != nil {
+		sendIssueTokensError(c, err)
+		return
+	}
+
+	tokens["userId"] = userID
+	utils.SendResponse(c, http.StatusOK, "Login successful", tokens, nil)
+}
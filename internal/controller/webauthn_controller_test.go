@@ -0,0 +1,127 @@
+package controller_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Debt-Solvers/BE-auth-service/configs"
+	"github.com/Debt-Solvers/BE-auth-service/internal/testutil"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/google/uuid"
+)
+
+// passkey is one entry of the credential list
+type passkey struct {
+	ID           uuid.UUID `json:"id"`
+	SignCount    int64     `json:"sign_count"`
+	CloneWarning bool      `json:"clone_warning"`
+}
+
+// listPasskeys returns the caller's registered passkeys
+func listPasskeys(t *testing.T, server *httptest.Server, token string) []passkey {
+	t.Helper()
+
+	var list struct {
+		Credentials []passkey `json:"credentials"`
+	}
+	if status := callAPI(t, server, http.MethodGet, "/api/v1/webauthn/credentials", token, nil, &list); status != http.StatusOK {
+		t.Fatalf("listing passkeys returned %d", status)
+	}
+	return list.Credentials
+}
+
+// passkeyLogin runs a passkey login and returns the response status
+func passkeyLogin(t *testing.T, server *httptest.Server, authenticator *testutil.Authenticator) int {
+	t.Helper()
+
+	var begun struct {
+		SessionID uuid.UUID                    `json:"session_id"`
+		Options   protocol.CredentialAssertion `json:"options"`
+	}
+	if status := callAPI(t, server, http.MethodPost, "/api/v1/webauthn/login/begin", "", gin.H{}, &begun); status != http.StatusOK {
+		t.Fatalf("starting passkey login returned %d", status)
+	}
+	if len(begun.Options.Response.AllowedCredentials) != 0 {
+		t.Errorf("passkey login options list credentials: %+v", begun.Options.Response.AllowedCredentials)
+	}
+
+	response, err := authenticator.Login(&begun.Options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tokens struct {
+		Token string `json:"token"`
+	}
+	status := callAPI(t, server, http.MethodPost, "/api/v1/webauthn/login/finish", "", gin.H{
+		"session_id": begun.SessionID,
+		"credential": json.RawMessage(response),
+	}, &tokens)
+	if status == http.StatusOK && tokens.Token == "" {
+		t.Error("passkey login returned no access token")
+	}
+	return status
+}
+
+func TestWebAuthnEndpoints(t *testing.T) {
+	testutil.Database(t)
+	server := newServer(t)
+
+	password := "correct horse battery staple"
+	user := testutil.CreateUser(t, password, true)
+	token := login(t, server, user.Email, password)
+
+	authenticator, err := testutil.NewAuthenticator(configs.GetConfig().WebAuthn.RPOrigins[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Registration
+	var begun struct {
+		SessionID uuid.UUID                   `json:"session_id"`
+		Options   protocol.CredentialCreation `json:"options"`
+	}
+	if status := callAPI(t, server, http.MethodPost, "/api/v1/webauthn/register/begin", token, gin.H{}, &begun); status != http.StatusOK {
+		t.Fatalf("starting registration returned %d", status)
+	}
+	response, err := authenticator.Register(&begun.Options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := callAPI(t, server, http.MethodPost, "/api/v1/webauthn/register/finish", token, gin.H{
+		"session_id": begun.SessionID,
+		"name":       "Test key",
+		"credential": json.RawMessage(response),
+	}, nil)
+	if status != http.StatusCreated {
+		t.Fatalf("finishing registration returned %d", status)
+	}
+
+	passkeys := listPasskeys(t, server, token)
+	if len(passkeys) != 1 || passkeys[0].SignCount != 0 {
+		t.Fatalf("passkeys after registration = %+v", passkeys)
+	}
+
+	// Logins move the counter forward
+	authenticator.SignCount = 2
+	if status := passkeyLogin(t, server, authenticator); status != http.StatusOK {
+		t.Fatalf("passkey login returned %d", status)
+	}
+	if passkeys := listPasskeys(t, server, token); passkeys[0].SignCount != 2 {
+		t.Errorf("sign count after login = %d, want 2", passkeys[0].SignCount)
+	}
+
+	// A counter that goes backwards is rejected and flags the passkey
+	authenticator.SignCount = 1
+	if status := passkeyLogin(t, server, authenticator); status != http.StatusUnauthorized {
+		t.Fatalf("passkey login with a cloned authenticator returned %d, want %d", status, http.StatusUnauthorized)
+	}
+	passkeys = listPasskeys(t, server, token)
+	if !passkeys[0].CloneWarning || passkeys[0].SignCount != 2 {
+		t.Errorf("passkey after clone detection = %+v", passkeys[0])
+	}
+}
@@ -0,0 +1,205 @@
+package keystore
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Debt-Solvers/BE-auth-service/configs"
+	"github.com/Debt-Solvers/BE-auth-service/db"
+	"github.com/Debt-Solvers/BE-auth-service/internal/models"
+	"github.com/Debt-Solvers/BE-auth-service/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	// ErrNoSigningKey is returned when no key is active yet
+	ErrNoSigningKey = errors.New("no active signing key")
+	// ErrUnknownKey is returned when a token names a key that is not published
+	ErrUnknownKey = errors.New("unknown signing key")
+)
+
+// key is a decoded signing key
+type key struct {
+	kid         string
+	algorithm   string
+	method      jwt.SigningMethod
+	privateKey  crypto.Signer
+	jwk         JWK
+	activatesAt time.Time
+	expiresAt   time.Time
+}
+
+// Store keeps the published signing keys in memory and implements utils.SigningKeyProvider
+type Store struct {
+	mu   sync.RWMutex
+	keys []*key // Sorted by activation time, newest first
+}
+
+var defaultStore = &Store{}
+
+// Default returns the process-wide key store
+func Default() *Store {
+	return defaultStore
+}
+
+// Start makes sure a signing key exists, loads the keys and installs the store as the token signer.
+// A background loop then rotates keys on schedule and picks up keys created by other instances.
+func Start() error {
+	store := Default()
+	if err := Rotate(); err != nil {
+		return err
+	}
+	if err := store.Load(); err != nil {
+		return err
+	}
+	utils.SetSigningKeyProvider(store)
+
+	interval := time.Duration(configs.GetConfig().JWT.KeyRefreshSeconds) * time.Second
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := Rotate(); err != nil {
+				log.Printf("Key store: rotation failed: %v", err)
+			}
+			if err := store.Load(); err != nil {
+				log.Printf("Key store: reload failed: %v", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// Load replaces the in-memory keys with the unexpired keys from the database
+func (s *Store) Load() error {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	var rows []models.SigningKey
+	if err := DB.Where("expires_at > ?", time.Now()).Order("activates_at DESC").Find(&rows).Error; err != nil {
+		return err
+	}
+
+	keys := make([]*key, 0, len(rows))
+	for _, row := range rows {
+		loaded, err := decodeKey(row)
+		if err != nil {
+			return fmt.Errorf("signing key %s: %w", row.KID, err)
+		}
+		keys = append(keys, loaded)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].activatesAt.After(keys[j].activatesAt) })
+
+	s.mu.Lock()
+	s.keys = keys
+	s.mu.Unlock()
+	return nil
+}
+
+// SigningKey returns the most recently activated key
+func (s *Store) SigningKey() (string, jwt.SigningMethod, interface{}, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	for _, k := range s.keys {
+		if !k.activatesAt.After(now) {
+			return k.kid, k.method, k.privateKey, nil
+		}
+	}
+	return "", nil, nil, ErrNoSigningKey
+}
+
+// VerificationKey returns the public key of a published key
+func (s *Store) VerificationKey(kid string) (jwt.SigningMethod, interface{}, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	for _, k := range s.keys {
+		if k.kid == kid && k.expiresAt.After(now) {
+			return k.method, k.privateKey.Public(), nil
+		}
+	}
+	return nil, nil, ErrUnknownKey
+}
+
+// JWKS returns every published key, including keys that have not started signing yet
+func (s *Store) JWKS() []JWK {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	jwks := make([]JWK, 0, len(s.keys))
+	for _, k := range s.keys {
+		if k.expiresAt.After(now) {
+			jwks = append(jwks, k.jwk)
+		}
+	}
+	return jwks
+}
+
+// decodeKey decrypts a stored key and prepares it for signing
+func decodeKey(row models.SigningKey) (*key, error) {
+	method, err := signingMethod(row.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := utils.DecryptSecret(row.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, err := parsePrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+
+	jwk, err := publicJWK(row.KID, row.Algorithm, privateKey.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	return &key{
+		kid:         row.KID,
+		algorithm:   row.Algorithm,
+		method:      method,
+		privateKey:  privateKey,
+		jwk:         jwk,
+		activatesAt: row.ActivatesAt,
+		expiresAt:   row.ExpiresAt,
+	}, nil
+}
+
+// encodeKey builds the database row for a freshly generated key
+func encodeKey(kid, algorithm string, privateKey crypto.Signer) (models.SigningKey, error) {
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return models.SigningKey{}, err
+	}
+	encryptedPrivateKey, err := utils.EncryptSecret(privateDER)
+	if err != nil {
+		return models.SigningKey{}, err
+	}
+
+	publicDER, err := x509.MarshalPKIXPublicKey(privateKey.Public())
+	if err != nil {
+		return models.SigningKey{}, err
+	}
+
+	return models.SigningKey{
+		KID:        kid,
+		Algorithm:  algorithm,
+		PrivateKey: encryptedPrivateKey,
+		PublicKey:  base64.StdEncoding.EncodeToString(publicDER),
+	}, nil
+}
@@ -0,0 +1,99 @@
+package keystore
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Debt-Solvers/BE-auth-service/configs"
+	"github.com/Debt-Solvers/BE-auth-service/db"
+	"github.com/Debt-Solvers/BE-auth-service/internal/models"
+	"github.com/Debt-Solvers/BE-auth-service/utils"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// rotationLockID serialises rotation across instances with a Postgres advisory lock
+const rotationLockID = 0x6a776b73 // "jwks"
+
+// Rotate brings the key schedule up to date:
+//   - without any key, one is created that signs straight away
+//   - once the current key is within the publish window of its retirement, its successor is created
+//     so that it is in JWKS for the whole window before it starts signing
+//   - keys whose tokens have all expired are deleted
+//
+// It is safe to call from every instance; only one of them makes changes at a time.
+func Rotate() error {
+	// Get the DB instance
+	DB := db.GetDBInstance()
+
+	config := configs.GetConfig().JWT
+	rotation := time.Duration(config.KeyRotationDays) * 24 * time.Hour
+	publishAhead := time.Duration(config.KeyPublishHours) * time.Hour
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", rotationLockID).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if err := tx.Where("expires_at <= ?", now).Delete(&models.SigningKey{}).Error; err != nil {
+			return err
+		}
+
+		var latest models.SigningKey
+		err := tx.Order("activates_at DESC").First(&latest).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			_, err := createKey(tx, config.SigningAlgorithm, now, rotation)
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		// The newest key has not taken over yet, so its predecessor is still signing and nothing is due
+		if latest.ActivatesAt.After(now) {
+			return nil
+		}
+		if now.Before(latest.RetiresAt.Add(-publishAhead)) {
+			return nil
+		}
+
+		// The successor is announced for at least the publish window, even if the schedule was missed
+		activatesAt := latest.RetiresAt
+		if earliest := now.Add(publishAhead); activatesAt.Before(earliest) {
+			activatesAt = earliest
+		}
+		if _, err := createKey(tx, config.SigningAlgorithm, activatesAt, rotation); err != nil {
+			return err
+		}
+
+		// The current key signs until then, and its tokens must verify for as long as they live
+		return tx.Model(&latest).Updates(map[string]interface{}{
+			"retires_at": activatesAt,
+			"expires_at": activatesAt.Add(utils.MaxSignedTokenTTL()),
+		}).Error
+	})
+}
+
+// createKey generates and stores a key that signs from activatesAt for one rotation period
+func createKey(tx *gorm.DB, algorithm string, activatesAt time.Time, rotation time.Duration) (*models.SigningKey, error) {
+	privateKey, err := generateKey(algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	row, err := encodeKey(uuid.New().String(), algorithm, privateKey)
+	if err != nil {
+		return nil, err
+	}
+	row.CreatedAt = time.Now()
+	row.ActivatesAt = activatesAt
+	row.RetiresAt = activatesAt.Add(rotation)
+	row.ExpiresAt = row.RetiresAt.Add(utils.MaxSignedTokenTTL())
+
+	if err := tx.Create(&row).Error; err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
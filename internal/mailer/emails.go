@@ -0,0 +1,29 @@
+package mailer
+
+import "github.com/Debt-Solvers/BE-auth-service/configs"
+
+// LoginUnlockEmail composes the notice that sign-in was locked, with a link that lifts the lock
+func LoginUnlockEmail(to, unlockToken string) (Message, error) {
+	config := configs.GetConfig().LoginThrottle
+	link := config.UnlockLinkURL + unlockToken
+	return Compose(to, TemplateLoginUnlock, struct {
+		Link    string
+		Minutes int
+	}{Link: link, Minutes: config.LockoutMinutes})
+}
+
+// PasswordResetEmail composes the email carrying a password reset code
+func PasswordResetEmail(to, code string) (Message, error) {
+	return Compose(to, TemplatePasswordReset, struct{ Code string }{Code: code})
+}
+
+// SecurityAlertEmail composes a notice about a security-relevant event on the user's account
+func SecurityAlertEmail(to, subject, message string) (Message, error) {
+	return Compose(to, TemplateSecurityAlert, struct{ Subject, Message string }{Subject: subject, Message: message})
+}
+
+// VerificationEmail composes the email address verification link
+func VerificationEmail(to, verificationToken string) (Message, error) {
+	link := configs.GetConfig().EmailVerification.LinkURL + verificationToken
+	return Compose(to, TemplateEmailVerification, struct{ Link string }{Link: link})
+}
@@ -0,0 +1,37 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FileMailer drops each message into a directory as an .eml file that any mail client can open
+type FileMailer struct {
+	dir string
+}
+
+// NewFileMailer creates a mailer writing to dir, creating the directory if needed
+func NewFileMailer(dir string) (*FileMailer, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("mail file directory is not configured")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileMailer{dir: dir}, nil
+}
+
+// Send writes the message to <timestamp>-<id>.eml
+func (m *FileMailer) Send(msg Message) error {
+	body, err := buildMIME(msg)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405"), uuid.New())
+	return os.WriteFile(filepath.Join(m.dir, name), body, 0o644)
+}
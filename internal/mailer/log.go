@@ -0,0 +1,17 @@
+package mailer
+
+import "log"
+
+// LogMailer writes messages to the application log instead of sending them. Useful in development.
+type LogMailer struct{}
+
+// NewLogMailer creates a mailer that logs every message
+func NewLogMailer() *LogMailer {
+	return &LogMailer{}
+}
+
+// Send logs the recipient, subject and text body
+func (m *LogMailer) Send(msg Message) error {
+	log.Printf("Email to %s: %s\n%s", msg.To, msg.Subject, msg.Text)
+	return nil
+}
@@ -0,0 +1,102 @@
+package mailer
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/Debt-Solvers/BE-auth-service/configs"
+)
+
+// Driver names accepted in the mail.driver setting
+const (
+	DriverSMTP   = "smtp"
+	DriverLog    = "log"
+	DriverFile   = "file"
+	DriverMemory = "memory"
+)
+
+// Message is a rendered email ready to be delivered
+type Message struct {
+	Template string `json:"template"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Subject  string `json:"subject"`
+	Text     string `json:"text"`
+	HTML     string `json:"html"`
+}
+
+// Mailer delivers messages through one transport
+type Mailer interface {
+	Send(msg Message) error
+}
+
+var (
+	defaultMailer    Mailer
+	defaultMailerErr error
+	defaultMailerMu  sync.Mutex
+)
+
+// New builds the mailer selected by the mail configuration
+func New(config *configs.Config) (Mailer, error) {
+	switch config.Mail.Driver {
+	case DriverSMTP:
+		return NewSMTPMailer(config.Mail.SMTP.Host, config.Mail.SMTP.Port, config.Mail.SMTP.Username, config.Mail.SMTP.Password), nil
+	case DriverLog:
+		return NewLogMailer(), nil
+	case DriverFile:
+		return NewFileMailer(config.Mail.FileDir)
+	case DriverMemory:
+		return NewMemoryMailer(), nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", config.Mail.Driver)
+	}
+}
+
+// Default returns the mailer configured in configs.Config, creating it on first use
+func Default() (Mailer, error) {
+	defaultMailerMu.Lock()
+	defer defaultMailerMu.Unlock()
+
+	if defaultMailer == nil && defaultMailerErr == nil {
+		defaultMailer, defaultMailerErr = New(configs.GetConfig())
+	}
+	return defaultMailer, defaultMailerErr
+}
+
+// SetDefault replaces the mailer used by Send, e.g. with a MemoryMailer in tests
+func SetDefault(m Mailer) {
+	defaultMailerMu.Lock()
+	defer defaultMailerMu.Unlock()
+
+	defaultMailer, defaultMailerErr = m, nil
+}
+
+// Compose renders the named template into a message from the configured sender to a single recipient
+func Compose(to, template string, data interface{}) (Message, error) {
+	msg, err := Render(template, data)
+	if err != nil {
+		return Message{}, err
+	}
+	msg.Template = template
+	msg.From = sender()
+	msg.To = to
+	return msg, nil
+}
+
+// Send delivers a message through the default mailer
+func Send(msg Message) error {
+	m, err := Default()
+	if err != nil {
+		return err
+	}
+	return m.Send(msg)
+}
+
+// sender formats the configured From address
+func sender() string {
+	config := configs.GetConfig().Mail
+	if config.FromName == "" {
+		return config.From
+	}
+	return fmt.Sprintf("%s <%s>", config.FromName, config.From)
+}
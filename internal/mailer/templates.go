@@ -0,0 +1,55 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Names of the transactional email templates
+const (
+	TemplatePasswordReset     = "password_reset"
+	TemplateSecurityAlert     = "security_alert"
+	TemplateEmailVerification = "email_verification"
+	TemplateLoginUnlock       = "login_unlock"
+)
+
+// Each email is a pair of templates, <name>.html and <name>.txt. The text template defines
+// a "subject" block, and both are rendered with the same data.
+//
+//go:embed templates/*.html templates/*.txt
+var templateFS embed.FS
+
+var (
+	htmlTemplates = htmltemplate.Must(htmltemplate.ParseFS(templateFS, "templates/*.html"))
+	textTemplates = texttemplate.Must(texttemplate.ParseFS(templateFS, "templates/*.txt"))
+)
+
+// Render produces the subject, text and HTML bodies of the named email
+func Render(name string, data interface{}) (Message, error) {
+	textTemplate := textTemplates.Lookup(name + ".txt")
+	htmlTemplate := htmlTemplates.Lookup(name + ".html")
+	if textTemplate == nil || htmlTemplate == nil {
+		return Message{}, fmt.Errorf("unknown email template %q", name)
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := textTemplate.ExecuteTemplate(&subject, name+".subject", data); err != nil {
+		return Message{}, err
+	}
+	if err := textTemplate.Execute(&text, data); err != nil {
+		return Message{}, err
+	}
+	if err := htmlTemplate.Execute(&html, data); err != nil {
+		return Message{}, err
+	}
+
+	return Message{
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    strings.TrimSpace(text.String()) + "\n",
+		HTML:    html.String(),
+	}, nil
+}
@@ -3,6 +3,7 @@ package middleware
 import (
 	"github.com/Debt-Solvers/BE-auth-service/internal/common"
 	"github.com/Debt-Solvers/BE-auth-service/utils"
+	"log"
 	"net/http"
 	"strings"
 
@@ -23,24 +24,129 @@ func AuthMiddleware() gin.HandlerFunc {
 		// Stripping "Bearer " prefix
 		tokenString = strings.TrimPrefix(tokenString, "Bearer ")
 
+		// Personal access tokens are opaque and limited to the scopes chosen when they were created
+		if utils.IsPersonalAccessToken(tokenString) {
+			pat, owner, err := common.AuthenticatePersonalAccessToken(tokenString)
+			if err != nil {
+				utils.SendResponse(c, http.StatusUnauthorized, "Token is invalid or expired", nil, nil)
+				c.Abort()
+				return
+			}
+			c.Set("userId", pat.UserID)
+			c.Set("tokenString", tokenString)
+			c.Set("emailVerified", owner.IsEmailVerified)
+			c.Set("personalAccessTokenId", pat.TokenID)
+			c.Set("scopes", strings.Fields(pat.Scope))
+			c.Next()
+			return
+		}
+
 		// Check if token exists in the database
-		if !common.IsTokenActive(tokenString) { // Create `IsTokenActive` function
+		session, err := common.GetActiveToken(tokenString)
+		if err != nil {
+			// Service tokens have no session; they identify a service, not a user
+			if _, serviceErr := utils.VerifyServiceToken(tokenString); serviceErr == nil {
+				utils.SendResponse(c, http.StatusForbidden, "Service tokens cannot be used on user endpoints", nil, nil)
+				c.Abort()
+				return
+			}
 			utils.SendResponse(c, http.StatusUnauthorized, "Token is invalid or expired", nil, nil)
 			c.Abort()
 			return
 		}
 
-		// Call VerifyToken to validate the token and extract the user ID
-		userId, err := utils.VerifyToken(tokenString)
+		// Call VerifyTokenClaims to validate the token and extract the user ID
+		userId, claims, err := utils.VerifyTokenClaims(tokenString)
 		if err != nil {
 			utils.SendResponse(c, http.StatusUnauthorized, err.Error(), nil, nil)
 			c.Abort()
 			return
 		}
 
-		// Store the userId and tokenString in the context for further use
+		// Record session activity for the session list
+		if err := common.TouchSession(session); err != nil {
+			log.Printf("Failed to update session last-used time: %v", err)
+		}
+
+		// Store the userId, tokenString and sessionId in the context for further use
 		c.Set("userId", userId)
 		c.Set("tokenString", tokenString)
+		c.Set("sessionId", session.TokenID)
+		// Tokens issued before the email address was verified carry email_verified=false
+		emailVerified, ok := claims["email_verified"].(bool)
+		c.Set("emailVerified", !ok || emailVerified)
+		// Tokens issued to OAuth clients name the client and are limited to the granted scopes
+		if clientID, ok := claims["client_id"].(string); ok {
+			scope, _ := claims["scope"].(string)
+			c.Set("clientId", clientID)
+			c.Set("scopes", strings.Fields(scope))
+		}
+		// Roles are only issued to our own apps; tokens from before roles existed carry none and
+		// no version, so RequirePermission reads the roles from the database
+		roleVersion := -1
+		if version, ok := claims["role_version"].(float64); ok {
+			roleVersion = int(version)
+		}
+		var roles []string
+		if claimed, ok := claims["roles"].([]interface{}); ok {
+			for _, role := range claimed {
+				if name, ok := role.(string); ok {
+					roles = append(roles, name)
+				}
+			}
+		}
+		c.Set("roles", roles)
+		c.Set("roleVersion", roleVersion)
+		c.Next()
+	}
+}
+
+// FirstPartyOnly rejects tokens issued to OAuth clients and personal access tokens, keeping account
+// management to our own apps.
+// It must run after AuthMiddleware.
+func FirstPartyOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, delegated := c.Get("scopes"); delegated {
+			utils.SendResponse(c, http.StatusForbidden, "This endpoint is not available to third-party applications", nil, nil)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireScope lets through first-party tokens, and OAuth and personal access tokens that were granted the scope.
+// It must run after AuthMiddleware.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, delegated := c.Get("scopes"); delegated {
+			granted := false
+			for _, s := range c.GetStringSlice("scopes") {
+				if s == scope {
+					granted = true
+					break
+				}
+			}
+			if !granted {
+				c.Header("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+scope+`"`)
+				utils.SendResponse(c, http.StatusForbidden, "Token is missing the "+scope+" scope", nil, nil)
+				c.Abort()
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// RequireVerifiedEmail rejects reduced-scope tokens issued to accounts whose email is not verified yet.
+// It must run after AuthMiddleware.
+func RequireVerifiedEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !c.GetBool("emailVerified") {
+			utils.SendResponse(c, http.StatusForbidden, "Please verify your email address to use this feature", nil, nil)
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
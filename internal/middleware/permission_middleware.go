@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/Debt-Solvers/BE-auth-service/internal/common"
+	"github.com/Debt-Solvers/BE-auth-service/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RequirePermission only lets through users whose roles grant the permission. Roles that changed after
+// the token was issued are picked up through the token's role version, see common.HasPermission.
+// It must run after AuthMiddleware.
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Roles are never delegated to OAuth clients or personal access tokens
+		if _, delegated := c.Get("scopes"); delegated {
+			utils.SendResponse(c, http.StatusForbidden, "Missing permission "+permission, nil, nil)
+			c.Abort()
+			return
+		}
+
+		allowed, err := common.HasPermission(c.MustGet("userId").(uuid.UUID), c.GetStringSlice("roles"), c.GetInt("roleVersion"), permission)
+		if err != nil {
+			utils.SendResponse(c, http.StatusInternalServerError, "Could not check permissions", nil, nil)
+			c.Abort()
+			return
+		}
+		if !allowed {
+			utils.SendResponse(c, http.StatusForbidden, "Missing permission "+permission, nil, nil)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Debt-Solvers/BE-auth-service/configs"
+	"github.com/Debt-Solvers/BE-auth-service/internal/ratelimit"
+	"github.com/Debt-Solvers/BE-auth-service/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxRateLimitBodyBytes bounds how much of a request body is read to find the email address
+const maxRateLimitBodyBytes = 64 << 10
+
+// storeFailureLogInterval is how often store failures are logged while they continue
+const storeFailureLogInterval = time.Minute
+
+// storeFailures counts requests let through unlimited because the store failed
+var storeFailures struct {
+	mu       sync.Mutex
+	count    int
+	loggedAt time.Time
+}
+
+// RateLimit limits requests under the named rule in rate_limit.rules. A rule limiting by both IP and
+// email keeps a limit for each, and a request must pass both. Responses carry the RateLimit-Limit,
+// RateLimit-Remaining and RateLimit-Reset headers of the tightest limit, and refused requests a
+// Retry-After header. Buckets are charged in the order of the rule's `by` list and the first refusal
+// stops the rest, so requests refused by IP do not use up the email address's limit. If the store
+// fails, requests are let through rather than locking everyone out, and the failures are logged.
+func RateLimit(name string) gin.HandlerFunc {
+	rule := configs.GetConfig().RateLimit.Rules[name]
+	limit := ratelimit.Limit{Requests: rule.Requests, Period: time.Duration(rule.PeriodSeconds) * time.Second}
+	if limit.Requests <= 0 || limit.Period <= 0 {
+		log.Printf("Rate limit: rule %q is not configured, requests are not limited", name)
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	return func(c *gin.Context) {
+		store, err := ratelimit.Default()
+		if err != nil {
+			logStoreFailure(err)
+			c.Next()
+			return
+		}
+
+		var tightest *ratelimit.Result
+		for _, key := range rateLimitKeys(c, name, rule.By) {
+			result, err := store.Take(key, limit)
+			if err != nil {
+				logStoreFailure(err)
+				continue
+			}
+			if tightest == nil || tighter(result, *tightest) {
+				tightest = &result
+			}
+			if !result.Allowed {
+				break
+			}
+		}
+		if tightest == nil {
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(tightest.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(tightest.Remaining))
+		c.Header("RateLimit-Reset", ceilSeconds(tightest.Reset))
+		if !tightest.Allowed {
+			c.Header("Retry-After", ceilSeconds(tightest.RetryAfter))
+			utils.SendResponse(c, http.StatusTooManyRequests, "Too many requests, please try again later", nil, nil)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// logStoreFailure records a request let through because the store failed. While the store keeps
+// failing, it logs at most once per storeFailureLogInterval with the number of failures since.
+func logStoreFailure(err error) {
+	storeFailures.mu.Lock()
+	defer storeFailures.mu.Unlock()
+
+	storeFailures.count++
+	if time.Since(storeFailures.loggedAt) < storeFailureLogInterval {
+		return
+	}
+	log.Printf("Rate limit: store failed, %d requests not limited since the last report: %v", storeFailures.count, err)
+	storeFailures.count = 0
+	storeFailures.loggedAt = time.Now()
+}
+
+// rateLimitKeys returns the bucket keys of the request. Email addresses are hashed so the store
+// does not hold them in plain text.
+func rateLimitKeys(c *gin.Context, name string, by []string) []string {
+	var keys []string
+	for _, kind := range by {
+		switch kind {
+		case configs.RateLimitByIP:
+			keys = append(keys, name+":ip:"+c.ClientIP())
+		case configs.RateLimitByEmail:
+			if email := requestEmail(c); email != "" {
+				keys = append(keys, name+":email:"+utils.HashToken(email))
+			}
+		}
+	}
+	return keys
+}
+
+// requestEmail reads the email field of a JSON body and puts the body back for the handler
+func requestEmail(c *gin.Context) string {
+	if c.Request.Body == nil {
+		return ""
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxRateLimitBodyBytes))
+	c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), c.Request.Body))
+	if err != nil {
+		return ""
+	}
+
+	var fields struct {
+		Email string `json:"email"`
+	}
+	if json.Unmarshal(body, &fields) != nil {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(fields.Email))
+}
+
+// tighter reports whether result a should be reported over b: refusals first, then the fewest requests left
+func tighter(a, b ratelimit.Result) bool {
+	if a.Allowed != b.Allowed {
+		return !a.Allowed
+	}
+	if !a.Allowed {
+		return a.RetryAfter > b.RetryAfter
+	}
+	return a.Remaining < b.Remaining
+}
+
+// ceilSeconds formats a duration as whole seconds, rounded up
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AuditLog is a row in the shared audit_logs table
+type AuditLog struct {
+	LogID      uuid.UUID  `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	UserID     *uuid.UUID `gorm:"type:uuid"`
+	ActorID    *uuid.UUID `gorm:"type:uuid"`                  // Admin who performed the action, nil for the user's own actions
+	Table      string     `gorm:"column:table_name;not null"` // Table or area the action touched
+	Action     string     `gorm:"not null"`
+	OldData    []byte     `gorm:"type:jsonb"`
+	NewData    []byte     `gorm:"type:jsonb"`
+	ChangeDate time.Time
+}
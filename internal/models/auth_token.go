@@ -6,11 +6,17 @@ import (
 	"github.com/google/uuid"
 )
 
+// AuthToken is an issued access token. Each row is also the user's view of a login session.
 type AuthToken struct {
-	TokenID   uuid.UUID `gorm:"type:uuid;primary_key;default:uuid_generate_v4()"` // Primary key
-	UserID    uuid.UUID `gorm:"type:uuid;not null"`
-	Token     string    `gorm:"not null;unique"` // Token as a string
-	CreatedAt time.Time
-	ExpiresAt time.Time
+	TokenID    uuid.UUID  `gorm:"type:uuid;primary_key;default:uuid_generate_v4()"` // Primary key
+	UserID     uuid.UUID  `gorm:"type:uuid;not null"`
+	FamilyID   *uuid.UUID `gorm:"type:uuid"`       // Refresh token family the access token was issued for
+	Token      string     `gorm:"not null;unique"` // Token as a string
+	DeviceName string     // Name supplied by the client at login, e.g. "Pixel 8"
+	UserAgent  string
+	IPAddress  string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	LastUsedAt *time.Time
+	ClientID   *string // OAuth client the token was issued to, nil for the first-party apps
 }
-
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Delivery states of an EmailOutbox entry
+const (
+	EmailStatusPending = "pending" // Waiting for (another) delivery attempt
+	EmailStatusSent    = "sent"
+	EmailStatusDead    = "dead" // Gave up after too many attempts; can be retried by an admin
+)
+
+// EmailOutbox is a rendered email waiting to be delivered by the outbox worker
+type EmailOutbox struct {
+	EmailID       uuid.UUID `gorm:"type:uuid;primary_key;default:uuid_generate_v4()"` // Primary key
+	Template      string    `gorm:"not null"`
+	Sender        string    `gorm:"not null"`
+	Recipient     string    `gorm:"not null"`
+	Subject       string    `gorm:"not null"`
+	TextBody      string    `gorm:"not null"` // The bodies are cleared once the email is sent
+	HTMLBody      string    `gorm:"column:html_body;not null"`
+	Status        string    `gorm:"not null"`
+	Attempts      int       `gorm:"not null"`
+	LastError     string
+	NextAttemptAt time.Time
+	CreatedAt     time.Time
+	SentAt        *time.Time
+}
+
+// TableName keeps GORM from pluralising the table name
+func (EmailOutbox) TableName() string {
+	return "email_outbox"
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// LoginThrottle tracks failed password logins for one email address, whether or not an account uses it
+type LoginThrottle struct {
+	Email           string     `gorm:"primaryKey"` // Lowercased
+	FailedAttempts  int        `gorm:"not null;default:0"`
+	LastFailedAt    *time.Time // Attempts older than login_throttle.window_minutes are forgotten
+	NextAttemptAt   *time.Time // Earlier attempts are refused without checking the password
+	LockedUntil     *time.Time
+	UnlockTokenHash *string // SHA-256 of the token in the unlock link, the token itself is never stored
+}
@@ -0,0 +1,116 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OAuth client types from RFC 6749 section 2.1
+const (
+	OAuthClientConfidential = "confidential" // Can keep a secret, e.g. a partner's backend
+	OAuthClientPublic       = "public"       // Cannot keep a secret, e.g. a mobile or single-page app
+)
+
+// OAuthClient is a third-party application registered to request delegated access
+type OAuthClient struct {
+	ClientID         string    `gorm:"primaryKey"`
+	ClientSecretHash string    // SHA-256 of the secret, empty for public clients
+	ClientType       string    `gorm:"not null"`
+	Name             string    `gorm:"not null"`
+	RedirectURIs     string    `gorm:"column:redirect_uris;not null"` // Space-separated, matched exactly
+	Scope            string    `gorm:"not null"`                      // Space-separated scopes the client may request
+	OwnerID          uuid.UUID `gorm:"type:uuid;not null"`            // User who registered the client
+	CreatedAt        time.Time
+}
+
+// RedirectURIList returns the registered redirect URIs
+func (c *OAuthClient) RedirectURIList() []string {
+	return strings.Fields(c.RedirectURIs)
+}
+
+// OAuthAuthorizationCode is a short-lived code handed to the client's redirect URI after consent
+type OAuthAuthorizationCode struct {
+	CodeID        uuid.UUID `gorm:"type:uuid;primary_key;default:uuid_generate_v4()"` // Primary key
+	CodeHash      string    `gorm:"not null;unique"`                                  // SHA-256 of the code
+	ClientID      string    `gorm:"not null"`
+	UserID        uuid.UUID `gorm:"type:uuid;not null"`
+	RedirectURI   string    `gorm:"not null"`
+	Scope         string    `gorm:"not null"`
+	CodeChallenge string    `gorm:"not null"` // PKCE S256 challenge
+	CreatedAt     time.Time
+	ExpiresAt     time.Time
+	UsedAt        *time.Time
+	FamilyID      *uuid.UUID `gorm:"type:uuid"` // Tokens issued for the code, revoked if the code is replayed
+	Nonce         string     // OpenID Connect nonce, echoed in the ID token
+	AuthTime      time.Time  // When the user entered their credentials
+}
+
+// OAuthConsent records the scopes a user has granted to a client
+type OAuthConsent struct {
+	UserID    uuid.UUID `gorm:"type:uuid;primaryKey"`
+	ClientID  string    `gorm:"primaryKey"`
+	Scope     string    `gorm:"not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type CreateOAuthClientRequest struct {
+	Name         string   `json:"name" binding:"required,max=100"`
+	ClientType   string   `json:"client_type" binding:"required,oneof=confidential public"`
+	RedirectURIs []string `json:"redirect_uris" binding:"required,min=1,max=10,dive,required"`
+	Scope        string   `json:"scope" binding:"required"`
+}
+
+// AuthorizeRequest carries the parameters of /oauth/authorize, as query parameters or form fields
+type AuthorizeRequest struct {
+	ResponseType        string `form:"response_type"`
+	ClientID            string `form:"client_id"`
+	RedirectURI         string `form:"redirect_uri"`
+	Scope               string `form:"scope"`
+	State               string `form:"state"`
+	CodeChallenge       string `form:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method"`
+	Nonce               string `form:"nonce"`   // OpenID Connect only
+	MaxAge              string `form:"max_age"` // OpenID Connect only, in seconds
+	Prompt              string `form:"prompt"`  // OpenID Connect only
+}
+
+// AuthorizeDecisionRequest is the login and consent form posted back to /oauth/authorize
+type AuthorizeDecisionRequest struct {
+	AuthorizeRequest
+	Email    string `form:"email"`
+	Password string `form:"password"`
+	Code     string `form:"code"`     // TOTP code for accounts with MFA
+	Decision string `form:"decision"` // "approve" or "deny"
+}
+
+// OAuthTokenRequest is the form posted to /oauth/token
+type OAuthTokenRequest struct {
+	GrantType    string `form:"grant_type"`
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	CodeVerifier string `form:"code_verifier"`
+	RefreshToken string `form:"refresh_token"`
+	Scope        string `form:"scope"`
+	Audience     string `form:"audience"` // Client credentials grant only, space-separated services
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+}
+
+// IntrospectionRequest is the form posted to /oauth/introspect
+type IntrospectionRequest struct {
+	Token         string `form:"token"`
+	TokenTypeHint string `form:"token_type_hint"`
+	ClientID      string `form:"client_id"`
+	ClientSecret  string `form:"client_secret"`
+}
+
+// RevocationRequest is the form posted to /oauth/revoke
+type RevocationRequest struct {
+	Token         string `form:"token"`
+	TokenTypeHint string `form:"token_type_hint"`
+	ClientID      string `form:"client_id"`
+	ClientSecret  string `form:"client_secret"`
+}
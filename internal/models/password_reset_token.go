@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PasswordResetToken is a single-use code emailed to a user who forgot their password
+type PasswordResetToken struct {
+	TokenID        uuid.UUID `gorm:"type:uuid;primary_key;default:uuid_generate_v4()"` // Primary key
+	UserID         uuid.UUID `gorm:"type:uuid;not null"`
+	TokenHash      string    `gorm:"not null"` // SHA-256 of the code, the code itself is never stored
+	FailedAttempts int       `gorm:"default:0"`
+	CreatedAt      time.Time
+	ExpiresAt      time.Time
+	UsedAt         *time.Time // Set once the code is used or replaced
+}
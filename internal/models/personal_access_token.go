@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PersonalAccessToken lets a user's scripts call the API with a limited set of scopes
+type PersonalAccessToken struct {
+	TokenID    uuid.UUID `gorm:"type:uuid;primary_key;default:uuid_generate_v4()"` // Primary key
+	UserID     uuid.UUID `gorm:"type:uuid;not null"`
+	Name       string    `gorm:"size:100;not null"`
+	TokenHash  string    `gorm:"not null;unique"` // SHA-256 of the token, the token itself is never stored
+	TokenHint  string    `gorm:"not null"`        // Prefix and last characters, so users can tell their tokens apart
+	Scope      string    `gorm:"not null"`        // Space-separated scopes
+	CreatedAt  time.Time
+	ExpiresAt  *time.Time // Nil for tokens that do not expire
+	LastUsedAt *time.Time
+}
+
+type CreatePersonalAccessTokenRequest struct {
+	Name          string `json:"name" binding:"required,max=100"`
+	Scope         string `json:"scope" binding:"required"`
+	ExpiresInDays int    `json:"expires_in_days" binding:"min=0,max=366"` // 0 for a token that does not expire
+}
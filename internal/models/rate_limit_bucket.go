@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// RateLimitBucket is the token bucket of one rate-limited key, shared by every replica
+type RateLimitBucket struct {
+	Key       string    `gorm:"primaryKey"` // Rule name, key type and value, e.g. login:ip:203.0.113.7
+	Tokens    float64   `gorm:"not null"`   // Requests left, refilled continuously
+	UpdatedAt time.Time `gorm:"not null"`   // When Tokens was last computed
+}
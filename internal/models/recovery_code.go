@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RecoveryCode is a single-use code that can stand in for the second factor at login.
+// Codes carry 160 random bits, so like reset codes they are stored as a SHA-256 hash and looked up by it.
+type RecoveryCode struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null"`
+	CodeHash  string    `gorm:"not null"` // utils.HashToken of the normalized code
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// TableName keeps the table name explicit about what the codes recover
+func (RecoveryCode) TableName() string {
+	return "mfa_recovery_codes"
+}
+
+type RegenerateRecoveryCodesRequest struct {
+	Password string `json:"password" binding:"required"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RefreshToken is a long-lived opaque token that can be exchanged for a new access token.
+// Tokens rotated from the same login share a FamilyID so the whole chain can be revoked at once.
+type RefreshToken struct {
+	TokenID   uuid.UUID `gorm:"type:uuid;primary_key;default:uuid_generate_v4()"` // Primary key
+	UserID    uuid.UUID `gorm:"type:uuid;not null"`
+	FamilyID  uuid.UUID `gorm:"type:uuid;not null"`
+	TokenHash string    `gorm:"not null;unique"` // SHA-256 of the token, the token itself is never stored
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	RotatedAt *time.Time // Set once the token has been exchanged for a successor
+	RevokedAt *time.Time // Set when the family is revoked
+	ClientID  *string    // OAuth client the token was issued to, nil for the first-party apps
+	Scope     string     // Scopes granted to the OAuth client
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
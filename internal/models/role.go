@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Role is a named set of permissions
+type Role struct {
+	Name        string `gorm:"primaryKey"`
+	Description string `gorm:"not null"`
+}
+
+// Permission allows an action on the admin endpoints
+type Permission struct {
+	Name        string `gorm:"primaryKey"`
+	Description string `gorm:"not null"`
+}
+
+// RolePermission grants a permission to everyone holding the role
+type RolePermission struct {
+	Role       string `gorm:"primaryKey"`
+	Permission string `gorm:"primaryKey"`
+}
+
+// UserRole assigns a role to a user on top of the user role every account holds
+type UserRole struct {
+	UserID     uuid.UUID  `gorm:"type:uuid;primaryKey"`
+	Role       string     `gorm:"primaryKey"`
+	AssignedBy *uuid.UUID `gorm:"type:uuid"` // Admin who assigned the role, nil for configured admins
+	AssignedAt time.Time
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ServiceClient is one of our own services, which gets tokens for itself with the client credentials grant
+type ServiceClient struct {
+	ClientID         string     `gorm:"primaryKey"`
+	ClientSecretHash string     `gorm:"not null"` // SHA-256 of the secret
+	Name             string     `gorm:"not null"`
+	Scope            string     `gorm:"not null"`  // Space-separated scopes the client may request
+	Audiences        string     `gorm:"not null"`  // Space-separated services the client may get tokens for
+	CreatedBy        *uuid.UUID `gorm:"type:uuid"` // Admin who registered the client
+	CreatedAt        time.Time
+}
+
+// AudienceList returns the services the client may get tokens for
+func (c *ServiceClient) AudienceList() []string {
+	return strings.Fields(c.Audiences)
+}
+
+type CreateServiceClientRequest struct {
+	Name      string   `json:"name" binding:"required,max=100"`
+	Scope     string   `json:"scope" binding:"required"`
+	Audiences []string `json:"audiences" binding:"required,min=1,max=20,dive,required"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// SigningKey is an asymmetric key pair used to sign JWTs. A key is published in JWKS from creation
+// until ExpiresAt, signs new tokens between ActivatesAt and RetiresAt, and is deleted once expired.
+type SigningKey struct {
+	KID         string `gorm:"column:kid;primaryKey"`
+	Algorithm   string `gorm:"not null"`
+	PrivateKey  string `gorm:"not null"` // PKCS #8 DER, encrypted with the service encryption key
+	PublicKey   string `gorm:"not null"` // PKIX DER, base64 encoded
+	CreatedAt   time.Time
+	ActivatesAt time.Time
+	RetiresAt   time.Time
+	ExpiresAt   time.Time // RetiresAt plus the longest token lifetime
+}
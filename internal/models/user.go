@@ -10,6 +10,7 @@ import (
 	"github.com/Debt-Solvers/BE-auth-service/utils"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type User struct {
@@ -18,17 +19,24 @@ type User struct {
 	LastName          string    `gorm:"not null" json:"last_name"`
 	Email             string    `gorm:"unique;not null" json:"email"`
 	PasswordHash      string    `gorm:"not null" json:"password"` // Change json tag to "password"
-	Salt              string    `gorm:"not null" json:"-"`
+	Salt              string    `gorm:"not null" json:"-"` // Only set for legacy bcrypt hashes, cleared when the hash is upgraded
 	IsEmailVerified   bool      `gorm:"default:false" json:"is_email_verified"`
 	CreatedAt         time.Time `gorm:"autoCreateTime" json:"created_at"`
-	ResetPasswordToken string    `gorm:"size:255" json:"-"`
-	ResetPasswordExpires time.Time `json:"reset_password_expires"`
 	Currency          string    `gorm:"type:char(3);default:CAD;check:currency in ('CAD', 'USD')" json:"currency"`
+	RoleVersion       int       `gorm:"not null;default:0" json:"-"` // Bumped whenever the user's roles change
+
+	// Set by admins
+	DisabledAt            *time.Time `json:"disabled_at"`                                           // Disabled accounts cannot sign in
+	PasswordResetRequired bool       `gorm:"not null;default:false" json:"password_reset_required"` // Sign-in is blocked until the password is reset
+
+	// Set when a login finds the password in the breach dataset, cleared when it changes
+	PasswordBreachedAt *time.Time `json:"password_breached_at"`
 }
 
 type LoginRequest struct {
 	Email string `json:"email" binding:"required"`
 	Password string `json:"password" binding:"required"`
+	DeviceName string `json:"device_name" binding:"max=100"` // Optional label shown in the session list
 }
 
 type ResetPassword struct {
@@ -36,6 +44,7 @@ type ResetPassword struct {
 }
 
 type ConfirmResetPassword struct {
+	Email       string `json:"email" binding:"required,email"`
 	Token       string `json:"token" binding:"required"`
 	NewPassword string `json:"new_password" binding:"required"`
 }
@@ -45,6 +54,18 @@ type UpdatePassword struct {
 	NewPassword     string `json:"new_password" binding:"required"`
 }
 
+type VerifyEmailRequest struct {
+	Token string `json:"token" form:"token" binding:"required"`
+}
+
+type UnlockLoginRequest struct {
+	Token string `json:"token" form:"token" binding:"required"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
 type UpdateUser struct {
 	FirstName string `json:"first_name" binding:"required"`
 	LastName  string `json:"last_name" binding:"required"`
@@ -52,11 +73,10 @@ type UpdateUser struct {
 }
 
 
-// CreateUser saves a new user to the database after validating and hashing the password
-func (u *User) CreateUser() error {
+// CreateUser saves a new user to the database after validating and hashing the password.
+// Pass db.GetDBInstance() or the transaction the user should be created in.
+func (u *User) CreateUser(DB *gorm.DB) error {
 	
-	// Use GetDBInstance to get the DB instance
-	DB:= db.GetDBInstance()
 	// Validate the user object
 	if err := u.Validate(); err != nil {
 		return fmt.Errorf("validation failed: %w", err)
@@ -65,23 +85,24 @@ func (u *User) CreateUser() error {
 	// Generate a new UUID for the user
 	u.UserID = uuid.New()
 
-	// Generate a unique salt for the password
-	u.Salt = utils.GenSalt()
-
-	// Hash the password with the generated salt
-	hashedPassword, err := utils.HashPassword(u.PasswordHash, u.Salt) // Hash the password with the salt
+	// Hash the password, the hash carries its own salt
+	hashedPassword, err := utils.HashPassword(u.PasswordHash)
 	
 	if err != nil {
 		return fmt.Errorf("failed to hash password: %w", err)
 	}
 
 	u.PasswordHash = hashedPassword
-	u.IsEmailVerified = true
+	u.IsEmailVerified = false // Verified once the user follows the link in the verification email
 	u.CreatedAt = time.Now()
-	u.ResetPasswordToken = ""
-	u.ResetPasswordExpires = time.Time{}
 	u.Currency = "CAD"
 
+	// Account state is set by admins and logins, never by the signup request
+	u.RoleVersion = 0
+	u.DisabledAt = nil
+	u.PasswordResetRequired = false
+	u.PasswordBreachedAt = nil
+
 	// Save the user to the database using GORM
 	if err := DB.Create(u).Error; err != nil {
 		return err // Return error if saving to the database fails
@@ -129,3 +150,13 @@ func (u *User) GetUserByEmail(email string) error {
 	DB := db.GetDBInstance()
 	return DB.Where("email = ?", email).First(u).Error
 }
+
+
+// AdminUserSearch holds the query parameters of the admin user search
+type AdminUserSearch struct {
+	Query   string `form:"q" binding:"max=100"`                                                  // Matched against email and name
+	Page    int    `form:"page" binding:"omitempty,min=1"`                                       // Starts at 1
+	PerPage int    `form:"per_page" binding:"omitempty,min=1,max=100"`                           // Defaults to 20
+	Sort    string `form:"sort" binding:"omitempty,oneof=email first_name last_name created_at"` // Defaults to created_at
+	Order   string `form:"order" binding:"omitempty,oneof=asc desc"`                             // Defaults to desc
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserIdentity links a user to their account at an external login provider.
+// A user can have a password and any number of linked identities.
+type UserIdentity struct {
+	IdentityID  uuid.UUID `gorm:"type:uuid;primary_key;default:uuid_generate_v4()"` // Primary key
+	UserID      uuid.UUID `gorm:"type:uuid;not null"`
+	Provider    string    `gorm:"not null"` // Key of the provider in configs.Config
+	Subject     string    `gorm:"not null"` // Stable user ID at the provider
+	Email       string    // Email the provider last asserted
+	CreatedAt   time.Time
+	LastLoginAt *time.Time
+}
+
+// SocialLoginSession holds the state of a social login between begin and finish
+type SocialLoginSession struct {
+	StateHash    string `gorm:"primaryKey"` // SHA-256 of the state parameter
+	Provider     string `gorm:"not null"`
+	Nonce        string `gorm:"not null"`
+	CodeVerifier string `gorm:"not null"` // PKCE verifier for the provider's token endpoint
+	ExpiresAt    time.Time
+}
+
+type FinishSocialLoginRequest struct {
+	State      string `json:"state" binding:"required"`
+	Code       string `json:"code" binding:"required"`
+	DeviceName string `json:"device_name" binding:"max=100"`
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserMFA holds a user's TOTP second factor. The secret is encrypted with utils.EncryptSecret.
+type UserMFA struct {
+	UserID         uuid.UUID `gorm:"type:uuid;primaryKey"`
+	TOTPSecret     string    `gorm:"column:totp_secret;not null"`
+	Enabled        bool      `gorm:"default:false"`
+	EnabledAt      *time.Time
+	LastUsedStep   int64 // Last accepted TOTP time step, so a code cannot be replayed
+	FailedAttempts int
+	LastFailedAt   *time.Time
+	CreatedAt      time.Time
+}
+
+// TableName keeps GORM from pluralising the table name
+func (UserMFA) TableName() string {
+	return "user_mfa"
+}
+
+// EnrollTOTPRequest carries the current password, so a stolen token cannot attach the thief's authenticator
+type EnrollTOTPRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+type VerifyTOTPRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type DisableTOTPRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// MFALoginRequest completes a login with either a TOTP code or a recovery code
+type MFALoginRequest struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code" binding:"required_without=RecoveryCode"`
+	RecoveryCode string `json:"recovery_code" binding:"required_without=Code"`
+}
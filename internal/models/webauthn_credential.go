@@ -0,0 +1,47 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WebAuthnCredential is a passkey or security key registered to a user
+type WebAuthnCredential struct {
+	ID              uuid.UUID `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	UserID          uuid.UUID `gorm:"type:uuid;not null"`
+	Name            string    `gorm:"size:100"`        // Label chosen by the user, e.g. "iPhone"
+	CredentialID    []byte    `gorm:"not null;unique"` // Credential ID generated by the authenticator
+	PublicKey       []byte    `gorm:"not null"`        // COSE-encoded public key
+	AttestationType string
+	Transports      string // Comma-separated transports hinted by the authenticator
+	AAGUID          []byte `gorm:"column:aaguid"`
+	SignCount       int64
+	CloneWarning    bool
+	UserVerified    bool
+	BackupEligible  bool
+	BackupState     bool
+	CreatedAt       time.Time
+	LastUsedAt      *time.Time
+}
+
+// WebAuthnSession holds the server side of a registration or login ceremony between begin and finish
+type WebAuthnSession struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	UserID    *uuid.UUID `gorm:"type:uuid"` // Empty for logins, where the user is not known yet
+	Ceremony  string     `gorm:"size:20;not null"`
+	Data      []byte     `gorm:"type:jsonb;not null"` // Serialised webauthn.SessionData
+	ExpiresAt time.Time
+}
+
+type BeginWebAuthnRegistrationRequest struct {
+	Name string `json:"name" binding:"max=100"`
+}
+
+type FinishWebAuthnRequest struct {
+	SessionID  uuid.UUID       `json:"session_id" binding:"required"`
+	Name       string          `json:"name" binding:"max=100"`
+	DeviceName string          `json:"device_name" binding:"max=100"`
+	Credential json.RawMessage `json:"credential" binding:"required"` // PublicKeyCredential as returned by the authenticator
+}
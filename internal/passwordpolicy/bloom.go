@@ -0,0 +1,102 @@
+package passwordpolicy
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// bloomMagic starts every Bloom filter file written by BloomFilter.WriteTo
+var bloomMagic = []byte("DSBLOOM1")
+
+// BloomFilter is a compact set of SHA-1 hashes. It never misses a hash that was added and wrongly
+// reports a hash that was not with the false positive rate it was sized for.
+type BloomFilter struct {
+	bits   []byte
+	m      uint64 // Number of bits
+	hashes uint32 // Bits set per entry
+}
+
+// NewBloomFilter sizes a filter for n entries at the given false positive rate
+func NewBloomFilter(n uint64, falsePositiveRate float64) (*BloomFilter, error) {
+	if n == 0 || falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		return nil, errors.New("a Bloom filter needs at least one entry and a false positive rate between 0 and 1")
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	hashes := uint32(math.Max(1, math.Round(float64(m)/float64(n)*math.Ln2)))
+	return &BloomFilter{bits: make([]byte, (m+7)/8), m: m, hashes: hashes}, nil
+}
+
+// positions calls fn with every bit of the hash. SHA-1 output is already uniform, so its first two
+// 64-bit words serve as the two base hashes of double hashing.
+func (f *BloomFilter) positions(hash [sha1.Size]byte, fn func(bit uint64) bool) {
+	h1 := binary.BigEndian.Uint64(hash[0:8])
+	h2 := binary.BigEndian.Uint64(hash[8:16]) | 1
+	for i := uint64(0); i < uint64(f.hashes); i++ {
+		if !fn((h1 + i*h2) % f.m) {
+			return
+		}
+	}
+}
+
+// Add puts a hash in the filter
+func (f *BloomFilter) Add(hash [sha1.Size]byte) {
+	f.positions(hash, func(bit uint64) bool {
+		f.bits[bit/8] |= 1 << (bit % 8)
+		return true
+	})
+}
+
+// Contains reports whether the hash is probably in the filter
+func (f *BloomFilter) Contains(hash [sha1.Size]byte) (bool, error) {
+	found := true
+	f.positions(hash, func(bit uint64) bool {
+		found = f.bits[bit/8]&(1<<(bit%8)) != 0
+		return found
+	})
+	return found, nil
+}
+
+// WriteTo writes the filter in the format read by ReadBloomFilter
+func (f *BloomFilter) WriteTo(w io.Writer) (int64, error) {
+	header := make([]byte, len(bloomMagic)+4+8)
+	copy(header, bloomMagic)
+	binary.BigEndian.PutUint32(header[len(bloomMagic):], f.hashes)
+	binary.BigEndian.PutUint64(header[len(bloomMagic)+4:], f.m)
+
+	n, err := w.Write(header)
+	if err != nil {
+		return int64(n), err
+	}
+	written, err := w.Write(f.bits)
+	return int64(n + written), err
+}
+
+// ReadBloomFilter reads a filter written by WriteTo
+func ReadBloomFilter(r io.Reader) (*BloomFilter, error) {
+	reader := bufio.NewReader(r)
+	header := make([]byte, len(bloomMagic)+4+8)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, fmt.Errorf("reading Bloom filter header: %w", err)
+	}
+	if string(header[:len(bloomMagic)]) != string(bloomMagic) {
+		return nil, errors.New("not a Bloom filter file")
+	}
+
+	f := &BloomFilter{
+		hashes: binary.BigEndian.Uint32(header[len(bloomMagic):]),
+		m:      binary.BigEndian.Uint64(header[len(bloomMagic)+4:]),
+	}
+	if f.hashes == 0 || f.m == 0 {
+		return nil, errors.New("corrupt Bloom filter header")
+	}
+	f.bits = make([]byte, (f.m+7)/8)
+	if _, err := io.ReadFull(reader, f.bits); err != nil {
+		return nil, fmt.Errorf("reading Bloom filter: %w", err)
+	}
+	return f, nil
+}
@@ -0,0 +1,278 @@
+package passwordpolicy
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Debt-Solvers/BE-auth-service/configs"
+)
+
+// Values for the password_policy.breached_passwords setting
+const (
+	BreachedOff   = "off"   // Breached passwords are not looked up
+	BreachedWarn  = "warn"  // Breached passwords are accepted with a warning
+	BreachedBlock = "block" // Breached passwords are rejected
+)
+
+// RuleBreached is reported for passwords found in the breach dataset
+const RuleBreached = "breached"
+
+// maxHashLineBytes bounds a line of a hash file: 40 hex digits, a count and a line break
+const maxHashLineBytes = 256
+
+// BreachDataset is a set of SHA-1 hashes of breached passwords
+type BreachDataset interface {
+	Contains(hash [sha1.Size]byte) (bool, error)
+}
+
+// hashFile is a Have I Been Pwned style file of uppercase SHA-1 hashes sorted by hash, one per line and
+// optionally followed by ":count". It is binary searched on disk, so the full corpus never has to fit
+// in memory.
+type hashFile struct {
+	file *os.File
+	size int64
+}
+
+// Contains binary searches the file for the hash. Every line starting in [lo, hi) is a candidate.
+func (h *hashFile) Contains(hash [sha1.Size]byte) (bool, error) {
+	target := []byte(fmt.Sprintf("%X", hash[:]))
+
+	lo, hi := int64(0), h.size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+
+		// Find the first line starting at or after mid
+		start := mid
+		if mid > lo {
+			_, next, err := h.lineAt(mid - 1)
+			if err != nil {
+				return false, err
+			}
+			start = next
+		}
+		if start >= hi {
+			hi = mid
+			continue
+		}
+
+		line, next, err := h.lineAt(start)
+		if err != nil {
+			return false, err
+		}
+		if len(line) < len(target) {
+			return false, fmt.Errorf("malformed line at offset %d", start)
+		}
+		switch bytes.Compare(bytes.ToUpper(line[:len(target)]), target) {
+		case 0:
+			return true, nil
+		case -1:
+			lo = next
+		default:
+			hi = mid
+		}
+	}
+	return false, nil
+}
+
+// lineAt returns the rest of the line containing offset, without the line break, and where the next line starts
+func (h *hashFile) lineAt(offset int64) ([]byte, int64, error) {
+	buf := make([]byte, maxHashLineBytes)
+	n, err := h.file.ReadAt(buf, offset)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, 0, err
+	}
+	buf = buf[:n]
+
+	if i := bytes.IndexByte(buf, '\n'); i >= 0 {
+		return bytes.TrimRight(buf[:i], "\r"), offset + int64(i) + 1, nil
+	}
+	if offset+int64(n) < h.size {
+		return nil, 0, fmt.Errorf("line at offset %d is too long", offset)
+	}
+	return bytes.TrimRight(buf, "\r"), h.size, nil
+}
+
+// LoadBreachDataset opens a sorted hash file or reads a Bloom filter built by cmd/breach-filter,
+// telling them apart by the filter's header
+func LoadBreachDataset(path string) (BreachDataset, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, len(bloomMagic))
+	if _, err := io.ReadFull(file, header); err == nil && bytes.Equal(header, bloomMagic) {
+		defer file.Close()
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return ReadBloomFilter(file)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	h := &hashFile{file: file, size: info.Size()}
+
+	// Reject files that are not hash lists before they replace a working dataset
+	line, _, err := h.lineAt(0)
+	if err == nil && (len(line) < 2*sha1.Size || !isHex(line[:2*sha1.Size])) {
+		err = errors.New("not a SHA-1 hash file or Bloom filter")
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return h, nil
+}
+
+func isHex(b []byte) bool {
+	_, err := hex.DecodeString(string(b))
+	return err == nil
+}
+
+var (
+	breachDataset   BreachDataset
+	breachDatasetMu sync.RWMutex
+)
+
+// SetBreachDataset replaces the dataset passwords are looked up in. A replaced hash file is closed
+// once the lookups still using it are done.
+func SetBreachDataset(dataset BreachDataset) {
+	breachDatasetMu.Lock()
+	previous := breachDataset
+	breachDataset = dataset
+	breachDatasetMu.Unlock()
+
+	if h, ok := previous.(*hashFile); ok && previous != dataset {
+		// New lookups already use the new dataset; give running ones time to finish
+		time.AfterFunc(time.Minute, func() { h.file.Close() })
+	}
+}
+
+// breachedPasswordsMode returns the configured mode, which is off while no dataset is loaded
+func breachedPasswordsMode(configured string) string {
+	breachDatasetMu.RLock()
+	defer breachDatasetMu.RUnlock()
+	if breachDataset == nil || (configured != BreachedWarn && configured != BreachedBlock) {
+		return BreachedOff
+	}
+	return configured
+}
+
+// ScreeningEnabled reports whether passwords are looked up in a breach dataset at all
+func ScreeningEnabled() bool {
+	return Current().BreachedPasswords != BreachedOff
+}
+
+// IsBreached reports whether the password is in the breach dataset. Without a dataset it never is.
+func IsBreached(password string) (bool, error) {
+	return IsBreachedHash(sha1.Sum([]byte(password)))
+}
+
+// IsBreachedHash reports whether the SHA-1 hash of a password is in the breach dataset
+func IsBreachedHash(hash [sha1.Size]byte) (bool, error) {
+	breachDatasetMu.RLock()
+	dataset := breachDataset
+	breachDatasetMu.RUnlock()
+
+	if dataset == nil {
+		return false, nil
+	}
+	return dataset.Contains(hash)
+}
+
+// breachedViolation looks the password up and describes it as a violation, logging lookup failures
+// rather than rejecting passwords because the dataset is unreadable
+func breachedViolation(password string) *Violation {
+	breached, err := IsBreached(password)
+	if err != nil {
+		log.Printf("Breached password lookup failed: %v", err)
+		return nil
+	}
+	if !breached {
+		return nil
+	}
+	return &Violation{RuleBreached, "This password has appeared in a data breach, choose a different one"}
+}
+
+// Warnings returns the problems of an accepted password the user should still hear about, such as a
+// breached password when the policy only warns
+func Warnings(password string) []Violation {
+	if Current().BreachedPasswords != BreachedWarn {
+		return nil
+	}
+	if violation := breachedViolation(password); violation != nil {
+		return []Violation{*violation}
+	}
+	return nil
+}
+
+// StartBreachDataset loads password_policy.breach_file and reloads it whenever the file changes, so a
+// new dataset can be dropped in without a restart. Replace the file by renaming a complete copy over
+// it, since a hash file is read in place. Without a file breached passwords are not looked up.
+func StartBreachDataset() error {
+	config := configs.GetConfig().PasswordPolicy
+	switch config.BreachedPasswords {
+	case BreachedOff:
+		return nil
+	case BreachedWarn, BreachedBlock:
+	default:
+		return fmt.Errorf("unknown password_policy.breached_passwords %q", config.BreachedPasswords)
+	}
+	if config.BreachFile == "" {
+		return nil
+	}
+	if config.BreachReloadSeconds <= 0 {
+		return errors.New("password_policy.breach_reload_seconds must be positive")
+	}
+
+	info, err := os.Stat(config.BreachFile)
+	if err != nil {
+		return err
+	}
+	dataset, err := LoadBreachDataset(config.BreachFile)
+	if err != nil {
+		return err
+	}
+	SetBreachDataset(dataset)
+
+	interval := time.Duration(config.BreachReloadSeconds) * time.Second
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		loaded := info
+		for range ticker.C {
+			info, err := os.Stat(config.BreachFile)
+			if err != nil {
+				log.Printf("Breached passwords: %v", err)
+				continue
+			}
+			if info.ModTime().Equal(loaded.ModTime()) && info.Size() == loaded.Size() {
+				continue
+			}
+
+			dataset, err := LoadBreachDataset(config.BreachFile)
+			if err != nil {
+				// Keep the dataset that works
+				log.Printf("Breached passwords: reload failed: %v", err)
+				continue
+			}
+			SetBreachDataset(dataset)
+			loaded = info
+			log.Printf("Breached passwords: reloaded %s", config.BreachFile)
+		}
+	}()
+	return nil
+}
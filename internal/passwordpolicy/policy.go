@@ -0,0 +1,209 @@
+package passwordpolicy
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Debt-Solvers/BE-auth-service/configs"
+	"github.com/Debt-Solvers/BE-auth-service/utils"
+)
+
+// Rules reported in violations, so clients can show their own messages
+const (
+	RuleMinLength    = "min_length"
+	RuleMaxLength    = "max_length"
+	RuleStrength     = "strength"
+	RulePersonalInfo = "personal_info"
+)
+
+// minPersonalInfoLength is the shortest part of a name or email address looked for in passwords.
+// Shorter parts, like the "jo" of jo@example.com, would reject too many good passwords.
+const minPersonalInfoLength = 3
+
+// Policy is the set of rules new passwords must meet
+type Policy struct {
+	MinLength          int  `json:"min_length"`           // In characters
+	MaxLength          int  `json:"max_length"`           // In characters
+	MaxBytes           int  `json:"max_bytes,omitempty"`  // Limit of the password hashing, 0 when there is none
+	MinEntropyBits     int  `json:"min_entropy_bits"`     // See EstimateEntropy, 0 when the check is off
+	RejectPersonalInfo bool `json:"reject_personal_info"` // Passwords may not contain the email address or name
+
+	BreachedPasswords string `json:"breached_passwords"` // BreachedOff, BreachedWarn or BreachedBlock, off while no dataset is loaded
+}
+
+// Violation is one rule a password does not meet
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Requirement describes one rule of the policy
+type Requirement struct {
+	Rule        string `json:"rule"`
+	Description string `json:"description"`
+}
+
+// Error is returned when a password does not meet the policy
+type Error struct {
+	Violations []Violation
+}
+
+func (e *Error) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, violation := range e.Violations {
+		messages = append(messages, violation.Message)
+	}
+	return strings.Join(messages, ", ")
+}
+
+// PersonalInfo is what a password must not contain when RejectPersonalInfo is set
+type PersonalInfo struct {
+	Email     string
+	FirstName string
+	LastName  string
+}
+
+// Current returns the policy configured in configs.Config
+func Current() Policy {
+	config := configs.GetConfig().PasswordPolicy
+	return Policy{
+		MinLength:          config.MinLength,
+		MaxLength:          config.MaxLength,
+		MaxBytes:           utils.MaxPasswordBytes(),
+		MinEntropyBits:     config.MinEntropyBits,
+		RejectPersonalInfo: config.RejectPersonalInfo,
+		BreachedPasswords:  breachedPasswordsMode(config.BreachedPasswords),
+	}
+}
+
+// Validate checks a new password against the current policy and returns an *Error listing every violation
+func Validate(password string, info PersonalInfo) error {
+	if violations := Current().Check(password, info); len(violations) > 0 {
+		return &Error{Violations: violations}
+	}
+	return nil
+}
+
+// Check returns every rule of the policy the password does not meet
+func (p Policy) Check(password string, info PersonalInfo) []Violation {
+	var violations []Violation
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violations = append(violations, Violation{RuleMinLength, fmt.Sprintf("Password must be at least %d characters long", p.MinLength)})
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violations = append(violations, Violation{RuleMaxLength, fmt.Sprintf("Password must be at most %d characters long", p.MaxLength)})
+	} else if p.MaxBytes > 0 && len(password) > p.MaxBytes {
+		violations = append(violations, Violation{RuleMaxLength, fmt.Sprintf("Password must be at most %d bytes long, and characters other than plain letters, digits and symbols take several", p.MaxBytes)})
+	}
+	if p.MinEntropyBits > 0 && EstimateEntropy(password) < float64(p.MinEntropyBits) {
+		violations = append(violations, Violation{RuleStrength, "Password is too easy to guess, make it longer or mix letters, digits and symbols"})
+	}
+	if p.RejectPersonalInfo && containsPersonalInfo(password, info) {
+		violations = append(violations, Violation{RulePersonalInfo, "Password must not contain your name or email address"})
+	}
+	if p.BreachedPasswords == BreachedBlock {
+		if violation := breachedViolation(password); violation != nil {
+			violations = append(violations, *violation)
+		}
+	}
+	return violations
+}
+
+// Requirements describes the active rules, for clients to show before the user types a password
+func (p Policy) Requirements() []Requirement {
+	requirements := []Requirement{{RuleMinLength, fmt.Sprintf("At least %d characters long", p.MinLength)}}
+	if p.MaxLength > 0 {
+		requirements = append(requirements, Requirement{RuleMaxLength, fmt.Sprintf("At most %d characters long", p.MaxLength)})
+	}
+	if p.MaxBytes > 0 {
+		requirements = append(requirements, Requirement{RuleMaxLength, fmt.Sprintf("At most %d bytes, where accented letters and other non-ASCII characters count as several", p.MaxBytes)})
+	}
+	if p.MinEntropyBits > 0 {
+		requirements = append(requirements, Requirement{RuleStrength, "Hard to guess: long, or mixing letters, digits and symbols"})
+	}
+	if p.RejectPersonalInfo {
+		requirements = append(requirements, Requirement{RulePersonalInfo, "Does not contain your name or email address"})
+	}
+	if p.BreachedPasswords == BreachedBlock {
+		requirements = append(requirements, Requirement{RuleBreached, "Has not appeared in a known data breach"})
+	}
+	return requirements
+}
+
+// EstimateEntropy estimates the strength of a password in bits. Each character is worth the bits of
+// the character classes the password uses (lowercase, uppercase, digits, symbols, other), a character
+// seen before half as much, and a character repeating or counting on from the previous one (aa, ab,
+// 21) a single bit. It is a cheap upper bound: dictionary words still score as random letters.
+func EstimateEntropy(password string) float64 {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII && unicode.IsPrint(r):
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	pool := 0
+	for _, class := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.used {
+			pool += class.size
+		}
+	}
+	if pool == 0 {
+		return 0
+	}
+	bitsPerChar := math.Log2(float64(pool))
+
+	var bits float64
+	seen := make(map[rune]bool)
+	previous := rune(-1)
+	for _, r := range password {
+		switch {
+		case r == previous || r == previous+1 || r == previous-1:
+			bits++
+		case seen[r]:
+			bits += bitsPerChar / 2
+		default:
+			bits += bitsPerChar
+		}
+		seen[r] = true
+		previous = r
+	}
+	return bits
+}
+
+// containsPersonalInfo reports whether the password contains the email address, its local part or
+// the parts of it, or the user's names
+func containsPersonalInfo(password string, info PersonalInfo) bool {
+	password = strings.ToLower(password)
+
+	email := strings.ToLower(strings.TrimSpace(info.Email))
+	localPart, _, _ := strings.Cut(email, "@")
+	parts := []string{email, localPart}
+	parts = append(parts, strings.FieldsFunc(localPart, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })...)
+	parts = append(parts, strings.Fields(strings.ToLower(info.FirstName))...)
+	parts = append(parts, strings.Fields(strings.ToLower(info.LastName))...)
+
+	for _, part := range parts {
+		if utf8.RuneCountInString(part) >= minPersonalInfoLength && strings.Contains(password, part) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package passwordpolicy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Debt-Solvers/BE-auth-service/configs"
+	"github.com/Debt-Solvers/BE-auth-service/utils"
+)
+
+// useHashing configures the password hashing for one test
+func useHashing(t *testing.T, algorithm string, pepperVersion int) {
+	t.Helper()
+
+	config := configs.GetConfig()
+	saved := config.PasswordHashing
+	config.PasswordHashing.Algorithm = algorithm
+	config.PasswordHashing.PepperVersion = pepperVersion
+	t.Cleanup(func() { config.PasswordHashing = saved })
+}
+
+func TestBcryptWithoutPepperCapsPasswordBytes(t *testing.T) {
+	for _, test := range []struct {
+		name          string
+		algorithm     string
+		pepperVersion int
+		maxBytes      int
+	}{
+		{"argon2id", configs.PasswordHashArgon2id, 0, 0},
+		{"bcrypt", configs.PasswordHashBcrypt, 0, 72},
+		{"peppered bcrypt", configs.PasswordHashBcrypt, 1, 0},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			useHashing(t, test.algorithm, test.pepperVersion)
+			if got := Current().MaxBytes; got != test.maxBytes {
+				t.Errorf("MaxBytes = %d, want %d", got, test.maxBytes)
+			}
+		})
+	}
+
+	policy := Policy{MinLength: 12, MaxLength: 128, MaxBytes: 72}
+	for _, test := range []struct {
+		name     string
+		password string
+		rejected bool
+	}{
+		{"72 bytes", strings.Repeat("Tr0ub4dor&3x", 6), false},
+		{"73 bytes", strings.Repeat("Tr0ub4dor&3x", 6) + "y", true},
+		// 40 characters, but 80 bytes
+		{"multi-byte characters", strings.Repeat("é", 40), true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			rejected := false
+			for _, violation := range policy.Check(test.password, PersonalInfo{}) {
+				rejected = rejected || violation.Rule == RuleMaxLength
+			}
+			if rejected != test.rejected {
+				t.Errorf("rejected for length = %v, want %v", rejected, test.rejected)
+			}
+		})
+	}
+}
+
+func TestPasswordsWithinThePolicyCanBeHashed(t *testing.T) {
+	useHashing(t, configs.PasswordHashBcrypt, 0)
+	config := configs.GetConfig()
+	cost := config.PasswordHashing.BcryptCost
+	config.PasswordHashing.BcryptCost = 4 // bcrypt.MinCost keeps the test fast
+	t.Cleanup(func() { config.PasswordHashing.BcryptCost = cost })
+
+	password := strings.Repeat("Tr0ub4dor&3x", 6)
+	if violations := Current().Check(password, PersonalInfo{}); len(violations) > 0 {
+		t.Fatalf("a 72-byte password violates the policy: %+v", violations)
+	}
+	if _, err := utils.HashPassword(password); err != nil {
+		t.Errorf("HashPassword of a password the policy accepts: %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreKeepsABucketPerKey(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Requests: 2, Period: time.Hour}
+
+	for i, want := range []bool{true, true, false, false} {
+		result, err := store.Take("a", limit)
+		if err != nil {
+			t.Fatalf("Take: %v", err)
+		}
+		if result.Allowed != want {
+			t.Errorf("request %d to a: allowed = %v, want %v", i+1, result.Allowed, want)
+		}
+	}
+
+	// Another key starts with a full bucket
+	result, err := store.Take("b", limit)
+	if err != nil {
+		t.Fatalf("Take: %v", err)
+	}
+	if !result.Allowed || result.Remaining != 1 {
+		t.Errorf("first request to b = %+v, want allowed with 1 remaining", result)
+	}
+}
+
+func TestMemoryStorePrunesIdleBuckets(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Requests: 1, Period: time.Hour}
+
+	for _, key := range []string{"idle", "busy"} {
+		if _, err := store.Take(key, limit); err != nil {
+			t.Fatalf("Take: %v", err)
+		}
+	}
+	store.buckets["idle"].updatedAt = time.Now().Add(-2 * time.Hour)
+
+	if err := store.Prune(time.Hour); err != nil {
+		t.Fatalf("Prune: %v", err)
+	}
+	if _, ok := store.buckets["idle"]; ok {
+		t.Error("idle bucket was not pruned")
+	}
+	if _, ok := store.buckets["busy"]; !ok {
+		t.Error("busy bucket was pruned")
+	}
+
+	// A pruned key starts again with a full bucket, as it would have refilled anyway
+	result, err := store.Take("idle", limit)
+	if err != nil {
+		t.Fatalf("Take: %v", err)
+	}
+	if !result.Allowed {
+		t.Error("request after pruning was refused")
+	}
+}
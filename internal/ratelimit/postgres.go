@@ -0,0 +1,55 @@
+package ratelimit
+
+import (
+	"time"
+
+	"github.com/Debt-Solvers/BE-auth-service/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PostgresStore keeps buckets in the rate_limit_buckets table, so every replica shares them
+type PostgresStore struct {
+	db *gorm.DB
+}
+
+// NewPostgresStore creates a store on the given database
+func NewPostgresStore(db *gorm.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// Take removes one token from the key's bucket if it has one. The row is locked, so concurrent
+// requests on different replicas are counted one after the other.
+func (s *PostgresStore) Take(key string, limit Limit) (Result, error) {
+	var result Result
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		created := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.RateLimitBucket{
+			Key:       key,
+			Tokens:    float64(limit.Requests),
+			UpdatedAt: now,
+		})
+		if created.Error != nil {
+			return created.Error
+		}
+
+		var row models.RateLimitBucket
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("key = ?", key).First(&row).Error; err != nil {
+			return err
+		}
+
+		b := bucket{tokens: row.Tokens, updatedAt: row.UpdatedAt}
+		result = b.take(limit, now)
+		return tx.Model(&row).Updates(map[string]interface{}{
+			"tokens":     b.tokens,
+			"updated_at": b.updatedAt,
+		}).Error
+	})
+	return result, err
+}
+
+// Prune forgets buckets that have not been used for idle
+func (s *PostgresStore) Prune(idle time.Duration) error {
+	return s.db.Where("updated_at < ?", time.Now().Add(-idle)).Delete(&models.RateLimitBucket{}).Error
+}
@@ -0,0 +1,145 @@
+package ratelimit
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Debt-Solvers/BE-auth-service/configs"
+	"github.com/Debt-Solvers/BE-auth-service/db"
+)
+
+// Store names accepted in the rate_limit.store setting
+const (
+	StoreMemory   = "memory"
+	StorePostgres = "postgres"
+)
+
+// pruneInterval is how often idle buckets are deleted
+const pruneInterval = time.Minute
+
+// Limit allows Requests requests per Period. Up to Requests can be made at once, after which the
+// bucket refills evenly over the period.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// Result is the outcome of taking a token from a bucket
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int           // Requests that can still be made right now
+	Reset      time.Duration // Until the bucket is full again
+	RetryAfter time.Duration // Until the next request is allowed, zero if this one was
+}
+
+// Store keeps token buckets
+type Store interface {
+	// Take removes one token from the key's bucket if it has one
+	Take(key string, limit Limit) (Result, error)
+	// Prune forgets buckets that have not been used for idle; a bucket idle for its period is full anyway
+	Prune(idle time.Duration) error
+}
+
+// bucket is the state of one token bucket
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// take refills the bucket for the time since it was last used and removes a token if one is left
+func (b *bucket) take(limit Limit, now time.Time) Result {
+	capacity := float64(limit.Requests)
+	rate := capacity / limit.Period.Seconds() // Tokens per second
+
+	if elapsed := now.Sub(b.updatedAt).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(capacity, b.tokens+elapsed*rate)
+	}
+	b.updatedAt = now
+
+	result := Result{Limit: limit.Requests}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - b.tokens) / rate)
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = seconds((capacity - b.tokens) / rate)
+	return result
+}
+
+// newBucket returns a full bucket
+func newBucket(limit Limit, now time.Time) bucket {
+	return bucket{tokens: float64(limit.Requests), updatedAt: now}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+var (
+	defaultStore    Store
+	defaultStoreErr error
+	defaultStoreMu  sync.Mutex
+)
+
+// New builds the store selected by the rate limit configuration
+func New(config *configs.Config) (Store, error) {
+	switch config.RateLimit.Store {
+	case StoreMemory:
+		return NewMemoryStore(), nil
+	case StorePostgres:
+		return NewPostgresStore(db.GetDBInstance()), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit store %q", config.RateLimit.Store)
+	}
+}
+
+// Default returns the store configured in configs.Config, creating it on first use
+func Default() (Store, error) {
+	defaultStoreMu.Lock()
+	defer defaultStoreMu.Unlock()
+
+	if defaultStore == nil && defaultStoreErr == nil {
+		defaultStore, defaultStoreErr = New(configs.GetConfig())
+	}
+	return defaultStore, defaultStoreErr
+}
+
+// SetDefault replaces the store used by the middleware, e.g. with a MemoryStore in tests
+func SetDefault(s Store) {
+	defaultStoreMu.Lock()
+	defer defaultStoreMu.Unlock()
+
+	defaultStore, defaultStoreErr = s, nil
+}
+
+// StartPruning deletes idle buckets of the default store in the background until the process exits
+func StartPruning() {
+	// Buckets idle for the longest configured period are full under every rule
+	var idle time.Duration
+	for _, rule := range configs.GetConfig().RateLimit.Rules {
+		if period := time.Duration(rule.PeriodSeconds) * time.Second; period > idle {
+			idle = period
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(pruneInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			store, err := Default()
+			if err != nil {
+				continue
+			}
+			if err := store.Prune(idle); err != nil {
+				log.Printf("Rate limit: pruning failed: %v", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,38 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketTake(t *testing.T) {
+	limit := Limit{Requests: 3, Period: 3 * time.Second} // One token a second
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// The steps share one bucket, in order
+	b := newBucket(limit, start)
+	for _, step := range []struct {
+		name       string
+		at         time.Duration // Since start
+		allowed    bool
+		remaining  int
+		retryAfter time.Duration
+		reset      time.Duration
+	}{
+		{"burst 1", 0, true, 2, 0, time.Second},
+		{"burst 2", 0, true, 1, 0, 2 * time.Second},
+		{"burst 3", 0, true, 0, 0, 3 * time.Second},
+		{"empty", 0, false, 0, time.Second, 3 * time.Second},
+		{"half refilled", 500 * time.Millisecond, false, 0, 500 * time.Millisecond, 2500 * time.Millisecond},
+		{"one refilled", time.Second, true, 0, 0, 3 * time.Second},
+		{"clock went back", 0, false, 0, time.Second, 3 * time.Second},
+		{"refill stops at capacity", time.Hour, true, 2, 0, time.Second},
+	} {
+		result := b.take(limit, start.Add(step.at))
+		if result.Allowed != step.allowed || result.Remaining != step.remaining ||
+			result.RetryAfter != step.retryAfter || result.Reset != step.reset || result.Limit != limit.Requests {
+			t.Errorf("%s: take = %+v, want allowed=%v remaining=%d retryAfter=%v reset=%v",
+				step.name, result, step.allowed, step.remaining, step.retryAfter, step.reset)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"github.com/Debt-Solvers/BE-auth-service/internal/common"
 	"github.com/Debt-Solvers/BE-auth-service/internal/controller"
 	"github.com/Debt-Solvers/BE-auth-service/internal/middleware"
 	"github.com/Debt-Solvers/BE-auth-service/internal/tests"
@@ -16,18 +17,105 @@ func AddHealthCheckRoute(server *gin.Engine) {
 
 func RegisterRoutes(server *gin.Engine) {
 	// Public routes
-	server.POST("/api/v1/signup", controller.Signup) // User signup - No middleware needed
-	server.POST("/api/v1/login", controller.Login)     // User login - No middleware needed
-	server.POST("/api/v1/password-reset", controller.ResetPassword) // Request password reset - No middleware needed
+	server.GET("/.well-known/jwks.json", controller.JWKS) // Public signing keys for verifying our tokens - No middleware needed
+	server.GET("/.well-known/openid-configuration", controller.OpenIDConfiguration) // OpenID Connect discovery - No middleware needed
+	server.POST("/api/v1/signup", middleware.RateLimit("signup"), controller.Signup) // User signup - Rate limited
+	server.POST("/api/v1/login", middleware.RateLimit("login"), controller.Login) // User login - Rate limited
+	server.POST("/api/v1/token/refresh", controller.RefreshToken) // Rotate refresh token - No middleware needed
+	server.POST("/api/v1/login/mfa", middleware.RateLimit("mfa_login"), controller.LoginMFA) // Complete login with a second factor - Rate limited
+	server.GET("/api/v1/login/unlock", controller.UnlockLogin) // Unlock link from the lockout email - No middleware needed
+	server.POST("/api/v1/login/unlock", controller.UnlockLogin) // Unlock login with a token in the body - No middleware needed
+	server.POST("/api/v1/webauthn/login/begin", middleware.RateLimit("webauthn_login"), controller.BeginWebAuthnLogin) // Start passkey login - Rate limited
+	server.POST("/api/v1/webauthn/login/finish", controller.FinishWebAuthnLogin) // Finish passkey login - No middleware needed
+	server.GET("/api/v1/social-login/providers", controller.ListSocialLoginProviders) // External login providers - No middleware needed
+	server.POST("/api/v1/social-login/:provider/begin", controller.BeginSocialLogin) // Start login with an external provider - No middleware needed
+	server.POST("/api/v1/social-login/:provider/finish", controller.FinishSocialLogin) // Finish login with an external provider - No middleware needed
+	server.GET("/api/v1/password-policy", controller.GetPasswordPolicy) // Rules new passwords must meet - No middleware needed
+	server.POST("/api/v1/password-reset", middleware.RateLimit("password_reset"), controller.ResetPassword) // Request password reset - Rate limited
 	server.POST("/api/v1/password-reset/confirm", controller.ConfirmResetPassword) // Confirm password reset - No middleware needed
+	server.GET("/api/v1/verify-email", controller.VerifyEmail) // Verification link from the email - No middleware needed
+	server.POST("/api/v1/verify-email", controller.VerifyEmail) // Verify email with a token in the body - No middleware needed
+	server.POST("/api/v1/verify-email/resend", middleware.RateLimit("verification_resend"), controller.ResendVerificationEmail) // Resend the verification link - Rate limited
 
-	// Protected routes (requires authentication)
+	// OAuth 2.0 authorization server
+	server.GET("/oauth/authorize", controller.Authorize) // Login and consent page - No middleware needed
+	server.POST("/oauth/authorize", controller.AuthorizeDecision) // Login and consent form - No middleware needed
+	server.POST("/oauth/token", controller.Token) // Token endpoint, clients authenticate themselves - No middleware needed
+	server.POST("/oauth/revoke", controller.Revoke) // Token revocation - No middleware needed
+	server.POST("/oauth/introspect", controller.Introspect) // Token introspection for our other services, clients authenticate themselves - No middleware needed
+	server.GET("/oauth/userinfo", middleware.AuthMiddleware(), middleware.RequireScope(common.ScopeOpenID), controller.UserInfo)
+	server.POST("/oauth/userinfo", middleware.AuthMiddleware(), middleware.RequireScope(common.ScopeOpenID), controller.UserInfo)
+
+	// Protected routes (requires authentication); service tokens from the client credentials grant are rejected
 	protected := server.Group("/api/v1")
 	protected.Use(middleware.AuthMiddleware()) // Apply middleware to all routes in this group
-	protected.POST("/logout", controller.Logout)   
 
-	protected.PUT("/change-password", controller.UpdatePassword)                        
-	protected.PUT("/user/update", controller.UpdateUserInfo)            
-	protected.GET("/user", controller.GetUserInfo)                  
-}
+	// Available to OAuth clients holding the matching scope
+	protected.GET("/user", middleware.RequireScope(common.ScopeProfile), controller.GetUserInfo)
+
+	// Account management is limited to our own apps
+	account := protected.Group("")
+	account.Use(middleware.FirstPartyOnly())
+
+	account.POST("/logout", controller.Logout)
+
+	account.GET("/sessions", controller.ListSessions)
+	account.DELETE("/sessions", controller.RevokeOtherSessions)
+	account.DELETE("/sessions/:id", controller.RevokeSession)
+
+	// Everything else needs a verified email address
+	verified := account.Group("")
+	verified.Use(middleware.RequireVerifiedEmail())
+
+	verified.PUT("/change-password", controller.UpdatePassword)
+	verified.PUT("/user/update", controller.UpdateUserInfo)
+
+	verified.POST("/mfa/totp/enroll", controller.EnrollTOTP)
+	verified.POST("/mfa/totp/verify", controller.VerifyTOTP)
+	verified.POST("/mfa/totp/disable", controller.DisableTOTP)
+	verified.GET("/mfa/recovery-codes", controller.GetRecoveryCodeStatus)
+	verified.POST("/mfa/recovery-codes", controller.RegenerateRecoveryCodes)
+
+	verified.POST("/webauthn/register/begin", controller.BeginWebAuthnRegistration)
+	verified.POST("/webauthn/register/finish", controller.FinishWebAuthnRegistration)
+	verified.GET("/webauthn/credentials", controller.ListWebAuthnCredentials)
+	verified.DELETE("/webauthn/credentials/:id", controller.DeleteWebAuthnCredential)
 
+	verified.GET("/identities", controller.ListUserIdentities)
+	verified.DELETE("/identities/:id", controller.UnlinkUserIdentity)
+
+	verified.POST("/tokens", controller.CreatePersonalAccessToken)
+	verified.GET("/tokens", controller.ListPersonalAccessTokens)
+	verified.DELETE("/tokens/:id", controller.DeletePersonalAccessToken)
+
+	verified.POST("/oauth/clients", controller.CreateOAuthClient)
+	verified.GET("/oauth/clients", controller.ListOAuthClients)
+	verified.DELETE("/oauth/clients/:id", controller.DeleteOAuthClient)
+	verified.GET("/oauth/consents", controller.ListOAuthConsents)
+	verified.DELETE("/oauth/consents/:client_id", controller.RevokeOAuthConsent)
+
+	// Admin routes, each limited to the roles granting its permission
+	admin := verified.Group("/admin")
+
+	admin.GET("/users", middleware.RequirePermission(common.PermissionUsersRead), controller.SearchUsers)
+	admin.GET("/users/:id", middleware.RequirePermission(common.PermissionUsersRead), controller.GetUser)
+	admin.POST("/users/:id/disable", middleware.RequirePermission(common.PermissionUsersWrite), controller.DisableUser)
+	admin.POST("/users/:id/enable", middleware.RequirePermission(common.PermissionUsersWrite), controller.EnableUser)
+	admin.POST("/users/:id/password-reset", middleware.RequirePermission(common.PermissionUsersWrite), controller.ForcePasswordReset)
+	admin.POST("/users/:id/unlock", middleware.RequirePermission(common.PermissionUsersWrite), controller.UnlockUserLogin)
+	admin.POST("/users/:id/verify-email", middleware.RequirePermission(common.PermissionUsersWrite), controller.MarkEmailVerified)
+	admin.DELETE("/users/:id/sessions", middleware.RequirePermission(common.PermissionUsersWrite), controller.RevokeAllUserSessions)
+	admin.DELETE("/users/:id", middleware.RequirePermission(common.PermissionUsersWrite), controller.DeleteUser)
+
+	admin.GET("/roles", middleware.RequirePermission(common.PermissionUsersRead), controller.ListRoles)
+	admin.GET("/users/:id/roles", middleware.RequirePermission(common.PermissionUsersRead), controller.GetUserRoles)
+	admin.PUT("/users/:id/roles/:role", middleware.RequirePermission(common.PermissionRolesAssign), controller.AssignRole)
+	admin.DELETE("/users/:id/roles/:role", middleware.RequirePermission(common.PermissionRolesAssign), controller.RemoveRole)
+
+	admin.GET("/email-outbox", middleware.RequirePermission(common.PermissionEmailOutboxManage), controller.ListOutboxEmails)
+	admin.POST("/email-outbox/:id/retry", middleware.RequirePermission(common.PermissionEmailOutboxManage), controller.RetryOutboxEmail)
+
+	admin.POST("/service-clients", middleware.RequirePermission(common.PermissionServiceClientsManage), controller.CreateServiceClient)
+	admin.GET("/service-clients", middleware.RequirePermission(common.PermissionServiceClientsManage), controller.ListServiceClients)
+	admin.DELETE("/service-clients/:id", middleware.RequirePermission(common.PermissionServiceClientsManage), controller.DeleteServiceClient)
+}
@@ -0,0 +1,167 @@
+package testutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+)
+
+// Authenticator flags set in the authenticator data (WebAuthn section 6.1)
+const (
+	flagUserPresent            = 0x01
+	flagUserVerified           = 0x04
+	flagAttestedCredentialData = 0x40
+)
+
+// Authenticator is a software passkey. It answers ceremonies with an ES256 key pair and "none"
+// attestation, the way a platform authenticator does.
+type Authenticator struct {
+	Origin       string // Origin the browser reports in the client data
+	CredentialID []byte
+	SignCount    uint32 // Signature counter sent with the next assertion
+
+	key        *ecdsa.PrivateKey
+	userHandle []byte
+}
+
+// NewAuthenticator creates an authenticator holding one credential, used from the given origin
+func NewAuthenticator(origin string) (*Authenticator, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	credentialID := make([]byte, 32)
+	if _, err := rand.Read(credentialID); err != nil {
+		return nil, err
+	}
+	return &Authenticator{Origin: origin, CredentialID: credentialID, key: key}, nil
+}
+
+// Register answers navigator.credentials.create and returns the PublicKeyCredential as JSON
+func (a *Authenticator) Register(creation *protocol.CredentialCreation) ([]byte, error) {
+	options := creation.Response
+	userHandle, err := userHandleBytes(options.User.ID)
+	if err != nil {
+		return nil, err
+	}
+	a.userHandle = userHandle
+
+	publicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  int64(webauthncose.P256),
+		XCoord: a.key.X.FillBytes(make([]byte, 32)),
+		YCoord: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Attested credential data: AAGUID, credential ID length, credential ID and public key
+	authData := a.authenticatorData(options.RelyingParty.ID, flagUserPresent|flagUserVerified|flagAttestedCredentialData)
+	authData = append(authData, make([]byte, 16)...)
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.CredentialID)))
+	authData = append(authData, a.CredentialID...)
+	authData = append(authData, publicKey...)
+
+	attestationObject, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": authData,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	clientData, err := a.clientData(protocol.CreateCeremony, options.Challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.credential(map[string]string{
+		"clientDataJSON":    encode(clientData),
+		"attestationObject": encode(attestationObject),
+	})
+}
+
+// Login answers navigator.credentials.get with the current SignCount and returns the
+// PublicKeyCredential as JSON
+func (a *Authenticator) Login(assertion *protocol.CredentialAssertion) ([]byte, error) {
+	options := assertion.Response
+	authData := a.authenticatorData(options.RelyingPartyID, flagUserPresent|flagUserVerified)
+
+	clientData, err := a.clientData(protocol.AssertCeremony, options.Challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return a.credential(map[string]string{
+		"clientDataJSON":    encode(clientData),
+		"authenticatorData": encode(authData),
+		"signature":         encode(signature),
+		"userHandle":        encode(a.userHandle),
+	})
+}
+
+// authenticatorData starts the authenticator data with the RP ID hash, flags and signature counter
+func (a *Authenticator) authenticatorData(rpID string, flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	authData := append(rpIDHash[:], flags)
+	return binary.BigEndian.AppendUint32(authData, a.SignCount)
+}
+
+// clientData is the clientDataJSON the browser would collect for the ceremony
+func (a *Authenticator) clientData(ceremony protocol.CeremonyType, challenge protocol.URLEncodedBase64) ([]byte, error) {
+	return json.Marshal(protocol.CollectedClientData{
+		Type:      ceremony,
+		Challenge: challenge.String(),
+		Origin:    a.Origin,
+	})
+}
+
+// credential wraps an authenticator response in a PublicKeyCredential
+func (a *Authenticator) credential(response map[string]string) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"id":                     encode(a.CredentialID),
+		"rawId":                  encode(a.CredentialID),
+		"type":                   "public-key",
+		"response":               response,
+		"clientExtensionResults": map[string]interface{}{},
+	})
+}
+
+// userHandleBytes reads the user handle from creation options built by the library or decoded from JSON
+func userHandleBytes(id interface{}) ([]byte, error) {
+	switch handle := id.(type) {
+	case protocol.URLEncodedBase64:
+		return handle, nil
+	case []byte:
+		return handle, nil
+	case string:
+		return base64.RawURLEncoding.DecodeString(handle)
+	default:
+		return nil, fmt.Errorf("unexpected user handle %T", id)
+	}
+}
+
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
@@ -0,0 +1,105 @@
+// Package testutil holds the database setup and fakes shared by the package tests.
+package testutil
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/Debt-Solvers/BE-auth-service/db"
+	"github.com/Debt-Solvers/BE-auth-service/internal/keystore"
+	"github.com/Debt-Solvers/BE-auth-service/internal/models"
+	"github.com/Debt-Solvers/BE-auth-service/utils"
+
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// DatabaseURLEnv names the PostgreSQL connection string the database tests run against. The schema is
+// created in it, so point it at a database used for nothing else.
+const DatabaseURLEnv = "TEST_DATABASE_URL"
+
+var (
+	setupOnce sync.Once
+	setupErr  error
+)
+
+// repoRoot is the repository root, which the tests run outside of
+func repoRoot() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "..", "..")
+}
+
+func init() {
+	// The configuration is looked for in ./configs, but tests run in their package's directory
+	viper.AddConfigPath(filepath.Join(repoRoot(), "configs"))
+
+	// The service has no default encryption key, so the tests use a throwaway one
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	viper.SetDefault("security.encryption_key", base64.StdEncoding.EncodeToString(key))
+}
+
+// Database connects to the test database, creates the schema and starts the key store once per test
+// binary. Tests are skipped when no test database is configured.
+func Database(t *testing.T) {
+	t.Helper()
+
+	url := os.Getenv(DatabaseURLEnv)
+	if url == "" {
+		t.Skipf("%s is not set", DatabaseURLEnv)
+	}
+
+	setupOnce.Do(func() {
+		setupErr = setupDatabase(url)
+	})
+	if setupErr != nil {
+		t.Fatal(setupErr)
+	}
+}
+
+// setupDatabase does what the service does at startup, against the test database
+func setupDatabase(url string) error {
+	var err error
+	db.DB, err = gorm.Open(postgres.Open(url), &gorm.Config{})
+	if err != nil {
+		return fmt.Errorf("failed to connect to the test database: %w", err)
+	}
+	if err := db.ExecuteSQLSchema(filepath.Join(repoRoot(), "db", "schema.sql")); err != nil {
+		return err
+	}
+	return keystore.Start()
+}
+
+// CreateUser creates a user with a unique email address and the given password
+func CreateUser(t *testing.T, password string, verified bool) models.User {
+	t.Helper()
+
+	passwordHash, err := utils.HashPassword(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := models.User{
+		UserID:          uuid.New(),
+		FirstName:       "Test",
+		LastName:        "User",
+		Email:           fmt.Sprintf("test-%s@example.com", uuid.NewString()),
+		PasswordHash:    passwordHash,
+		IsEmailVerified: verified,
+		Currency:        "CAD",
+	}
+	if err := db.GetDBInstance().Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
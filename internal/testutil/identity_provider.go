@@ -0,0 +1,176 @@
+package testutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Debt-Solvers/BE-auth-service/configs"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// identityProviderKeyID names the identity provider's only signing key
+const identityProviderKeyID = "test-key"
+
+// IdentityProvider is an OpenID Connect provider for social login tests. It signs the user in as
+// whoever the test asks for and checks the PKCE verifier when the code is redeemed.
+type IdentityProvider struct {
+	*httptest.Server
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+
+	key   *ecdsa.PrivateKey
+	mu    sync.Mutex
+	codes map[string]issuedCode
+}
+
+// issuedCode is an authorization code waiting to be redeemed
+type issuedCode struct {
+	codeChallenge string
+	idToken       string
+}
+
+// NewIdentityProvider starts a provider that is shut down when the test ends
+func NewIdentityProvider(t *testing.T) *IdentityProvider {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := &IdentityProvider{
+		ClientID:     "client-" + uuid.NewString(),
+		ClientSecret: "secret-" + uuid.NewString(),
+		RedirectURL:  "http://localhost:8080/login/callback",
+		key:          key,
+		codes:        make(map[string]issuedCode),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", provider.discovery)
+	mux.HandleFunc("/jwks", provider.jwks)
+	mux.HandleFunc("/token", provider.token)
+	provider.Server = httptest.NewServer(mux)
+	t.Cleanup(provider.Close)
+	return provider
+}
+
+// Config returns the provider's settings as they would appear under social_login.providers
+func (p *IdentityProvider) Config() configs.SocialLoginProvider {
+	return configs.SocialLoginProvider{
+		DisplayName:  "Test provider",
+		Issuer:       p.URL,
+		ClientID:     p.ClientID,
+		ClientSecret: p.ClientSecret,
+		RedirectURL:  p.RedirectURL,
+		Scopes:       []string{"email", "profile"},
+	}
+}
+
+// Authorize plays the user signing in at the provider. It reads the state, nonce and PKCE challenge
+// from the authorization URL and returns the state with a code for an ID token about the subject.
+// The claims are added to the ID token and replace the standard ones, e.g. to send another nonce.
+func (p *IdentityProvider) Authorize(t *testing.T, authorizationURL, subject string, claims jwt.MapClaims) (state, code string) {
+	t.Helper()
+
+	target, err := url.Parse(authorizationURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := target.Query()
+	if query.Get("client_id") != p.ClientID || query.Get("redirect_uri") != p.RedirectURL ||
+		query.Get("response_type") != "code" || query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("unexpected authorization request %s", authorizationURL)
+	}
+
+	now := time.Now()
+	idTokenClaims := jwt.MapClaims{
+		"iss":   p.URL,
+		"aud":   p.ClientID,
+		"sub":   subject,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+		"nonce": query.Get("nonce"),
+	}
+	for name, value := range claims {
+		idTokenClaims[name] = value
+	}
+	idToken := jwt.NewWithClaims(jwt.SigningMethodES256, idTokenClaims)
+	idToken.Header["kid"] = identityProviderKeyID
+	signed, err := idToken.SignedString(p.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code = uuid.NewString()
+	p.mu.Lock()
+	p.codes[code] = issuedCode{codeChallenge: query.Get("code_challenge"), idToken: signed}
+	p.mu.Unlock()
+	return query.Get("state"), code
+}
+
+func (p *IdentityProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 p.URL,
+		"authorization_endpoint": p.URL + "/authorize",
+		"token_endpoint":         p.URL + "/token",
+		"jwks_uri":               p.URL + "/jwks",
+	})
+}
+
+func (p *IdentityProvider) jwks(w http.ResponseWriter, r *http.Request) {
+	encode := func(coordinate []byte) string { return base64.RawURLEncoding.EncodeToString(coordinate) }
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "EC",
+			"kid": identityProviderKeyID,
+			"use": "sig",
+			"crv": "P-256",
+			"x":   encode(p.key.X.FillBytes(make([]byte, 32))),
+			"y":   encode(p.key.Y.FillBytes(make([]byte, 32))),
+		}},
+	})
+}
+
+// token redeems a code once, for the client it was issued to and with the matching PKCE verifier
+func (p *IdentityProvider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	if r.PostForm.Get("client_id") != p.ClientID || r.PostForm.Get("client_secret") != p.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	p.mu.Lock()
+	issued, ok := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mu.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || r.PostForm.Get("redirect_uri") != p.RedirectURL ||
+		base64.RawURLEncoding.EncodeToString(verifier[:]) != issued.codeChallenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"id_token": issued.idToken, "token_type": "Bearer"})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -2,44 +2,296 @@ package utils
 
 import (
 	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
 	"fmt"
-	"log"
 	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/Debt-Solvers/BE-auth-service/configs"
+
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// GenSalt generates a random salt for password hashing
-func GenSalt() string {
-	salt := make([]byte, 16) // 16 bytes for salt
-	if _, err := rand.Read(salt); err != nil {
-		log.Fatalf("failed to generate salt: %v", err)
-	}
-	return fmt.Sprintf("%x", salt) // Convert bytes to hexadecimal string
+var (
+	// ErrPasswordMismatch is returned by CheckPassword for a wrong password
+	ErrPasswordMismatch = errors.New("password does not match")
+	// ErrPasswordHashingBusy is returned when every Argon2id slot stayed taken for password_hashing.argon2id.queue_ms
+	ErrPasswordHashingBusy = errors.New("too many password hashes in progress")
+)
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+
+	argon2idSlotsOnce sync.Once
+	argon2idSlots     chan struct{}
+)
+
+// argon2idParams are the parameters recorded in an Argon2id hash
+type argon2idParams struct {
+	memory        uint32
+	iterations    uint32
+	parallelism   uint8
+	pepperVersion int // 0 for hashes without pepper
+	salt          []byte
+	key           []byte
 }
 
-// HashPassword hashes the password using the provided salt
-func HashPassword(password, salt string) (string, error) {
-	// Combine the salt and password
-	saltedPassword := salt + password
+// bcryptMaxPasswordBytes is the longest input bcrypt hashes; longer passwords are rejected, not truncated
+const bcryptMaxPasswordBytes = 72
 
-	// Hash the salted password
-	hash, err := bcrypt.GenerateFromPassword([]byte(saltedPassword), bcrypt.DefaultCost)
+// bcryptPepperPrefix starts bcrypt hashes of peppered passwords, followed by the key version and the
+// bcrypt hash, since bcrypt's own format has no place for it
+const bcryptPepperPrefix = "$bcrypt$keyid="
+
+// HashPassword peppers the password with the current pepper key version, if any, and hashes it with
+// the configured algorithm. Argon2id hashes are in the PHC string format
+// ($argon2id$v=19$m=...,t=...,p=...[,keyid=...]$salt$hash) and bcrypt hashes in bcrypt's own, behind
+// $bcrypt$keyid=... when peppered, so the salt, parameters and key version are stored with the hash.
+func HashPassword(password string) (string, error) {
+	config := configs.GetConfig().PasswordHashing
+	peppered, err := pepperPassword(password, config.PepperVersion)
 	if err != nil {
 		return "", err
 	}
-	return string(hash), nil
+
+	switch config.Algorithm {
+	case configs.PasswordHashArgon2id:
+		params := argon2idParams{
+			memory:        uint32(config.Argon2id.MemoryKiB),
+			iterations:    uint32(config.Argon2id.Iterations),
+			parallelism:   uint8(config.Argon2id.Parallelism),
+			pepperVersion: config.PepperVersion,
+			salt:          make([]byte, config.Argon2id.SaltBytes),
+		}
+		if params.iterations < 1 || config.Argon2id.Parallelism < 1 || config.Argon2id.Parallelism > 255 ||
+			params.memory < 8*uint32(params.parallelism) || config.Argon2id.SaltBytes < 8 || config.Argon2id.KeyBytes < 16 {
+			return "", errors.New("invalid argon2id parameters")
+		}
+		if _, err := rand.Read(params.salt); err != nil {
+			return "", err
+		}
+		if params.key, err = argon2idKey(peppered, params, uint32(config.Argon2id.KeyBytes)); err != nil {
+			return "", err
+		}
+		return params.String(), nil
+	case configs.PasswordHashBcrypt:
+		hash, err := bcrypt.GenerateFromPassword([]byte(peppered), config.BcryptCost)
+		if err != nil {
+			return "", err
+		}
+		if config.PepperVersion > 0 {
+			return fmt.Sprintf("%s%d%s", bcryptPepperPrefix, config.PepperVersion, hash), nil
+		}
+		return string(hash), nil
+	default:
+		return "", fmt.Errorf("unknown password hashing algorithm %q", config.Algorithm)
+	}
+}
+
+// MaxPasswordBytes returns the longest password, in bytes, the configured hashing accepts, or 0 for
+// no limit. Only bcrypt without pepper has one: a peppered password is a short HMAC of any length.
+func MaxPasswordBytes() int {
+	config := configs.GetConfig().PasswordHashing
+	if config.Algorithm == configs.PasswordHashBcrypt && config.PepperVersion == 0 {
+		return bcryptMaxPasswordBytes
+	}
+	return 0
 }
 
-// CheckPassword compares the stored hash with the hashed combination of the given password and salt.
+// CheckPassword compares the password with a stored hash of any supported format, peppered with the
+// key version the hash records. A non-empty salt marks a legacy hash, a bcrypt hash of the salt
+// followed by the password.
 func CheckPassword(storedHash, salt, givenPassword string) error {
-	// Combine the salt and given password
-	saltedGivenPassword := salt + givenPassword
+	if strings.HasPrefix(storedHash, "$argon2id$") {
+		params, err := parseArgon2id(storedHash)
+		if err != nil {
+			return err
+		}
+		peppered, err := pepperPassword(givenPassword, params.pepperVersion)
+		if err != nil {
+			return err
+		}
+		key, err := argon2idKey(peppered, params, uint32(len(params.key)))
+		if err != nil {
+			return err
+		}
+		if subtle.ConstantTimeCompare(key, params.key) != 1 {
+			return ErrPasswordMismatch
+		}
+		return nil
+	}
+
+	pepperVersion, bcryptHash, err := parseBcrypt(storedHash)
+	if err != nil {
+		return err
+	}
+	peppered, err := pepperPassword(givenPassword, pepperVersion)
+	if err != nil {
+		return err
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(bcryptHash), []byte(salt+peppered))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrPasswordMismatch
+	}
+	return err
+}
 
-	// Hash the given password with the salt
-	return bcrypt.CompareHashAndPassword([]byte(storedHash), []byte(saltedGivenPassword))
+// CheckDummyPassword checks the password against a hash no password matches, hashed with the
+// configured algorithm and parameters. Call it when there is no account to check against, so that
+// the response time does not reveal whether an account exists. The only error it returns is
+// ErrPasswordHashingBusy, which a real check would have run into as well.
+func CheckDummyPassword(givenPassword string) error {
+	dummyHashOnce.Do(func() {
+		raw := make([]byte, 32)
+		if _, err := rand.Read(raw); err != nil {
+			return
+		}
+		dummyHash, _ = HashPassword(base64.RawStdEncoding.EncodeToString(raw))
+	})
+	if dummyHash == "" {
+		return nil
+	}
+	if err := CheckPassword(dummyHash, "", givenPassword); errors.Is(err, ErrPasswordHashingBusy) {
+		return err
+	}
+	return nil
 }
 
+// argon2idKey derives an Argon2id key once one of the password_hashing.argon2id.max_concurrent slots
+// is free. Every hash holds its memory parameter in RAM, so the slots bound what unauthenticated
+// logins can make the process allocate; waiting for a slot is bounded by queue_ms.
+func argon2idKey(password string, params argon2idParams, keyLength uint32) ([]byte, error) {
+	config := configs.GetConfig().PasswordHashing.Argon2id
+	argon2idSlotsOnce.Do(func() {
+		argon2idSlots = make(chan struct{}, max(config.MaxConcurrent, 1))
+	})
+
+	select {
+	case argon2idSlots <- struct{}{}:
+	default:
+		timer := time.NewTimer(time.Duration(config.QueueMillis) * time.Millisecond)
+		defer timer.Stop()
+		select {
+		case argon2idSlots <- struct{}{}:
+		case <-timer.C:
+			return nil, ErrPasswordHashingBusy
+		}
+	}
+	defer func() { <-argon2idSlots }()
+
+	return argon2.IDKey([]byte(password), params.salt, params.iterations, params.memory, params.parallelism, keyLength), nil
+}
+
+// PasswordNeedsRehash reports whether a hash that just verified should be replaced by a new one:
+// legacy salted hashes, hashes of another algorithm or pepper key version, and hashes with other
+// parameters than configured
+func PasswordNeedsRehash(storedHash, salt string) bool {
+	if salt != "" {
+		return true
+	}
+
+	config := configs.GetConfig().PasswordHashing
+	switch config.Algorithm {
+	case configs.PasswordHashArgon2id:
+		params, err := parseArgon2id(storedHash)
+		return err != nil ||
+			params.memory != uint32(config.Argon2id.MemoryKiB) ||
+			params.iterations != uint32(config.Argon2id.Iterations) ||
+			params.parallelism != uint8(config.Argon2id.Parallelism) ||
+			params.pepperVersion != config.PepperVersion ||
+			len(params.salt) != config.Argon2id.SaltBytes ||
+			len(params.key) != config.Argon2id.KeyBytes
+	case configs.PasswordHashBcrypt:
+		pepperVersion, bcryptHash, err := parseBcrypt(storedHash)
+		if err != nil || pepperVersion != config.PepperVersion {
+			return true
+		}
+		cost, err := bcrypt.Cost([]byte(bcryptHash))
+		return err != nil || cost != config.BcryptCost
+	default:
+		return false
+	}
+}
+
+// String formats the parameters as a PHC string
+func (p argon2idParams) String() string {
+	params := fmt.Sprintf("m=%d,t=%d,p=%d", p.memory, p.iterations, p.parallelism)
+	if p.pepperVersion > 0 {
+		params += fmt.Sprintf(",keyid=%d", p.pepperVersion)
+	}
+	return fmt.Sprintf("$argon2id$v=%d$%s$%s$%s", argon2.Version, params,
+		base64.RawStdEncoding.EncodeToString(p.salt), base64.RawStdEncoding.EncodeToString(p.key))
+}
+
+// parseArgon2id reads an Argon2id PHC string
+func parseArgon2id(hash string) (argon2idParams, error) {
+	var params argon2idParams
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, errors.New("malformed argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, fmt.Errorf("unsupported argon2id version %q", parts[2])
+	}
+	for _, param := range strings.Split(parts[3], ",") {
+		name, value, _ := strings.Cut(param, "=")
+		n, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return params, fmt.Errorf("malformed argon2id parameters %q", parts[3])
+		}
+		switch name {
+		case "m":
+			params.memory = uint32(n)
+		case "t":
+			params.iterations = uint32(n)
+		case "p":
+			if n > 255 {
+				return params, fmt.Errorf("malformed argon2id parameters %q", parts[3])
+			}
+			params.parallelism = uint8(n)
+		case "keyid":
+			params.pepperVersion = int(n)
+		default:
+			return params, fmt.Errorf("unknown argon2id parameter %q", name)
+		}
+	}
+	if params.iterations < 1 || params.parallelism < 1 {
+		return params, fmt.Errorf("malformed argon2id parameters %q", parts[3])
+	}
+
+	var err error
+	if params.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return params, errors.New("malformed argon2id salt")
+	}
+	if params.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(params.key) == 0 {
+		return params, errors.New("malformed argon2id hash")
+	}
+	return params, nil
+}
+
+// parseBcrypt returns the pepper key version recorded with a bcrypt hash, 0 if there is none, and
+// the bcrypt hash itself
+func parseBcrypt(hash string) (int, string, error) {
+	rest, peppered := strings.CutPrefix(hash, bcryptPepperPrefix)
+	if !peppered {
+		return 0, hash, nil
+	}
+	versionText, bcryptHash, found := strings.Cut(rest, "$")
+	version, err := strconv.Atoi(versionText)
+	if !found || err != nil || version < 1 {
+		return 0, "", errors.New("malformed peppered bcrypt hash")
+	}
+	return version, "$" + bcryptHash, nil
+}
 
 // IsValidEmail checks if the provided email is valid
 func IsValidEmail(email string) bool {
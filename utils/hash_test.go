@@ -0,0 +1,236 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/Debt-Solvers/BE-auth-service/configs"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// useCheapHashing configures fast hashing parameters for one test
+func useCheapHashing(t *testing.T) *configs.Config {
+	t.Helper()
+
+	config := configs.GetConfig()
+	saved := config.PasswordHashing
+	t.Cleanup(func() { config.PasswordHashing = saved })
+
+	config.PasswordHashing.Algorithm = configs.PasswordHashArgon2id
+	config.PasswordHashing.Argon2id.MemoryKiB = 64
+	config.PasswordHashing.Argon2id.Iterations = 1
+	config.PasswordHashing.Argon2id.Parallelism = 1
+	config.PasswordHashing.Argon2id.SaltBytes = 16
+	config.PasswordHashing.Argon2id.KeyBytes = 32
+	config.PasswordHashing.Argon2id.QueueMillis = 10
+	config.PasswordHashing.BcryptCost = 4
+	config.PasswordHashing.PepperVersion = 0
+	return config
+}
+
+func TestArgon2idRefusesWhenEverySlotIsTaken(t *testing.T) {
+	useCheapHashing(t)
+
+	hash, err := HashPassword("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+
+	// Take every slot, as that many concurrent logins would
+	taken := 0
+	for len(argon2idSlots) < cap(argon2idSlots) {
+		argon2idSlots <- struct{}{}
+		taken++
+	}
+	defer func() {
+		for ; taken > 0; taken-- {
+			<-argon2idSlots
+		}
+	}()
+
+	if err := CheckPassword(hash, "", "correct horse battery staple"); !errors.Is(err, ErrPasswordHashingBusy) {
+		t.Errorf("CheckPassword with every slot taken = %v, want %v", err, ErrPasswordHashingBusy)
+	}
+	if _, err := HashPassword("another password"); !errors.Is(err, ErrPasswordHashingBusy) {
+		t.Errorf("HashPassword with every slot taken = %v, want %v", err, ErrPasswordHashingBusy)
+	}
+
+	// A freed slot is used by the next caller
+	<-argon2idSlots
+	taken--
+	if err := CheckPassword(hash, "", "correct horse battery staple"); err != nil {
+		t.Errorf("CheckPassword with a free slot: %v", err)
+	}
+}
+
+func TestParseArgon2id(t *testing.T) {
+	const salt, key = "c2FsdHNhbHRzYWx0c2FsdA", "a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U"
+	for _, test := range []struct {
+		name          string
+		hash          string
+		valid         bool
+		memory        uint32
+		pepperVersion int
+	}{
+		{"without pepper", "$argon2id$v=19$m=65536,t=3,p=2$" + salt + "$" + key, true, 65536, 0},
+		{"with pepper", "$argon2id$v=19$m=64,t=1,p=1,keyid=7$" + salt + "$" + key, true, 64, 7},
+		{"argon2i", "$argon2i$v=19$m=64,t=1,p=1$" + salt + "$" + key, false, 0, 0},
+		{"missing field", "$argon2id$v=19$m=64,t=1,p=1$" + salt, false, 0, 0},
+		{"old version", "$argon2id$v=16$m=64,t=1,p=1$" + salt + "$" + key, false, 0, 0},
+		{"non-numeric parameter", "$argon2id$v=19$m=lots,t=1,p=1$" + salt + "$" + key, false, 0, 0},
+		{"unknown parameter", "$argon2id$v=19$m=64,t=1,p=1,x=1$" + salt + "$" + key, false, 0, 0},
+		{"parallelism over 255", "$argon2id$v=19$m=64,t=1,p=256$" + salt + "$" + key, false, 0, 0},
+		{"no iterations", "$argon2id$v=19$m=64,t=0,p=1$" + salt + "$" + key, false, 0, 0},
+		{"salt not base64", "$argon2id$v=19$m=64,t=1,p=1$!!!$" + key, false, 0, 0},
+		{"empty key", "$argon2id$v=19$m=64,t=1,p=1$" + salt + "$", false, 0, 0},
+		{"bcrypt hash", "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy", false, 0, 0},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			params, err := parseArgon2id(test.hash)
+			if (err == nil) != test.valid {
+				t.Fatalf("parseArgon2id error = %v, want valid %v", err, test.valid)
+			}
+			if !test.valid {
+				return
+			}
+			if params.memory != test.memory || params.pepperVersion != test.pepperVersion {
+				t.Errorf("memory, keyid = %d, %d, want %d, %d", params.memory, params.pepperVersion, test.memory, test.pepperVersion)
+			}
+			if params.String() != test.hash {
+				t.Errorf("String() = %q, want %q", params.String(), test.hash)
+			}
+		})
+	}
+}
+
+func TestParseBcrypt(t *testing.T) {
+	const hash = "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy"
+	for _, test := range []struct {
+		name          string
+		stored        string
+		valid         bool
+		pepperVersion int
+	}{
+		{"without pepper", hash, true, 0},
+		{"with pepper", bcryptPepperPrefix + "2" + hash, true, 2},
+		{"non-numeric key version", bcryptPepperPrefix + "two" + hash, false, 0},
+		{"key version 0", bcryptPepperPrefix + "0" + hash, false, 0},
+		{"no hash after the key version", bcryptPepperPrefix + "2", false, 0},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			version, bcryptHash, err := parseBcrypt(test.stored)
+			if (err == nil) != test.valid {
+				t.Fatalf("parseBcrypt error = %v, want valid %v", err, test.valid)
+			}
+			if test.valid && (version != test.pepperVersion || bcryptHash != hash) {
+				t.Errorf("parseBcrypt = %d, %q, want %d, %q", version, bcryptHash, test.pepperVersion, hash)
+			}
+		})
+	}
+}
+
+func TestCheckLegacySaltedBcrypt(t *testing.T) {
+	useCheapHashing(t)
+
+	// Legacy hashes are bcrypt hashes of the salt followed by the password
+	const salt, password = "legacy-salt", "correct horse battery staple"
+	hash, err := bcrypt.GenerateFromPassword([]byte(salt+password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("GenerateFromPassword: %v", err)
+	}
+
+	for _, test := range []struct {
+		name     string
+		salt     string
+		password string
+		want     error
+	}{
+		{"right password", salt, password, nil},
+		{"wrong password", salt, "Tr0ub4dor&3", ErrPasswordMismatch},
+		{"salt left out", "", password, ErrPasswordMismatch},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if err := CheckPassword(string(hash), test.salt, test.password); !errors.Is(err, test.want) {
+				t.Errorf("CheckPassword = %v, want %v", err, test.want)
+			}
+		})
+	}
+	if !PasswordNeedsRehash(string(hash), salt) {
+		t.Error("a legacy salted hash does not need a rehash")
+	}
+}
+
+func TestPasswordNeedsRehash(t *testing.T) {
+	config := useCheapHashing(t)
+	usePepperKeys(t, map[int][]byte{
+		1: bytes.Repeat([]byte{1}, minPepperKeyBytes),
+		2: bytes.Repeat([]byte{2}, minPepperKeyBytes),
+	})
+	current := config.PasswordHashing
+
+	for _, test := range []struct {
+		name       string
+		hashedWith func(config *configs.Config) // Changes to the current settings when the hash was made
+		current    func(config *configs.Config) // Changes to the current settings when it is checked
+		rehash     bool
+	}{
+		{"argon2id, same settings", nil, nil, false},
+		{"argon2id, other memory", func(c *configs.Config) { c.PasswordHashing.Argon2id.MemoryKiB = 128 }, nil, true},
+		{"argon2id, other iterations", func(c *configs.Config) { c.PasswordHashing.Argon2id.Iterations = 2 }, nil, true},
+		{"argon2id, other parallelism", func(c *configs.Config) { c.PasswordHashing.Argon2id.Parallelism = 2 }, nil, true},
+		{"argon2id, other salt length", func(c *configs.Config) { c.PasswordHashing.Argon2id.SaltBytes = 32 }, nil, true},
+		{"argon2id, other key length", func(c *configs.Config) { c.PasswordHashing.Argon2id.KeyBytes = 64 }, nil, true},
+		{"argon2id, pepper added", nil, func(c *configs.Config) { c.PasswordHashing.PepperVersion = 1 }, true},
+		{"argon2id, pepper rotated", func(c *configs.Config) { c.PasswordHashing.PepperVersion = 1 },
+			func(c *configs.Config) { c.PasswordHashing.PepperVersion = 2 }, true},
+		{"argon2id, same pepper", func(c *configs.Config) { c.PasswordHashing.PepperVersion = 2 },
+			func(c *configs.Config) { c.PasswordHashing.PepperVersion = 2 }, false},
+		{"bcrypt to argon2id", func(c *configs.Config) { c.PasswordHashing.Algorithm = configs.PasswordHashBcrypt }, nil, true},
+		{"argon2id to bcrypt", nil, func(c *configs.Config) { c.PasswordHashing.Algorithm = configs.PasswordHashBcrypt }, true},
+		{"bcrypt, same settings", func(c *configs.Config) { c.PasswordHashing.Algorithm = configs.PasswordHashBcrypt },
+			func(c *configs.Config) { c.PasswordHashing.Algorithm = configs.PasswordHashBcrypt }, false},
+		{"bcrypt, other cost", func(c *configs.Config) { c.PasswordHashing.Algorithm = configs.PasswordHashBcrypt },
+			func(c *configs.Config) {
+				c.PasswordHashing.Algorithm = configs.PasswordHashBcrypt
+				c.PasswordHashing.BcryptCost = 5
+			}, true},
+		{"bcrypt, pepper added", func(c *configs.Config) { c.PasswordHashing.Algorithm = configs.PasswordHashBcrypt },
+			func(c *configs.Config) {
+				c.PasswordHashing.Algorithm = configs.PasswordHashBcrypt
+				c.PasswordHashing.PepperVersion = 1
+			}, true},
+		{"bcrypt, pepper rotated", func(c *configs.Config) {
+			c.PasswordHashing.Algorithm = configs.PasswordHashBcrypt
+			c.PasswordHashing.PepperVersion = 1
+		}, func(c *configs.Config) {
+			c.PasswordHashing.Algorithm = configs.PasswordHashBcrypt
+			c.PasswordHashing.PepperVersion = 2
+		}, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			config.PasswordHashing = current
+			if test.hashedWith != nil {
+				test.hashedWith(config)
+			}
+			hash, err := HashPassword("correct horse battery staple")
+			if err != nil {
+				t.Fatalf("HashPassword: %v", err)
+			}
+
+			config.PasswordHashing = current
+			if test.current != nil {
+				test.current(config)
+			}
+			if got := PasswordNeedsRehash(hash, ""); got != test.rehash {
+				t.Errorf("PasswordNeedsRehash = %v, want %v", got, test.rehash)
+			}
+		})
+	}
+
+	config.PasswordHashing = current
+	if !PasswordNeedsRehash("$argon2id$v=19$m=64,t=1,p=1$bad", "") {
+		t.Error("a malformed hash does not need a rehash")
+	}
+}
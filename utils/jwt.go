@@ -2,69 +2,214 @@ package utils
 
 import (
 	"fmt"
-	"math/rand"
-	"net/smtp"
-	"strconv"
 	"time"
 
+	"github.com/Debt-Solvers/BE-auth-service/configs"
+
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"github.com/spf13/viper"
 )
 
-// GenerateResetToken generates a 6-digit numerical reset token
-func GenerateResetToken() string {
-	// Create a new random source seeded with the current time
-	randSource := rand.New(rand.NewSource(time.Now().UnixNano()))
+// Purposes of single-purpose tokens; none of them can be used as an access token
+const (
+	PurposeMFAChallenge      = "mfa_challenge"      // Proves the password step of login succeeded
+	PurposeEmailVerification = "email_verification" // Proves control of an email address
+)
+
+// TokenUseService is the token_use claim of tokens issued to our own services
+const TokenUseService = "service"
+
+// AccessTokenTTL returns how long an access token issued by GenerateToken stays valid
+func AccessTokenTTL() time.Duration {
+	return time.Duration(configs.GetConfig().JWT.AccessTokenMinutes) * time.Minute
+}
+
+// RefreshTokenTTL returns how long a refresh token stays valid
+func RefreshTokenTTL() time.Duration {
+	return time.Duration(configs.GetConfig().JWT.RefreshTokenDays) * 24 * time.Hour
+}
+
+// GenerateToken generates a short-lived JWT access token for a user
+func GenerateToken(userID uuid.UUID) (string, error) {
+	return GenerateTokenWithClaims(userID, nil)
+}
+
+// GenerateTokenWithClaims generates an access token carrying extra claims alongside the standard ones
+func GenerateTokenWithClaims(userID uuid.UUID, extra jwt.MapClaims) (string, error) {
+	// Create JWT claims; jti keeps tokens issued within the same second unique
+	now := time.Now()
+	claims := jwt.MapClaims{}
+	for name, value := range extra {
+		claims[name] = value
+	}
+	claims["user_id"] = userID
+	claims["jti"] = uuid.New().String()
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(AccessTokenTTL()).Unix()
 
-	// Generate a random number between 100000 and 999999
-	resetToken := randSource.Intn(900000) + 100000
+	return signClaims(claims)
+}
 
-	// Convert the number to a string and return it
-	return strconv.Itoa(resetToken)
+// GenerateIDToken issues an OpenID Connect ID token for the client. It carries no user_id claim,
+// so it can never be used as an access token.
+func GenerateIDToken(userID uuid.UUID, clientID string, extra jwt.MapClaims) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{}
+	for name, value := range extra {
+		claims[name] = value
+	}
+	claims["iss"] = configs.GetConfig().OAuth.Issuer
+	claims["sub"] = userID
+	claims["aud"] = clientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(IDTokenTTL()).Unix()
+
+	return signClaims(claims)
+}
+
+// IDTokenTTL returns how long an ID token stays valid
+func IDTokenTTL() time.Duration {
+	return time.Duration(configs.GetConfig().OAuth.IDTokenMinutes) * time.Minute
 }
 
-// SendResetTokenEmail sends the reset token to the user's email address
-func SendResetTokenEmail(toEmail, resetToken string) error {
-	// SMTP server configuration
-	smtpHost := "sandbox.smtp.mailtrap.io" 
-	smtpPort := "587"               
-	smtpUser := "ec22aed451accb" 
-	smtpPass := "58db41323b0501"     
+// GenerateServiceToken issues a client credentials token to one of our own services. It carries no
+// user_id claim, so user endpoints reject it, and token_use marks it so it cannot pass for an ID token.
+func GenerateServiceToken(clientID string, audiences []string, scope string) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":       configs.GetConfig().OAuth.Issuer,
+		"sub":       clientID,
+		"aud":       audiences,
+		"client_id": clientID,
+		"scope":     scope,
+		"token_use": TokenUseService,
+		"jti":       uuid.New().String(),
+		"iat":       now.Unix(),
+		"exp":       now.Add(ServiceTokenTTL()).Unix(),
+	}
 
-	// Set up authentication
-	auth := smtp.PlainAuth("", smtpUser, smtpPass, smtpHost)
+	return signClaims(claims)
+}
 
-	// Compose the email message
-	subject := "Password Reset Token Requested!"
-	body := fmt.Sprintf("Your password reset token is: %s\nPlease use this token to reset your password.", resetToken)
-	message := []byte(fmt.Sprintf("Subject: %s\r\n\r\n%s", subject, body))
+// ServiceTokenTTL returns how long a client credentials token stays valid
+func ServiceTokenTTL() time.Duration {
+	return time.Duration(configs.GetConfig().OAuth.ServiceTokenMinutes) * time.Minute
+}
 
-	// Send the email
-	err := smtp.SendMail(smtpHost+":"+smtpPort, auth, smtpUser, []string{toEmail}, message)
+// VerifyServiceToken verifies a client credentials token and returns its claims
+func VerifyServiceToken(tokenString string) (jwt.MapClaims, error) {
+	claims, err := ParseClaims(tokenString)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	if tokenUse, _ := claims["token_use"].(string); tokenUse != TokenUseService {
+		return nil, fmt.Errorf("not a service token")
+	}
+	if _, ok := claims["user_id"]; ok {
+		return nil, fmt.Errorf("invalid token")
+	}
+	return claims, nil
 }
 
-// GenerateToken generates a JWT token for a user
-func GenerateToken(userID uuid.UUID) (string, error) {
-	// Get the secret key from viper
-	secretKey := viper.GetString("JWT_SECRET")
+// GenerateEmailVerificationToken issues a signed token that proves control of the given address
+func GenerateEmailVerificationToken(userID uuid.UUID, email string) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"sub":     userID,
+		"email":   email,
+		"purpose": PurposeEmailVerification,
+		"jti":     uuid.New().String(),
+		"iat":     now.Unix(),
+		"exp":     now.Add(time.Duration(configs.GetConfig().EmailVerification.TokenHours) * time.Hour).Unix(),
+	}
+
+	return signClaims(claims)
+}
 
-	// Create JWT claims
+// GenerateMFAChallengeToken issues a short-lived token proving the password step of login succeeded.
+// It carries a purpose claim and no user_id, so it can never be used as an access token.
+func GenerateMFAChallengeToken(userID uuid.UUID, deviceName string) (string, error) {
+	now := time.Now()
 	claims := jwt.MapClaims{
-		"user_id": userID,
-		"exp":     time.Now().Add(time.Hour * 24).Unix(),
+		"sub":         userID,
+		"purpose":     PurposeMFAChallenge,
+		"device_name": deviceName,
+		"jti":         uuid.New().String(),
+		"iat":         now.Unix(),
+		"exp":         now.Add(MFAChallengeTTL()).Unix(),
+	}
+
+	return signClaims(claims)
+}
+
+// MFAChallengeTTL returns how long an MFA challenge token stays valid
+func MFAChallengeTTL() time.Duration {
+	return time.Duration(configs.GetConfig().MFA.ChallengeMinutes) * time.Minute
+}
+
+// VerifyPurposeToken verifies a single-purpose token and returns its claims
+func VerifyPurposeToken(tokenString, purpose string) (jwt.MapClaims, error) {
+	claims, err := ParseClaims(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if claimPurpose, _ := claims["purpose"].(string); claimPurpose != purpose {
+		return nil, fmt.Errorf("token is not valid for this purpose")
+	}
+	return claims, nil
+}
+
+// SigningKeyProvider supplies the asymmetric keys tokens are signed and verified with
+type SigningKeyProvider interface {
+	// SigningKey returns the key new tokens are signed with
+	SigningKey() (kid string, method jwt.SigningMethod, privateKey interface{}, err error)
+	// VerificationKey returns the published key with the given ID
+	VerificationKey(kid string) (method jwt.SigningMethod, publicKey interface{}, err error)
+}
+
+var signingKeys SigningKeyProvider
+
+// SetSigningKeyProvider installs the key store used by signClaims and ParseClaims
+func SetSigningKeyProvider(provider SigningKeyProvider) {
+	signingKeys = provider
+}
+
+// MaxSignedTokenTTL returns the longest lifetime of any token signed by the service.
+// A retired signing key stays published at least this long.
+func MaxSignedTokenTTL() time.Duration {
+	maxTTL := AccessTokenTTL()
+	for _, ttl := range []time.Duration{
+		MFAChallengeTTL(),
+		IDTokenTTL(),
+		ServiceTokenTTL(),
+		time.Duration(configs.GetConfig().EmailVerification.TokenHours) * time.Hour,
+	} {
+		if ttl > maxTTL {
+			maxTTL = ttl
+		}
+	}
+	return maxTTL
+}
+
+// signClaims signs a set of claims with the current service key and names the key in the kid header
+func signClaims(claims jwt.MapClaims) (string, error) {
+	if signingKeys == nil {
+		return "", fmt.Errorf("signing keys are not configured")
+	}
+
+	kid, method, privateKey, err := signingKeys.SigningKey()
+	if err != nil {
+		return "", err
 	}
 
 	// Create the token using the claims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
 
-	// Sign the token with the secret key
-	signedToken, err := token.SignedString([]byte(secretKey))
+	// Sign the token with the private key
+	signedToken, err := token.SignedString(privateKey)
 	if err != nil {
 		return "", err
 	}
@@ -72,51 +217,83 @@ func GenerateToken(userID uuid.UUID) (string, error) {
 	return signedToken, nil
 }
 
+// ParseClaims verifies a JWT's signature and expiry and returns its claims
+func ParseClaims(tokenString string) (jwt.MapClaims, error) {
+	if signingKeys == nil {
+		return nil, fmt.Errorf("signing keys are not configured")
+	}
 
-// VerifyToken verifies a JWT token and returns the user ID if the token is valid
-func VerifyToken(tokenString string) (uuid.UUID, error) {
 	// Parse the token
 	parsedToken, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// Ensure that the signing method is HMAC
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		// Look up the key the token names
+		kid, _ := token.Header["kid"].(string)
+		method, publicKey, err := signingKeys.VerificationKey(kid)
+		if err != nil {
+			return nil, err
+		}
+		// Ensure that the token was signed with the algorithm of that key
+		if token.Method.Alg() != method.Alg() {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		// Return the secret key
-		return []byte(viper.GetString("JWT_SECRET")), nil
+		return publicKey, nil
 	})
 
 	// Check if parsing the token failed
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("could not parse token: %v", err)
+		return nil, fmt.Errorf("could not parse token: %v", err)
 	}
 
 	// Verify if the token is valid
 	if !parsedToken.Valid {
-		return uuid.Nil, fmt.Errorf("invalid token")
+		return nil, fmt.Errorf("invalid token")
 	}
 
 	// Extract the claims
 	claims, ok := parsedToken.Claims.(jwt.MapClaims)
 	if !ok {
-		return uuid.Nil, fmt.Errorf("could not parse token claims")
+		return nil, fmt.Errorf("could not parse token claims")
 	}
 
 	// Check if the "exp" claim is still valid
 	if exp, ok := claims["exp"].(float64); ok {
 		if time.Unix(int64(exp), 0).Before(time.Now()) {
-			return uuid.Nil, fmt.Errorf("token has expired")
+			return nil, fmt.Errorf("token has expired")
 		}
 	} else {
-		return uuid.Nil, fmt.Errorf("invalid expiration time")
+		return nil, fmt.Errorf("invalid expiration time")
+	}
+
+	return claims, nil
+}
+
+// VerifyToken verifies a JWT token and returns the user ID if the token is valid
+func VerifyToken(tokenString string) (uuid.UUID, error) {
+	userID, _, err := VerifyTokenClaims(tokenString)
+	return userID, err
+}
+
+// VerifyTokenClaims verifies an access token and returns the user ID along with all of its claims
+func VerifyTokenClaims(tokenString string) (uuid.UUID, jwt.MapClaims, error) {
+	claims, err := ParseClaims(tokenString)
+	if err != nil {
+		return uuid.Nil, nil, err
+	}
+
+	// Single-purpose tokens (MFA challenges and the like) are not access tokens
+	if _, ok := claims["purpose"]; ok {
+		return uuid.Nil, nil, fmt.Errorf("invalid token")
 	}
 
 	// Extract the user ID
 	userId, ok := claims["user_id"].(string)
 	if !ok {
-		return uuid.Nil, fmt.Errorf("invalid user ID")
+		return uuid.Nil, nil, fmt.Errorf("invalid user ID")
 	}
 
 	// Convert user ID to UUID
-	return uuid.Parse(userId)
+	userID, err := uuid.Parse(userId)
+	if err != nil {
+		return uuid.Nil, nil, err
+	}
+	return userID, claims, nil
 }
-
@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Debt-Solvers/BE-auth-service/configs"
+)
+
+// minPepperKeyBytes is the shortest pepper key accepted
+const minPepperKeyBytes = 32
+
+var (
+	pepperKeys    map[int][]byte
+	pepperKeysErr error
+	pepperOnce    sync.Once
+)
+
+// LoadPasswordPepper reads the pepper keys from PASSWORD_PEPPER_KEYS and password_hashing.pepper_file.
+// They are read once, so call it at startup to fail early on a broken key or a missing current version.
+func LoadPasswordPepper() error {
+	pepperOnce.Do(func() {
+		pepperKeys, pepperKeysErr = readPepperKeys()
+	})
+	return pepperKeysErr
+}
+
+// readPepperKeys collects "version:base64 key" entries, comma separated in the environment and one
+// per line in the file, where blank lines and lines starting with # are skipped
+func readPepperKeys() (map[int][]byte, error) {
+	config := configs.GetConfig().PasswordHashing
+	entries := strings.Split(config.PepperKeys, ",")
+
+	if config.PepperFile != "" {
+		file, err := os.Open(config.PepperFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading pepper file: %w", err)
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); !strings.HasPrefix(line, "#") {
+				entries = append(entries, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("reading pepper file: %w", err)
+		}
+	}
+
+	keys := make(map[int][]byte)
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		// Keys are never echoed in errors
+		versionText, encoded, found := strings.Cut(entry, ":")
+		version, err := strconv.Atoi(versionText)
+		if !found || err != nil || version < 1 {
+			return nil, fmt.Errorf("pepper key entries must look like <version>:<base64 key> with a version of at least 1")
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) < minPepperKeyBytes {
+			return nil, fmt.Errorf("pepper key version %d must be at least %d bytes of base64", version, minPepperKeyBytes)
+		}
+		if _, ok := keys[version]; ok {
+			return nil, fmt.Errorf("pepper key version %d is defined twice", version)
+		}
+		keys[version] = key
+	}
+
+	if config.PepperVersion > 0 && keys[config.PepperVersion] == nil {
+		return nil, fmt.Errorf("pepper key version %d is not configured", config.PepperVersion)
+	}
+	return keys, nil
+}
+
+// pepperPassword returns the password keyed with the given pepper version: the base64 HMAC-SHA256 of
+// the password, which also keeps long passwords within bcrypt's 72 bytes. Version 0 is no pepper.
+func pepperPassword(password string, version int) (string, error) {
+	if version == 0 {
+		return password, nil
+	}
+	if err := LoadPasswordPepper(); err != nil {
+		return "", err
+	}
+
+	key, ok := pepperKeys[version]
+	if !ok {
+		return "", fmt.Errorf("pepper key version %d is not configured", version)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(password))
+	return base64.RawStdEncoding.EncodeToString(mac.Sum(nil)), nil
+}
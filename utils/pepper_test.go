@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/Debt-Solvers/BE-auth-service/configs"
+)
+
+// usePepperKeys replaces the loaded pepper keys for one test
+func usePepperKeys(t *testing.T, keys map[int][]byte) {
+	t.Helper()
+
+	pepperOnce.Do(func() {}) // Keep the configured keys from being loaded over these
+	saved, savedErr := pepperKeys, pepperKeysErr
+	pepperKeys, pepperKeysErr = keys, nil
+	t.Cleanup(func() {
+		pepperKeys, pepperKeysErr = saved, savedErr
+		pepperOnce = sync.Once{}
+	})
+}
+
+func TestPepperKeyVersionMissingFromLoadedKeys(t *testing.T) {
+	config := useCheapHashing(t)
+	usePepperKeys(t, map[int][]byte{1: bytes.Repeat([]byte{1}, minPepperKeyBytes)})
+	config.PasswordHashing.PepperVersion = 1
+
+	hashes := make(map[string]string)
+	for _, algorithm := range []string{configs.PasswordHashArgon2id, configs.PasswordHashBcrypt} {
+		config.PasswordHashing.Algorithm = algorithm
+		hash, err := HashPassword("correct horse battery staple")
+		if err != nil {
+			t.Fatalf("HashPassword with %s: %v", algorithm, err)
+		}
+		hashes[algorithm] = hash
+	}
+
+	// Version 1 was retired while hashes made with it remain
+	usePepperKeys(t, map[int][]byte{2: bytes.Repeat([]byte{2}, minPepperKeyBytes)})
+	for algorithm, hash := range hashes {
+		err := CheckPassword(hash, "", "correct horse battery staple")
+		if err == nil || errors.Is(err, ErrPasswordMismatch) {
+			t.Errorf("CheckPassword of a %s hash with a missing key version = %v, want a configuration error", algorithm, err)
+		}
+	}
+
+	config.PasswordHashing.PepperVersion = 3
+	if _, err := HashPassword("correct horse battery staple"); err == nil {
+		t.Error("HashPassword with a missing current key version succeeded")
+	}
+}